@@ -3,11 +3,18 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"time"
+
+	"go.uber.org/zap"
 
 	"github.com/iconmobile-dev/go-interview/lib/bootstrap"
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
 	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+	"github.com/iconmobile-dev/go-interview/pkg/oidc"
 	"github.com/iconmobile-dev/go-interview/services/user"
 )
 
@@ -29,8 +36,41 @@ func main() {
 		os.Exit(1)
 	}
 
+	// mail transport
+	m, err := mailer.New(cfg.Mail)
+	if err != nil {
+		log.Errorw("error initializing mailer", "error", err)
+		os.Exit(1)
+	}
+
+	// breached passwords are rejected as new passwords
+	err = userlib.LoadBreachedPasswords(cfg.Password.BreachedListPath)
+	if err != nil {
+		log.Errorw("error loading breached password list", "error", err)
+		os.Exit(1)
+	}
+
+	// company SSO login, disabled without issuer
+	var op *oidc.Provider
+	if cfg.OIDC.Issuer != "" {
+		op, err = oidc.NewProvider(context.Background(), oidc.Config{
+			Issuer:       cfg.OIDC.Issuer,
+			ClientID:     cfg.OIDC.ClientID,
+			ClientSecret: cfg.OIDC.ClientSecret,
+			RedirectURL:  cfg.OIDC.RedirectURL,
+			Scopes:       cfg.OIDC.Scopes,
+		}, nil)
+		if err != nil {
+			log.Errorw("error initializing oidc provider", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	// permanently delete Users after the restore period
+	go purgeDeletedUsers(log, db, time.Duration(cfg.UserDeletion.PurgeIntervalMinutes)*time.Minute)
+
 	// init service
-	s := user.New(db, cache)
+	s := user.New(db, cache, m, op)
 
 	log.Infow("Starting", cfg.Server.Name, "on", cfg.Server.Env, "using port", cfg.Server.PortEngagement)
 
@@ -43,3 +83,22 @@ func main() {
 		os.Exit(3)
 	}
 }
+
+// purgeDeletedUsers purges deleted Users past the retention period in the given interval,
+// running it on every instance is safe
+func purgeDeletedUsers(log *zap.SugaredLogger, db *storage.DB, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		_, err := userlib.PurgeDeletedUsers(db)
+		if err != nil {
+			log.Errorw("error purging deleted users", "error", err)
+		}
+		<-ticker.C
+	}
+}
@@ -11,11 +11,21 @@ import (
 
 // Config used globally
 type Config struct {
-	Server  Server
-	Logging Logging
-	DB      Database `toml:"database"`
-	Redis   Redis
-	Crypto  Crypto
+	Server        Server
+	Logging       Logging
+	DB            Database `toml:"database"`
+	Redis         Redis
+	Crypto        Crypto
+	Password      Password
+	PasswordHash  PasswordHash
+	LoginThrottle LoginThrottle
+	Session       Session
+	Mail          Mail
+	Links         Links
+	TOTP          TOTP
+	OAuth         OAuth
+	OIDC          OIDC
+	UserDeletion  UserDeletion
 }
 
 // Server configuration
@@ -27,6 +37,7 @@ type Server struct {
 	PortEngagement   int
 	PortImager       int
 	PortProduct      int
+	TrustedProxies   []string // IPs or CIDRs of proxies whose X-Forwarded-For and X-Real-IP headers are trusted
 }
 
 // Logging configuration
@@ -55,8 +66,109 @@ type Redis struct {
 }
 
 // Crypto contains encryption keys
+// access tokens are signed with the active key of the keyring,
+// older keys stay in Keys to verify tokens issued before a rotation
 type Crypto struct {
-	TokenValuePassword string
+	TokenValuePassword string            // key without ID, used if no keyring is configured
+	ActiveKeyID        string            // ID of the key in Keys used for signing
+	Keys               map[string]string // keyring of secrets by key ID
+}
+
+// Password policy for new passwords
+type Password struct {
+	MinLength     int
+	RequireUpper  bool
+	RequireLower  bool
+	RequireDigit  bool
+	RequireSymbol bool
+	// file of breached passwords, not checked if empty. One upper case SHA-1 hash and its count per line
+	// (HASH:COUNT) sorted by hash, as written by the HIBP PwnedPasswordsDownloader to a single file,
+	// range API responses (SUFFIX:COUNT) are not supported
+	BreachedListPath string
+	// number of last passwords, including the current one, which may not be reused, 0 disables the check
+	HistorySize int
+	// days previous passwords are kept in the history, 0 keeps them forever
+	HistoryRetentionDays int
+}
+
+// PasswordHash configures the hashing of new passwords,
+// existing hashes are rehashed on login if the algorithm or parameters changed
+type PasswordHash struct {
+	Algorithm         string // "bcrypt" or "argon2id"
+	BcryptCost        int
+	Argon2Memory      int // KiB
+	Argon2Iterations  int
+	Argon2Parallelism int
+}
+
+// Session configures the issued tokens
+type Session struct {
+	TokenMode              string // "opaque" or "signed" access tokens
+	AccessTokenTTLSeconds  int
+	RefreshTokenTTLSeconds int
+}
+
+// Mail configures how emails are sent
+type Mail struct {
+	Transport    string // "smtp" or "outbox"
+	From         string
+	SMTPHost     string
+	SMTPPort     int
+	SMTPUsername string
+	SMTPPassword string
+	OutboxDir    string // the outbox writes emails as files to this directory, keeps them in memory if empty
+}
+
+// Links configures the links sent to Users by email
+type Links struct {
+	BaseURL                    string // URL of the client app the links point to
+	PasswordResetTTLSeconds    int
+	EmailVerifyTTLSeconds      int
+	MagicLinkTTLSeconds        int
+	MagicLinkMaxRequests       int // magic links sent per email within MagicLinkWindowSeconds
+	MagicLinkWindowSeconds     int
+	PasswordResetMaxRequests   int // password reset links sent per email within PasswordResetWindowSeconds
+	PasswordResetWindowSeconds int
+}
+
+// TOTP configures the second factor
+type TOTP struct {
+	Issuer string // shown in authenticator apps
+}
+
+// OAuth configures the tokens issued to OAuth2 clients like internal services
+type OAuth struct {
+	AccessTokenTTLSeconds int
+}
+
+// OIDC configures the login with the OpenID Connect provider of the company SSO,
+// the login is disabled if no Issuer is configured
+type OIDC struct {
+	Issuer        string
+	ClientID      string
+	ClientSecret  string
+	RedirectURL   string   // page of the client app which receives the code, see OIDCCallback
+	Scopes        []string // additional scopes, "openid" is always requested
+	AutoProvision bool     // create Users for unknown verified emails
+}
+
+// UserDeletion configures how long deleted Users can be restored
+// before the purge job deletes them permanently
+type UserDeletion struct {
+	RetentionDays        int
+	PurgeIntervalMinutes int
+}
+
+// LoginThrottle configures the brute-force protection of the login
+// failed logins are counted per email and per client IP
+type LoginThrottle struct {
+	FreeFailures       int // failures per email without delay
+	BackoffBaseSeconds int // delay after the first failure beyond FreeFailures, doubled by each further failure
+	BackoffMaxSeconds  int
+	MaxFailures        int // failures per email until the account is locked
+	IPMaxFailures      int // failures per IP until the IP is locked
+	LockoutSeconds     int
+	WindowSeconds      int // failures are forgotten after this time without failures
 }
 
 //go:embed config_dev.toml
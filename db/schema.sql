@@ -37,15 +37,91 @@ CREATE EXTENSION IF NOT EXISTS pgcrypto;
 
 CREATE TABLE IF NOT EXISTS users (
     id serial,
-    email varchar(100) UNIQUE,
+    email varchar(100),
+    email_to_verify varchar(100) NOT NULL DEFAULT '',
+    email_verified boolean NOT NULL DEFAULT false,
     password text NOT NULL,
+    totp_secret text NOT NULL DEFAULT '',
+    totp_enabled boolean NOT NULL DEFAULT false,
+    role integer NOT NULL DEFAULT 0,
+    status integer NOT NULL DEFAULT 0,
+    status_reason text NOT NULL DEFAULT '',
+    status_until timestamp with time zone,
     firstname text NOT NULL DEFAULT '',
     lastname text NOT NULL DEFAULT '',
     created_at timestamp with time zone NOT NULL DEFAULT NOW(),
     updated_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    deleted_at timestamp with time zone,
     PRIMARY KEY (id)
 );
 
+-- deleted users are purged after the retention period
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- emails of users which are not deleted are unique regardless of their case,
+-- deleted users free their email and can only be restored while nobody else took it
+CREATE UNIQUE INDEX IF NOT EXISTS users_email_lower_key ON users (lower(email)) WHERE deleted_at IS NULL;
+
 DROP TRIGGER IF EXISTS users_updated_at ON users;
 
-CREATE TRIGGER users_updated_at BEFORE UPDATE ON users FOR EACH ROW EXECUTE PROCEDURE set_updated_at_to_now();
\ No newline at end of file
+CREATE TRIGGER users_updated_at BEFORE UPDATE ON users FOR EACH ROW EXECUTE PROCEDURE set_updated_at_to_now();
+
+-- single-use recovery codes of the second factor, only hashes are stored
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id serial,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    code_hash text NOT NULL,
+    used_at timestamp with time zone,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id),
+    UNIQUE (user_id, code_hash)
+);
+
+-- named and scoped API keys of users for machine clients, only hashes are stored
+CREATE TABLE IF NOT EXISTS api_keys (
+    id serial,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    key_hash text NOT NULL UNIQUE,
+    scopes text[] NOT NULL DEFAULT '{}',
+    expires_at timestamp with time zone,
+    last_used_at timestamp with time zone,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_user_id_idx ON api_keys (user_id);
+
+-- OAuth2 clients like internal services, which authenticate as themselves, only hashes of secrets are stored
+CREATE TABLE IF NOT EXISTS oauth_clients (
+    id serial,
+    client_id text NOT NULL UNIQUE,
+    name text NOT NULL,
+    secret_hash text NOT NULL,
+    scopes text[] NOT NULL DEFAULT '{}',
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id)
+);
+
+-- identities of users at OpenID Connect providers, a subject is unique per issuer
+CREATE TABLE IF NOT EXISTS user_identities (
+    id serial,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    issuer text NOT NULL,
+    subject text NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id),
+    UNIQUE (issuer, subject)
+);
+
+-- replaced password hashes of users, new passwords must not match the last ones
+CREATE TABLE IF NOT EXISTS password_history (
+    id serial,
+    user_id integer NOT NULL REFERENCES users (id) ON DELETE CASCADE,
+    password text NOT NULL,
+    created_at timestamp with time zone NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (id)
+);
+
+CREATE INDEX IF NOT EXISTS password_history_user_id_idx ON password_history (user_id, created_at);
@@ -0,0 +1,291 @@
+// Package handlers contains shared router handlers and middleware
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+// context keys for the authenticated User and its Credential
+var (
+	ctxKeyUser       = ContextKey("user")
+	ctxKeyCredential = ContextKey("credential")
+)
+
+// kinds of Credentials
+const (
+	CredentialSession = "session"
+	CredentialAPIKey  = "api_key"
+	CredentialClient  = "client" // OAuth client acting as itself, without a User
+)
+
+// Credential describes how a request was authenticated
+type Credential struct {
+	Kind     string
+	ID       int      // ID of the API key
+	ClientID string   // ID of the OAuth client
+	Scopes   []string // granted scopes, sessions may use every scope
+}
+
+// HasScope returns true if the Credential may be used for the scope
+func (c Credential) HasScope(scope string) bool {
+	if c.Kind == CredentialSession {
+		return true
+	}
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// String describes the Credential for logs
+func (c Credential) String() string {
+	if c.Kind == CredentialClient {
+		return fmt.Sprintf("%s %s", c.Kind, c.ClientID)
+	}
+	return fmt.Sprintf("%s %d", c.Kind, c.ID)
+}
+
+// Authenticate is a middleware which resolves the Bearer token or API key of the request
+// and adds the authenticated User and Credential to the request context,
+// OAuth clients have no User, see RequireUser. Signed access tokens are served from their claims
+// without loading the User, see userlib.Session.ClaimsUser
+// responds with 401 if the token is missing, invalid or expired and with 403 if the User is not active
+func Authenticate(db *storage.DB, cache *storage.Cache) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			// resolve the token
+			userID, claimsUser, credential, err := resolveToken(BearerToken(r), db, cache)
+			if err != nil {
+				log.Infow("failed authentication", "error", err)
+				JSONMsgErr(w, r, err, "Could not authenticate")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), ctxKeyCredential, credential)
+			if credential.Kind == CredentialClient {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			// load the User of the token, signed access tokens carry it in their claims
+			user := claimsUser
+			if user.ID == 0 {
+				user, err = userlib.UserByID(userID, db)
+				if err != nil {
+					if errors.IsKind(errors.NotFound, err) {
+						err = errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+					}
+					log.Infow("failed authentication", "error", err)
+					JSONMsgErr(w, r, err, "Could not authenticate")
+					return
+				}
+			}
+
+			// blocked Users can't use tokens issued before
+			err = user.CheckStatus()
+			if err != nil {
+				log.Infow("failed authentication", "error", err)
+				JSONMsgErr(w, r, err, "Could not authenticate")
+				return
+			}
+
+			ctx = context.WithValue(ctx, ctxKeyUser, user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// resolveToken returns the User ID and Credential of a session token, API key or client token,
+// the User is only returned for signed access tokens which carry it in their claims
+func resolveToken(token string, db *storage.DB, cache *storage.Cache) (int, userlib.User, Credential, error) {
+	if userlib.IsClientToken(token) {
+		session, err := userlib.ClientSessionByToken(token, cache)
+		if err != nil {
+			return 0, userlib.User{}, Credential{}, errors.E(err)
+		}
+		return 0, userlib.User{}, Credential{Kind: CredentialClient, ClientID: session.ClientID, Scopes: session.Scopes}, nil
+	}
+
+	if userlib.IsAPIKey(token) {
+		apiKey, err := userlib.APIKeyByKey(token, db)
+		if err != nil {
+			return 0, userlib.User{}, Credential{}, errors.E(err)
+		}
+		return apiKey.UserID, userlib.User{}, Credential{Kind: CredentialAPIKey, ID: apiKey.ID, Scopes: apiKey.Scopes}, nil
+	}
+
+	session, err := userlib.SessionByToken(token, cache)
+	if err != nil {
+		return 0, userlib.User{}, Credential{}, errors.E(err)
+	}
+	claimsUser, _ := session.ClaimsUser()
+	return session.UserID, claimsUser, Credential{Kind: CredentialSession}, nil
+}
+
+// RequireRole is a middleware which responds with 403 if the authenticated User
+// has a lower Role than the given one or has not enabled TOTP if the Role requires it,
+// MUST BE ADDED AFTER Authenticate
+// OAuth clients have no Role, so they are always rejected
+func RequireRole(role userlib.Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if credential, _ := CurrentCredential(r.Context()); credential.Kind == CredentialClient {
+				err := fmt.Errorf("%v used for route requiring role %v", credential, role)
+				log.Infow("failed authorization", "error", err)
+				JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "Route requires a user"), "Could not authorize")
+				return
+			}
+
+			user, ok := CurrentUser(r.Context())
+			if !ok {
+				err := errors.E(fmt.Errorf("no authenticated user"), errors.Unauthorized, "Token is invalid or expired")
+				JSONMsgErr(w, r, err, "Could not authorize")
+				return
+			}
+
+			if !user.HasRole(role) {
+				err := fmt.Errorf("user %d with role %v requires role %v", user.ID, user.Role, role)
+				log.Infow("failed authorization", "error", err)
+				JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "Insufficient role"), "Could not authorize")
+				return
+			}
+
+			if role.RequiresTOTP() && !user.TOTPEnabled {
+				err := fmt.Errorf("user %d without totp requires totp for role %v", user.ID, role)
+				log.Infow("failed authorization", "error", err)
+				JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "TOTP is required"), "Could not authorize")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireVerifiedEmail is a middleware which responds with 403 if the authenticated User
+// has not verified the email yet, MUST BE ADDED AFTER Authenticate
+func RequireVerifiedEmail(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := CurrentUser(r.Context())
+		if !ok {
+			err := errors.E(fmt.Errorf("no authenticated user"), errors.Unauthorized, "Token is invalid or expired")
+			JSONMsgErr(w, r, err, "Could not authorize")
+			return
+		}
+
+		if !user.EmailVerified {
+			err := fmt.Errorf("user %d has not verified the email", user.ID)
+			log.Infow("failed authorization", "error", err)
+			JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "Email is not verified"), "Could not authorize")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope is a middleware which responds with 403 if the request was authenticated
+// with a Credential which was not granted the scope, MUST BE ADDED AFTER Authenticate
+func RequireScope(scope string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			credential, ok := CurrentCredential(r.Context())
+			if !ok {
+				err := errors.E(fmt.Errorf("no authenticated user"), errors.Unauthorized, "Token is invalid or expired")
+				JSONMsgErr(w, r, err, "Could not authorize")
+				return
+			}
+
+			if !credential.HasScope(scope) {
+				err := fmt.Errorf("%v requires scope %s", credential, scope)
+				log.Infow("failed authorization", "error", err)
+				JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "Insufficient scope"), "Could not authorize")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireSession is a middleware which responds with 403 if the request was not authenticated
+// with a session token of a login, MUST BE ADDED AFTER Authenticate
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential, ok := CurrentCredential(r.Context())
+		if !ok {
+			err := errors.E(fmt.Errorf("no authenticated user"), errors.Unauthorized, "Token is invalid or expired")
+			JSONMsgErr(w, r, err, "Could not authorize")
+			return
+		}
+
+		if credential.Kind != CredentialSession {
+			err := fmt.Errorf("%v used for session route", credential)
+			log.Infow("failed authorization", "error", err)
+			JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "Route requires a login"), "Could not authorize")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireUser is a middleware which responds with 403 if the request was authenticated
+// by an OAuth client instead of a User, MUST BE ADDED AFTER Authenticate
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		credential, ok := CurrentCredential(r.Context())
+		if !ok {
+			err := errors.E(fmt.Errorf("no authenticated user"), errors.Unauthorized, "Token is invalid or expired")
+			JSONMsgErr(w, r, err, "Could not authorize")
+			return
+		}
+
+		if credential.Kind == CredentialClient {
+			err := fmt.Errorf("%v used for user route", credential)
+			log.Infow("failed authorization", "error", err)
+			JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "Route requires a user"), "Could not authorize")
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// CurrentCredential returns the Credential added to the context by the Authenticate middleware
+// returns false if the request is not authenticated
+func CurrentCredential(ctx context.Context) (Credential, bool) {
+	credential, ok := ctx.Value(ctxKeyCredential).(Credential)
+	return credential, ok
+}
+
+// CurrentUser returns the User added to the context by the Authenticate middleware,
+// Users of signed access tokens only have the fields of the claims, see userlib.Session.ClaimsUser
+// returns false if the request is not authenticated
+func CurrentUser(ctx context.Context) (userlib.User, bool) {
+	user, ok := ctx.Value(ctxKeyUser).(userlib.User)
+	return user, ok
+}
+
+// BearerToken returns the token of the request Authorization header
+// returns an empty string if the header is missing or not a Bearer token
+func BearerToken(r *http.Request) string {
+	const prefix = "bearer "
+
+	header := strings.TrimSpace(r.Header.Get("Authorization"))
+	if len(header) < len(prefix) || !strings.EqualFold(header[:len(prefix)], prefix) {
+		return ""
+	}
+
+	return strings.TrimSpace(header[len(prefix):])
+}
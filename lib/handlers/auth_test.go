@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+func TestRequireRole(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+	handler := RequireRole(userlib.RoleSupport)(next)
+
+	tests := []struct {
+		name       string
+		user       *userlib.User
+		credential Credential
+		status     int
+	}{
+		{"User with Role", &userlib.User{ID: 1, Role: userlib.RoleSupport, TOTPEnabled: true}, Credential{Kind: CredentialSession}, 204},
+		{"User with Role without TOTP", &userlib.User{ID: 3, Role: userlib.RoleAdmin}, Credential{Kind: CredentialSession}, 403},
+		{"User with lower Role", &userlib.User{ID: 2, Role: userlib.RoleUser, TOTPEnabled: true}, Credential{Kind: CredentialSession}, 403},
+		{"OAuth client", nil, Credential{Kind: CredentialClient, ClientID: "client", Scopes: []string{userlib.ScopeUsersRead}}, 403},
+		{"no authenticated User", nil, Credential{}, 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			ctx := r.Context()
+			if tt.credential.Kind != "" {
+				ctx = context.WithValue(ctx, ctxKeyCredential, tt.credential)
+			}
+			if tt.user != nil {
+				ctx = context.WithValue(ctx, ctxKeyUser, *tt.user)
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r.WithContext(ctx))
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestRequireVerifiedEmail(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(204)
+	})
+	handler := RequireVerifiedEmail(next)
+
+	tests := []struct {
+		name   string
+		user   *userlib.User
+		status int
+	}{
+		{"verified User", &userlib.User{ID: 1, EmailVerified: true}, 204},
+		{"unverified User", &userlib.User{ID: 2}, 403},
+		{"no authenticated User", nil, 401},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			if tt.user != nil {
+				r = r.WithContext(context.WithValue(r.Context(), ctxKeyUser, *tt.user))
+			}
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, r)
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
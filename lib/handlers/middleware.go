@@ -3,7 +3,9 @@ package handlers
 
 import (
 	"context"
+	"net"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi"
@@ -22,18 +24,90 @@ func (c ContextKey) String() string {
 var ctxKeyTime = ContextKey("time")
 
 // DefaultMiddlewares sets middleware, MUST BE ADDED BEFORE routes
-func DefaultMiddlewares(mux *chi.Mux) func(next http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			mux.Use(addTimeContextMiddleware) // used for request-time and action-time headers
-			//r.Use(timeTrackingMiddleware)
-			mux.Use(logMiddleware) // own logger
-			mux.Use(middleware.RequestID)
-			mux.Use(middleware.RealIP)
-			mux.Use(middleware.Recoverer)
-			mux.Use(middleware.Timeout(180 * time.Second))
-		})
+func DefaultMiddlewares(mux *chi.Mux) {
+	mux.Use(addTimeContextMiddleware) // used for request-time and action-time headers
+	//r.Use(timeTrackingMiddleware)
+	mux.Use(logMiddleware) // own logger
+	mux.Use(middleware.RequestID)
+	mux.Use(realIPMiddleware) // the service runs behind the gateway, see ClientIP
+	mux.Use(middleware.Recoverer)
+	mux.Use(middleware.Timeout(180 * time.Second))
+}
+
+// ClientIP returns the IP of the client without port
+// the realIPMiddleware sets it from the X-Real-IP or X-Forwarded-For header of trusted proxies
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// UserAgentFingerprint identifies the user agent of the client,
+// it is not secret and only binds tokens to the browser which requested them
+func UserAgentFingerprint(r *http.Request) string {
+	return r.UserAgent() + "|" + r.Header.Get("Accept-Language")
+}
+
+// realIPMiddleware sets the RemoteAddr to the client IP forwarded by trusted proxies,
+// the headers of other callers are ignored, so that they can't pretend other IPs
+func realIPMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ip := forwardedClientIP(r, cfg.Server.TrustedProxies); ip != "" {
+			r.RemoteAddr = ip
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// forwardedClientIP returns the client IP of the forwarding headers if the request was sent by a trusted proxy
+// returns an empty string if the headers are not trusted or not set
+func forwardedClientIP(r *http.Request, trustedProxies []string) string {
+	if !isTrustedProxy(ClientIP(r), trustedProxies) {
+		return ""
+	}
+
+	// the rightmost untrusted address was added by the first trusted proxy, the ones before can be forged
+	if forwardedFor := r.Header.Get("X-Forwarded-For"); forwardedFor != "" {
+		ips := strings.Split(forwardedFor, ",")
+		for i := len(ips) - 1; i >= 0; i-- {
+			ip := strings.TrimSpace(ips[i])
+			if net.ParseIP(ip) == nil {
+				return ""
+			}
+			if i == 0 || !isTrustedProxy(ip, trustedProxies) {
+				return ip
+			}
+		}
+	}
+
+	if ip := strings.TrimSpace(r.Header.Get("X-Real-IP")); net.ParseIP(ip) != nil {
+		return ip
+	}
+
+	return ""
+}
+
+// isTrustedProxy returns true if the IP is one of the trusted proxy IPs or CIDRs
+func isTrustedProxy(ip string, trustedProxies []string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil {
+		return false
+	}
+
+	for _, proxy := range trustedProxies {
+		if _, network, err := net.ParseCIDR(proxy); err == nil {
+			if network.Contains(parsed) {
+				return true
+			}
+			continue
+		}
+		if trusted := net.ParseIP(proxy); trusted != nil && trusted.Equal(parsed) {
+			return true
+		}
 	}
+	return false
 }
 
 // logs a request
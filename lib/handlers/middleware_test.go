@@ -0,0 +1,41 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForwardedClientIP(t *testing.T) {
+	trustedProxies := []string{"10.0.0.1", "172.16.0.0/12"}
+
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		realIP       string
+		expectedIP   string // empty if the headers are ignored
+	}{
+		{"untrusted caller", "203.0.113.1:1234", "198.51.100.1", "198.51.100.2", ""},
+		{"trusted proxy with X-Forwarded-For", "10.0.0.1:1234", "198.51.100.1", "", "198.51.100.1"},
+		{"trusted proxy with X-Real-IP", "172.16.0.5:1234", "", "198.51.100.2", "198.51.100.2"},
+		{"forged X-Forwarded-For entries are skipped", "10.0.0.1:1234", "192.0.2.1, 198.51.100.1, 172.16.0.7", "", "198.51.100.1"},
+		{"invalid X-Forwarded-For", "10.0.0.1:1234", "invalid", "198.51.100.2", ""},
+		{"trusted proxy without headers", "10.0.0.1:1234", "", "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwardedFor != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			}
+			if tt.realIP != "" {
+				r.Header.Set("X-Real-IP", tt.realIP)
+			}
+
+			assert.Equal(t, tt.expectedIP, forwardedClientIP(r, trustedProxies))
+		})
+	}
+}
@@ -14,13 +14,17 @@ import (
 
 	"github.com/iconmobile-dev/go-core/errors"
 	jsoniter "github.com/json-iterator/go"
+
+	"github.com/iconmobile-dev/go-interview/pkg/validate"
 )
 
 var json = jsoniter.ConfigFastest
 
 // JSONMsgStr string message response.
+// Fields lists invalid request fields on validation errors
 type JSONMsgStr struct {
-	Msg string
+	Msg    string
+	Fields validate.Errors `json:",omitempty"`
 }
 
 // JSONMsg returns an HTTP response as JSON message with given status code
@@ -159,6 +163,11 @@ func ElapsedMilliseconds(startTime time.Time) int64 {
 	return int64(math.Round(float64(nanoseconds / 1000000)))
 }
 
+// retryAfterError is implemented by errors of throttled requests
+type retryAfterError interface {
+	RetryAfter() time.Duration
+}
+
 // JSONMsgErr returns an HTTP response as JSON message with given status code
 // if v is a string then it is sent as "Msg" property value.
 // Otherwise it encodes v as JSON
@@ -199,6 +208,20 @@ func JSONMsgErr(w http.ResponseWriter, r *http.Request, err error, msg string) {
 		if errMsg != "" {
 			data.Msg = fmt.Sprintf("%s: %s", data.Msg, errMsg)
 		}
+
+		// throttled requests are told when to retry
+		var throttled retryAfterError
+		if errors.As(err, &throttled) {
+			status = 429
+			seconds := int64(math.Ceil(throttled.RetryAfter().Seconds()))
+			w.Header().Set("Retry-After", strconv.FormatInt(seconds, 10))
+		}
+
+		// list invalid fields so clients can show them inline
+		var fieldErrs validate.Errors
+		if errors.As(err, &fieldErrs) {
+			data.Fields = fieldErrs
+		}
 	}
 
 	body, _ = json.Marshal(&data)
@@ -0,0 +1,169 @@
+// Package mailer sends emails through SMTP or keeps them in an outbox for tests and local development
+package mailer
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+
+	"github.com/iconmobile-dev/go-interview/config"
+)
+
+// maxOutboxMessages is the number of emails an Outbox keeps in memory, older ones are dropped
+const maxOutboxMessages = 1000
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// New returns the Mailer of the configured transport,
+// the transport must be set so that emails are not dropped by accident
+func New(cfg config.Mail) (Mailer, error) {
+	switch cfg.Transport {
+	case "smtp":
+		return NewSMTP(cfg.SMTPHost, cfg.SMTPPort, cfg.SMTPUsername, cfg.SMTPPassword, cfg.From), nil
+	case "outbox":
+		return NewOutbox(cfg.OutboxDir), nil
+	case "":
+		return nil, fmt.Errorf("mail transport is not configured")
+	default:
+		return nil, fmt.Errorf("unknown mail transport: %s", cfg.Transport)
+	}
+}
+
+// SMTP sends emails through an SMTP server
+type SMTP struct {
+	addr string
+	auth smtp.Auth
+	from string
+}
+
+// NewSMTP returns a Mailer sending through the given SMTP server,
+// authenticates with PLAIN auth if a username is given
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+	m := &SMTP{
+		addr: fmt.Sprintf("%s:%d", host, port),
+		from: from,
+	}
+	if username != "" {
+		m.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return m
+}
+
+// Send sends the message
+func (m *SMTP) Send(msg Message) error {
+	err := smtp.SendMail(m.addr, m.auth, m.from, []string{msg.To}, format(m.from, msg))
+	if err != nil {
+		return errors.Wrapf(err, "could not send mail to %s", msg.To)
+	}
+	return nil
+}
+
+// Outbox keeps the last sent emails in memory and writes them as files
+// to a directory if one is given
+type Outbox struct {
+	dir string
+
+	mu       sync.Mutex
+	messages []Message
+}
+
+// NewOutbox returns an Outbox writing to dir, only keeps emails in memory if dir is empty
+func NewOutbox(dir string) *Outbox {
+	return &Outbox{dir: dir}
+}
+
+// Send stores the message
+func (o *Outbox) Send(msg Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.messages = append(o.messages, msg)
+	if len(o.messages) > maxOutboxMessages {
+		o.messages = append([]Message(nil), o.messages[len(o.messages)-maxOutboxMessages:]...)
+	}
+
+	if o.dir == "" {
+		return nil
+	}
+
+	err := os.MkdirAll(o.dir, 0o700)
+	if err != nil {
+		return errors.Wrap(err, "could not create outbox directory")
+	}
+
+	name := fmt.Sprintf("%d-%s.eml", time.Now().UnixNano(), sanitizeFileName(msg.To))
+	err = os.WriteFile(filepath.Join(o.dir, name), format("outbox", msg), 0o600)
+	if err != nil {
+		return errors.Wrapf(err, "could not write mail to %s to outbox", msg.To)
+	}
+
+	return nil
+}
+
+// Messages returns the sent emails kept in memory
+func (o *Outbox) Messages() []Message {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	return append([]Message(nil), o.messages...)
+}
+
+// Last returns the last email sent to the given address
+// returns false if no email was sent to it
+func (o *Outbox) Last(to string) (Message, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if strings.EqualFold(o.messages[i].To, to) {
+			return o.messages[i], true
+		}
+	}
+	return Message{}, false
+}
+
+// format returns the message in RFC 5322 format
+func format(from string, msg Message) []byte {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&sb, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&sb, "Subject: %s\r\n", headerValue(msg.Subject))
+	sb.WriteString("MIME-Version: 1.0\r\n")
+	sb.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	sb.WriteString("\r\n")
+	sb.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(sb.String())
+}
+
+// headerValue removes line breaks so that values can't inject headers
+func headerValue(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
+
+// sanitizeFileName replaces all characters of s which are unsafe in file names
+func sanitizeFileName(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '@', r == '.', r == '-', r == '_':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
@@ -0,0 +1,90 @@
+package mailer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/config"
+)
+
+func TestNew(t *testing.T) {
+	m, err := New(config.Mail{Transport: "smtp", SMTPHost: "localhost", SMTPPort: 25})
+	require.NoError(t, err)
+	assert.IsType(t, &SMTP{}, m)
+
+	m, err = New(config.Mail{Transport: "outbox"})
+	require.NoError(t, err)
+	assert.IsType(t, &Outbox{}, m)
+
+	_, err = New(config.Mail{Transport: "pigeon"})
+	assert.Error(t, err)
+
+	// a missing transport is not an outbox silently dropping emails
+	_, err = New(config.Mail{})
+	assert.Error(t, err)
+}
+
+func TestOutbox(t *testing.T) {
+	t.Run("send valid Message in memory", func(t *testing.T) {
+		o := NewOutbox("")
+		require.NoError(t, o.Send(Message{To: "user0@org.com", Subject: "first"}))
+		require.NoError(t, o.Send(Message{To: "user1@org.com", Subject: "other"}))
+		require.NoError(t, o.Send(Message{To: "user0@org.com", Subject: "second"}))
+
+		assert.Len(t, o.Messages(), 3)
+
+		msg, ok := o.Last("User0@org.com")
+		require.True(t, ok)
+		assert.Equal(t, "second", msg.Subject)
+
+		_, ok = o.Last("unknown@org.com")
+		assert.False(t, ok)
+	})
+
+	t.Run("only the last Messages are kept in memory", func(t *testing.T) {
+		o := NewOutbox("")
+		for i := 0; i < maxOutboxMessages+10; i++ {
+			require.NoError(t, o.Send(Message{To: fmt.Sprintf("user%d@org.com", i)}))
+		}
+
+		messages := o.Messages()
+		require.Len(t, messages, maxOutboxMessages)
+		assert.Equal(t, "user10@org.com", messages[0].To)
+
+		_, ok := o.Last("user0@org.com")
+		assert.False(t, ok)
+	})
+
+	t.Run("send valid Message to directory", func(t *testing.T) {
+		dir := filepath.Join(t.TempDir(), "outbox")
+		o := NewOutbox(dir)
+		err := o.Send(Message{To: "user0@org.com", Subject: "Subject", Body: "line0\nline1"})
+		require.NoError(t, err)
+
+		files, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, files, 1)
+		assert.True(t, strings.HasSuffix(files[0].Name(), "-user0@org.com.eml"))
+
+		content, err := os.ReadFile(filepath.Join(dir, files[0].Name()))
+		require.NoError(t, err)
+		assert.Contains(t, string(content), "To: user0@org.com\r\n")
+		assert.Contains(t, string(content), "Subject: Subject\r\n")
+		assert.Contains(t, string(content), "\r\n\r\nline0\r\nline1")
+	})
+
+	t.Run("headers can't be injected", func(t *testing.T) {
+		content := string(format("from@org.com", Message{To: "user0@org.com", Subject: "a\r\nBcc: evil@org.com"}))
+		assert.Contains(t, content, "Subject: aBcc: evil@org.com\r\n")
+	})
+
+	t.Run("file names do not escape the directory", func(t *testing.T) {
+		assert.Equal(t, "_.._.._etc_passwd", sanitizeFileName("/../../etc/passwd"))
+	})
+}
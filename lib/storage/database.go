@@ -30,7 +30,7 @@ func NewDB(host, port, user, password, database, sslMode string) (*DB, error) {
 
 // Reset tries to truncate existing tables, should NOT be run on production!
 func (db *DB) Reset() error {
-	sql := "TRUNCATE users RESTART IDENTITY CASCADE"
+	sql := "TRUNCATE users, oauth_clients RESTART IDENTITY CASCADE"
 	if _, err := db.Exec(sql); err != nil {
 		return errors.Wrapf(err, "database reset failed: %v", err)
 	}
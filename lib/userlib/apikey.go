@@ -0,0 +1,184 @@
+package userlib
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+	"github.com/lib/pq"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/pkg/validate"
+)
+
+// scopes which can be granted to API keys
+const (
+	ScopeUsersRead  = "users:read"
+	ScopeUsersWrite = "users:write"
+)
+
+// Scopes lists all scopes which can be granted
+var Scopes = []string{ScopeUsersRead, ScopeUsersWrite}
+
+const (
+	// APIKeyPrefix starts every API key, so that they can be told apart from other tokens
+	APIKeyPrefix = "gik_"
+
+	apiKeyLength        = 40
+	apiKeyDisplayLength = len(APIKeyPrefix) + 6 // the start of a key is stored to recognize it in lists
+	maxAPIKeyNameLength = 100
+)
+
+// APIKey is a named, scoped credential of a User for machine clients
+// only the hash of the key is stored
+type APIKey struct {
+	ID         int
+	UserID     int `db:"user_id"`
+	Name       string
+	Prefix     string
+	KeyHash    string `db:"key_hash" json:"-"`
+	Scopes     pq.StringArray
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	CreatedAt  time.Time  `db:"created_at"`
+}
+
+// NewAPIKey creates an API key for the User and returns it with the key,
+// the key can't be retrieved later
+// returns Unprocessable if the name, scopes or expiry are invalid
+func NewAPIKey(user User, name string, scopes []string, expiresAt *time.Time, db *storage.DB) (APIKey, string, error) {
+	name = strings.TrimSpace(name)
+
+	var errs validate.Errors
+	switch {
+	case name == "":
+		errs.Add("Name", "is required")
+	case len([]rune(name)) > maxAPIKeyNameLength:
+		errs.Add("Name", "must be at most %d characters long", maxAPIKeyNameLength)
+	}
+	if len(scopes) == 0 {
+		errs.Add("Scopes", "is required")
+	}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			errs.Add("Scopes", "contains unknown scope %q", scope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		errs.Add("ExpiresAt", "must be in the future")
+	}
+	err := validationError(errs)
+	if err != nil {
+		return APIKey{}, "", errors.E(err)
+	}
+
+	key := APIKeyPrefix + strutil.RandomSecure(apiKeyLength, "")
+
+	var apiKey APIKey
+	q := `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, expires_at)
+			VALUES ($1, $2, $3, $4, $5, $6) RETURNING *`
+	err = db.Get(&apiKey, q, user.ID, name, key[:apiKeyDisplayLength], apiKeyHash(key), pq.StringArray(scopes), expiresAt)
+	if err != nil {
+		return APIKey{}, "", errors.E(err, errors.Internal)
+	}
+
+	log.Infow("api key created", "userID", user.ID, "apiKeyID", apiKey.ID)
+	return apiKey, key, nil
+}
+
+// APIKeysByUser returns all API keys of the User
+func APIKeysByUser(userID int, db *storage.DB) ([]APIKey, error) {
+	apiKeys := []APIKey{}
+	q := `SELECT * FROM api_keys WHERE user_id=$1 ORDER BY id`
+	err := db.Select(&apiKeys, q, userID)
+	if err != nil {
+		return apiKeys, errors.E(err, errors.Internal)
+	}
+
+	return apiKeys, nil
+}
+
+// RevokeAPIKey deletes the API key with the given ID of the User
+// returns NotFound if the User has no such API key
+func RevokeAPIKey(userID, id int, db *storage.DB) error {
+	result, err := db.Exec(`DELETE FROM api_keys WHERE id=$1 AND user_id=$2`, id, userID)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	deleted, err := result.RowsAffected()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	if deleted == 0 {
+		return errors.E(fmt.Errorf("api key %d of user %d not found", id, userID), errors.NotFound, "API key not found")
+	}
+
+	log.Infow("api key revoked", "userID", userID, "apiKeyID", id)
+	return nil
+}
+
+// APIKeyByKey loads the API key and records its use
+// returns Unauthorized if the key is unknown or expired
+func APIKeyByKey(key string, db *storage.DB) (APIKey, error) {
+	var apiKey APIKey
+	q := `UPDATE api_keys SET last_used_at=NOW()
+			WHERE key_hash=$1 AND (expires_at IS NULL OR expires_at > NOW()) RETURNING *`
+	err := db.Get(&apiKey, q, apiKeyHash(key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apiKey, errors.E(err, errors.Unauthorized, "API key is invalid or expired")
+		}
+		return apiKey, errors.E(err, errors.Internal)
+	}
+
+	return apiKey, nil
+}
+
+// peekAPIKey loads the API key without recording its use, e.g. to describe it
+// returns Unauthorized if the key is unknown or expired
+func peekAPIKey(key string, db *storage.DB) (APIKey, error) {
+	var apiKey APIKey
+	q := `SELECT * FROM api_keys WHERE key_hash=$1 AND (expires_at IS NULL OR expires_at > NOW())`
+	err := db.Get(&apiKey, q, apiKeyHash(key))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return apiKey, errors.E(err, errors.Unauthorized, "API key is invalid or expired")
+		}
+		return apiKey, errors.E(err, errors.Internal)
+	}
+
+	return apiKey, nil
+}
+
+// IsAPIKey returns true if the token has the form of an API key
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+// HasScope returns true if the scope was granted to the API key
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// isKnownScope returns true if the scope can be granted
+func isKnownScope(scope string) bool {
+	for _, s := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// apiKeyHash returns the stored hash of an API key
+func apiKeyHash(key string) string {
+	return strutil.Hash(key, "api_key")
+}
@@ -0,0 +1,155 @@
+package userlib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{Email: "user_apikey0@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+
+	t.Run("valid key", func(t *testing.T) {
+		apiKey, key, err := NewAPIKey(user, " ci ", []string{ScopeUsersRead}, nil, db)
+		require.NoError(t, err)
+		assert.True(t, IsAPIKey(key))
+		assert.Equal(t, "ci", apiKey.Name)
+		assert.Equal(t, key[:apiKeyDisplayLength], apiKey.Prefix)
+		assert.NotContains(t, apiKey.KeyHash, key)
+		assert.True(t, apiKey.HasScope(ScopeUsersRead))
+		assert.False(t, apiKey.HasScope(ScopeUsersWrite))
+		assert.Nil(t, apiKey.LastUsedAt)
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		past := time.Now().Add(-time.Hour)
+		tests := []struct {
+			name      string
+			keyName   string
+			scopes    []string
+			expiresAt *time.Time
+		}{
+			{"missing name", "", []string{ScopeUsersRead}, nil},
+			{"missing scopes", "ci", nil, nil},
+			{"unknown scope", "ci", []string{"users:all"}, nil},
+			{"expiry in the past", "ci", []string{ScopeUsersRead}, &past},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := NewAPIKey(user, tt.keyName, tt.scopes, tt.expiresAt, db)
+				require.Error(t, err)
+				assert.True(t, errors.IsKind(errors.Unprocessable, err))
+			})
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		_, _, err := NewAPIKey(user, "ci", []string{ScopeUsersRead}, nil, failingDB)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Internal, err))
+	})
+}
+
+func TestAPIKeyByKey(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{Email: "user_apikey1@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+
+	apiKey, key, err := NewAPIKey(user, "ci", []string{ScopeUsersRead, ScopeUsersWrite}, nil, db)
+	require.NoError(t, err)
+
+	t.Run("valid key records use", func(t *testing.T) {
+		loaded, err := APIKeyByKey(key, db)
+		require.NoError(t, err)
+		assert.Equal(t, apiKey.ID, loaded.ID)
+		assert.Equal(t, user.ID, loaded.UserID)
+		assert.NotNil(t, loaded.LastUsedAt)
+	})
+
+	t.Run("unknown key", func(t *testing.T) {
+		_, err := APIKeyByKey(APIKeyPrefix+"unknown", db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("expired key", func(t *testing.T) {
+		expiresAt := time.Now().Add(time.Hour)
+		expiring, key, err := NewAPIKey(user, "expiring", []string{ScopeUsersRead}, &expiresAt, db)
+		require.NoError(t, err)
+
+		_, err = APIKeyByKey(key, db)
+		require.NoError(t, err)
+
+		_, err = db.Exec(`UPDATE api_keys SET expires_at=NOW() - interval '1 minute' WHERE id=$1`, expiring.ID)
+		require.NoError(t, err)
+
+		_, err = APIKeyByKey(key, db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+		_, err = peekAPIKey(key, db)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("introspection does not record use", func(t *testing.T) {
+		unused, key, err := NewAPIKey(user, "unused", []string{ScopeUsersRead}, nil, db)
+		require.NoError(t, err)
+
+		introspection, err := Introspect(key, db, cache)
+		require.NoError(t, err)
+		assert.True(t, introspection.Active)
+
+		loaded, err := peekAPIKey(key, db)
+		require.NoError(t, err)
+		assert.Equal(t, unused.ID, loaded.ID)
+		assert.Nil(t, loaded.LastUsedAt)
+	})
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{Email: "user_apikey2@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+	other := User{Email: "user_apikey3@org.com", Password: "password"}
+	require.NoError(t, other.Insert(db, cache))
+
+	apiKey, key, err := NewAPIKey(user, "ci", []string{ScopeUsersRead}, nil, db)
+	require.NoError(t, err)
+
+	apiKeys, err := APIKeysByUser(user.ID, db)
+	require.NoError(t, err)
+	assert.Len(t, apiKeys, 1)
+
+	t.Run("key of other user", func(t *testing.T) {
+		err := RevokeAPIKey(other.ID, apiKey.ID, db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.NotFound, err))
+	})
+
+	t.Run("own key", func(t *testing.T) {
+		require.NoError(t, RevokeAPIKey(user.ID, apiKey.ID, db))
+
+		_, err := APIKeyByKey(key, db)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		apiKeys, err := APIKeysByUser(user.ID, db)
+		require.NoError(t, err)
+		assert.Empty(t, apiKeys)
+	})
+}
@@ -0,0 +1,36 @@
+package userlib
+
+import (
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/pkg/hibp"
+)
+
+// breachedPasswords are rejected as new passwords, nil if no list is loaded
+var breachedPasswords *hibp.List
+
+// LoadBreachedPasswords loads the list of breached passwords new passwords are checked against,
+// replaces a previously loaded list. An empty path disables the check.
+// Should be called once during startup
+func LoadBreachedPasswords(path string) error {
+	var list *hibp.List
+	if path != "" {
+		var err error
+		list, err = hibp.Open(path)
+		if err != nil {
+			return errors.E(err, errors.Internal)
+		}
+	}
+
+	old := breachedPasswords
+	breachedPasswords = list
+	err := old.Close()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	if list != nil {
+		log.Infow("breached password list loaded", "path", path)
+	}
+	return nil
+}
@@ -0,0 +1,76 @@
+package userlib
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mustLoadBreachedPasswords loads a breached password list of the passwords for the test
+func mustLoadBreachedPasswords(t *testing.T, passwords ...string) {
+	var hashes []string
+	for _, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		hashes = append(hashes, strings.ToUpper(hex.EncodeToString(sum[:]))+":1\n")
+	}
+	sort.Strings(hashes)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(hashes, "")), 0o600))
+	require.NoError(t, LoadBreachedPasswords(path))
+	t.Cleanup(func() {
+		assert.NoError(t, LoadBreachedPasswords(""))
+	})
+}
+
+func TestBreachedPasswords(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	mustLoadBreachedPasswords(t, "breached_password", "password123")
+
+	t.Run("validate breached password", func(t *testing.T) {
+		fieldErrs := mustFieldErrors(t, ValidatePassword("breached_password"))
+		require.Len(t, fieldErrs, 1)
+		assert.Equal(t, "has appeared in a data breach and must not be used", fieldErrs[0].Msg)
+
+		assert.NoError(t, ValidatePassword("not_breached_password"))
+	})
+
+	t.Run("insert User with breached password", func(t *testing.T) {
+		user := User{Email: "user0@org.com", Password: "password123"}
+		err := user.Insert(db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("update User with breached password", func(t *testing.T) {
+		user := User{Email: "user1@org.com", Password: "password"}
+		require.NoError(t, user.Insert(db, cache))
+
+		oldPassword := "password"
+		oldHashedPassword := user.Password
+		user.Password = "breached_password"
+		err := user.Update(oldHashedPassword, &oldPassword, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("missing list fails to load", func(t *testing.T) {
+		err := LoadBreachedPasswords(filepath.Join(t.TempDir(), "missing.txt"))
+		require.Error(t, err)
+
+		// the previous list stays loaded
+		assert.Error(t, ValidatePassword("breached_password"))
+	})
+}
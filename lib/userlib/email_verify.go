@@ -0,0 +1,148 @@
+package userlib
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/pkg/validate"
+)
+
+// defaultEmailVerifyTTL is the lifetime of email verification tokens if not configured
+const defaultEmailVerifyTTL = 24 * time.Hour
+
+// emailVerifyKind is the kind of email verification one-time tokens
+const emailVerifyKind = "email_verify"
+
+// emailVerification is stored for every email verification token
+type emailVerification struct {
+	UserID int
+	Email  string
+}
+
+// EmailVerifyTTL returns the configured lifetime of email verification tokens
+func EmailVerifyTTL() time.Duration {
+	if cfg.Links.EmailVerifyTTLSeconds <= 0 {
+		return defaultEmailVerifyTTL
+	}
+	return time.Duration(cfg.Links.EmailVerifyTTLSeconds) * time.Second
+}
+
+// CheckEmailAvailable returns an Unprocessable error if the email is invalid
+// and a Conflict error if another User has the email.
+// The final check is done by the database on verification, this one allows to fail early
+func CheckEmailAvailable(email string, db *storage.DB) error {
+	email = NormalizeEmail(email)
+
+	var errs validate.Errors
+	validateEmail(&errs, "Email", email)
+	err := validationError(errs)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	// deleted Users free their email
+	_, err = UserByEmail(email, db)
+	if err == nil {
+		return errors.E(fmt.Errorf("email is taken"), errors.Conflict, fmt.Sprintf("user with email %v does already exist", email))
+	}
+	if !errors.IsKind(errors.NotFound, err) {
+		return errors.E(err)
+	}
+
+	return nil
+}
+
+// ChangeEmail stores the new email as EmailToVerify and sends a verification link to it,
+// the Email is only changed once the new email is verified.
+// A failed verification email is only logged, the User can request another one.
+// Should not be called without prior role check, see CanModify!
+func (u *User) ChangeEmail(email string, db *storage.DB, cache *storage.Cache, m mailer.Mailer) error {
+	email = NormalizeEmail(email)
+
+	err := CheckEmailAvailable(email, db)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	var updatedUser User
+	q := `UPDATE users SET email_to_verify=$1 WHERE id=$2 RETURNING *`
+	err = db.Get(&updatedUser, q, email, u.ID)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	*u = updatedUser
+
+	err = u.SendEmailVerification(cache, m)
+	if err != nil {
+		log.Errorw("error sending email verification", "userID", u.ID, "error", err)
+	}
+
+	return nil
+}
+
+// SendEmailVerification sends a link with a single-use verification token to the EmailToVerify
+// returns Unprocessable if there is no email to verify
+func (u User) SendEmailVerification(cache *storage.Cache, m mailer.Mailer) error {
+	if u.EmailToVerify == "" {
+		return errors.E(fmt.Errorf("no email to verify for user %d", u.ID), errors.Unprocessable, "Email is already verified")
+	}
+
+	token, err := newOneTimeToken(emailVerifyKind, emailVerification{
+		UserID: u.ID,
+		Email:  u.EmailToVerify,
+	}, EmailVerifyTTL(), cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	link := fmt.Sprintf("%s/email-verify?token=%s", cfg.Links.BaseURL, url.QueryEscape(token))
+	err = m.Send(mailer.Message{
+		To:      u.EmailToVerify,
+		Subject: "Verify your email",
+		Body: fmt.Sprintf("Hello %s,\n\nopen the following link to verify your email:\n\n%s\n\n"+
+			"The link expires in %v.\n", u.FirstName, link, EmailVerifyTTL()),
+	})
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	log.Infow("email verification sent", "userID", u.ID)
+	return nil
+}
+
+// VerifyEmail promotes the EmailToVerify of the User the verification token was sent to to its Email
+// returns Unauthorized if the token is invalid, expired, already used or the EmailToVerify changed since.
+// Returns Conflict if another User verified the email in the meantime
+func VerifyEmail(token string, db *storage.DB, cache *storage.Cache) (User, error) {
+	var verification emailVerification
+	err := useOneTimeToken(emailVerifyKind, token, &verification, cache)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	var user User
+	q := `UPDATE users SET email=email_to_verify, email_to_verify='', email_verified=true
+			WHERE id=$1 AND email_to_verify=$2 RETURNING *`
+	err = db.Get(&user, q, verification.UserID, verification.Email)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			err := fmt.Errorf("email to verify of user %d changed", verification.UserID)
+			return User{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		case isPQError(err, "unique_violation"):
+			msg := fmt.Sprintf("user with email %v does already exist", verification.Email)
+			return User{}, errors.E(err, errors.Conflict, msg)
+		default:
+			return User{}, errors.E(err, errors.Internal)
+		}
+	}
+
+	log.Infow("email verified", "userID", user.ID)
+	return user, nil
+}
@@ -0,0 +1,108 @@
+package userlib
+
+import (
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
+)
+
+func TestVerifyEmail(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	outbox := mailer.NewOutbox("")
+
+	t.Run("verify valid email of new User", func(t *testing.T) {
+		user := User{Email: "user_verify0@org.com", Password: "password"}
+		require.NoError(t, user.Insert(db, cache))
+		assert.Equal(t, user.Email, user.EmailToVerify)
+		assert.False(t, user.EmailVerified)
+
+		require.NoError(t, user.SendEmailVerification(cache, outbox))
+		token := mustMailToken(t, outbox, user.Email)
+
+		verifiedUser, err := VerifyEmail(token, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, "user_verify0@org.com", verifiedUser.Email)
+		assert.Empty(t, verifiedUser.EmailToVerify)
+		assert.True(t, verifiedUser.EmailVerified)
+
+		// the token can only be used once
+		_, err = VerifyEmail(token, db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		// verified Users have nothing to verify
+		err = verifiedUser.SendEmailVerification(cache, outbox)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("change valid email", func(t *testing.T) {
+		user := User{Email: "user_verify1@org.com", Password: "password"}
+		require.NoError(t, user.Insert(db, cache))
+
+		err := user.ChangeEmail(" User_Verify1_New@org.com", db, cache, outbox)
+		require.NoError(t, err)
+		assert.Equal(t, "user_verify1@org.com", user.Email)
+		assert.Equal(t, "user_verify1_new@org.com", user.EmailToVerify)
+
+		// the old email still logs in until the new one is verified
+		_, err = UserByEmail("user_verify1@org.com", db)
+		require.NoError(t, err)
+
+		token := mustMailToken(t, outbox, "user_verify1_new@org.com")
+		verifiedUser, err := VerifyEmail(token, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, "user_verify1_new@org.com", verifiedUser.Email)
+	})
+
+	t.Run("older tokens are invalid after another email change", func(t *testing.T) {
+		user := User{Email: "user_verify2@org.com", Password: "password"}
+		require.NoError(t, user.Insert(db, cache))
+
+		require.NoError(t, user.ChangeEmail("user_verify2_a@org.com", db, cache, outbox))
+		token := mustMailToken(t, outbox, "user_verify2_a@org.com")
+		require.NoError(t, user.ChangeEmail("user_verify2_b@org.com", db, cache, outbox))
+
+		_, err := VerifyEmail(token, db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("change invalid email", func(t *testing.T) {
+		user := User{Email: "user_verify3@org.com", Password: "password"}
+		require.NoError(t, user.Insert(db, cache))
+
+		err := user.ChangeEmail("invalid", db, cache, outbox)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+
+		err = user.ChangeEmail("User_Verify0@org.com", db, cache, outbox)
+		assert.True(t, errors.IsKind(errors.Conflict, err))
+	})
+
+	t.Run("verify email which was taken in the meantime", func(t *testing.T) {
+		user0 := User{Email: "user_verify4@org.com", Password: "password"}
+		require.NoError(t, user0.Insert(db, cache))
+		user1 := User{Email: "user_verify5@org.com", Password: "password"}
+		require.NoError(t, user1.Insert(db, cache))
+
+		require.NoError(t, user0.ChangeEmail("user_verify_taken@org.com", db, cache, outbox))
+		token0 := mustMailToken(t, outbox, "user_verify_taken@org.com")
+		require.NoError(t, user1.ChangeEmail("user_verify_taken@org.com", db, cache, outbox))
+		token1 := mustMailToken(t, outbox, "user_verify_taken@org.com")
+
+		_, err := VerifyEmail(token1, db, cache)
+		require.NoError(t, err)
+		_, err = VerifyEmail(token0, db, cache)
+		assert.True(t, errors.IsKind(errors.Conflict, err))
+	})
+
+	t.Run("verify invalid email with unknown token", func(t *testing.T) {
+		_, err := VerifyEmail("unknown", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
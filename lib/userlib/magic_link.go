@@ -0,0 +1,128 @@
+package userlib
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+)
+
+// defaults of the magic link login if not configured
+const (
+	defaultMagicLinkTTL         = 15 * time.Minute
+	defaultMagicLinkMaxRequests = 3
+	defaultMagicLinkWindow      = time.Hour
+)
+
+// magicLinkKind is the kind of magic link one-time tokens
+const magicLinkKind = "magic_link"
+
+// magicLink is stored for every magic link token
+type magicLink struct {
+	UserID int
+	// the link can only be used by the user agent which requested it
+	FingerprintHash string
+}
+
+// MagicLinkTTL returns the configured lifetime of magic link tokens
+func MagicLinkTTL() time.Duration {
+	if cfg.Links.MagicLinkTTLSeconds <= 0 {
+		return defaultMagicLinkTTL
+	}
+	return time.Duration(cfg.Links.MagicLinkTTLSeconds) * time.Second
+}
+
+// RequestMagicLink sends a link with a single-use login token to the User with the given email.
+// The fingerprint identifies the requesting user agent, the link only works with the same fingerprint.
+// Does nothing if there is no User with the email, so that callers can't reveal if the email exists.
+// Returns a ThrottledError if too many links were requested for the email
+func RequestMagicLink(email, fingerprint string, db *storage.DB, cache *storage.Cache, m mailer.Mailer) error {
+	// requests are counted for unknown emails as well, so that the limit does not reveal them
+	err := countMagicLinkRequest(NormalizeEmail(email), cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	user, err := UserByEmail(email, db)
+	if err != nil {
+		if errors.IsKind(errors.NotFound, err) {
+			log.Infow("magic link requested for unknown email")
+			return nil
+		}
+		return errors.E(err)
+	}
+
+	token, err := newOneTimeToken(magicLinkKind, magicLink{
+		UserID:          user.ID,
+		FingerprintHash: magicLinkFingerprintHash(fingerprint),
+	}, MagicLinkTTL(), cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	link := fmt.Sprintf("%s/magic-link?token=%s", cfg.Links.BaseURL, url.QueryEscape(token))
+	err = m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Your login link",
+		Body: fmt.Sprintf("Hello %s,\n\nopen the following link in the same browser to log in:\n\n%s\n\n"+
+			"The link expires in %v and can only be used once. If you did not request it, you can ignore this email.\n",
+			user.FirstName, link, MagicLinkTTL()),
+	})
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	log.Infow("magic link requested", "userID", user.ID)
+	return nil
+}
+
+// MagicLinkLogin returns the User the magic link token was sent to,
+// the token is used up even if the fingerprint does not match
+// returns Unauthorized if the token is invalid, expired, already used or requested by another user agent
+func MagicLinkLogin(token, fingerprint string, db *storage.DB, cache *storage.Cache) (User, error) {
+	var link magicLink
+	err := useOneTimeToken(magicLinkKind, token, &link, cache)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	if link.FingerprintHash != magicLinkFingerprintHash(fingerprint) {
+		err := fmt.Errorf("magic link of user %d used by another user agent", link.UserID)
+		return User{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	user, err := UserByID(link.UserID, db)
+	if err != nil {
+		if errors.IsKind(errors.NotFound, err) {
+			return User{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		return User{}, errors.E(err)
+	}
+
+	return user, nil
+}
+
+// countMagicLinkRequest counts a magic link request for the email
+// returns a ThrottledError if the email exceeded the allowed requests
+func countMagicLinkRequest(email string, cache *storage.Cache) error {
+	maxRequests := cfg.Links.MagicLinkMaxRequests
+	if maxRequests <= 0 {
+		maxRequests = defaultMagicLinkMaxRequests
+	}
+	window := time.Duration(cfg.Links.MagicLinkWindowSeconds) * time.Second
+	if window <= 0 {
+		window = defaultMagicLinkWindow
+	}
+
+	return countMailRequest(magicLinkKind, email, maxRequests, window, "Too many magic link requests", cache)
+}
+
+// magicLinkFingerprintHash returns the stored hash of a user agent fingerprint
+func magicLinkFingerprintHash(fingerprint string) string {
+	return strutil.Hash(fingerprint, "magic_link_fingerprint")
+}
@@ -0,0 +1,105 @@
+package userlib
+
+import (
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
+)
+
+func TestRequestMagicLink(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	outbox := mailer.NewOutbox("")
+	user := User{Email: "user_magic0@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+
+	t.Run("request valid magic link", func(t *testing.T) {
+		err := RequestMagicLink("User_Magic0@org.com", "browser", db, cache, outbox)
+		require.NoError(t, err)
+
+		token := mustMailToken(t, outbox, user.Email)
+		ttl, err := cache.TTL(oneTimeTokenKey(magicLinkKind, token)).Result()
+		require.NoError(t, err)
+		assert.InDelta(t, MagicLinkTTL().Seconds(), ttl.Seconds(), 5)
+	})
+
+	t.Run("request magic link for unknown email sends no mail", func(t *testing.T) {
+		count := len(outbox.Messages())
+		err := RequestMagicLink("unknown@org.com", "browser", db, cache, outbox)
+		require.NoError(t, err)
+		assert.Len(t, outbox.Messages(), count)
+	})
+
+	t.Run("request too many magic links", func(t *testing.T) {
+		maxRequests := cfg.Links.MagicLinkMaxRequests
+		cfg.Links.MagicLinkMaxRequests = 2
+		defer func() { cfg.Links.MagicLinkMaxRequests = maxRequests }()
+
+		require.NoError(t, cache.Reset())
+		for i := 0; i < 2; i++ {
+			require.NoError(t, RequestMagicLink(user.Email, "browser", db, cache, outbox))
+		}
+
+		count := len(outbox.Messages())
+		err := RequestMagicLink(user.Email, "browser", db, cache, outbox)
+		require.Error(t, err)
+		var throttled *ThrottledError
+		require.True(t, errors.As(err, &throttled))
+		assert.Positive(t, throttled.RetryAfter())
+		assert.Len(t, outbox.Messages(), count)
+
+		// other emails are not limited
+		require.NoError(t, RequestMagicLink("unknown@org.com", "browser", db, cache, outbox))
+	})
+}
+
+func TestMagicLinkLogin(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	outbox := mailer.NewOutbox("")
+	user := User{Email: "user_magic1@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+
+	t.Run("valid magic link", func(t *testing.T) {
+		require.NoError(t, RequestMagicLink(user.Email, "browser", db, cache, outbox))
+		token := mustMailToken(t, outbox, user.Email)
+
+		loggedIn, err := MagicLinkLogin(token, "browser", db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, loggedIn.ID)
+
+		// the link is single-use
+		_, err = MagicLinkLogin(token, "browser", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("magic link of other user agent", func(t *testing.T) {
+		require.NoError(t, RequestMagicLink(user.Email, "browser", db, cache, outbox))
+		token := mustMailToken(t, outbox, user.Email)
+
+		_, err := MagicLinkLogin(token, "other browser", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		// the link is used up by the failed attempt
+		_, err = MagicLinkLogin(token, "browser", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("invalid token", func(t *testing.T) {
+		_, err := MagicLinkLogin("invalid", "browser", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		_, err = MagicLinkLogin("", "browser", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
@@ -0,0 +1,313 @@
+package userlib
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+	"github.com/lib/pq"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/pkg/validate"
+)
+
+const (
+	// ClientTokenPrefix starts every access token of an OAuth client,
+	// so that they can be told apart from session tokens
+	ClientTokenPrefix = "gct_"
+
+	defaultClientTokenTTL = time.Hour
+	clientSecretLength    = 48
+	clientTokenLength     = 64
+)
+
+// clientIDPattern restricts client IDs to readable names like "imager"
+var clientIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{1,63}$`)
+
+// OAuthClient is a registered OAuth2 client like an internal service,
+// which authenticates as itself with the client_credentials grant
+// only the hash of the secret is stored
+type OAuthClient struct {
+	ID         int
+	ClientID   string `db:"client_id"`
+	Name       string
+	SecretHash string `db:"secret_hash" json:"-"`
+	Scopes     pq.StringArray
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// ClientSession is stored in the cache for every access token issued to an OAuthClient
+type ClientSession struct {
+	ClientID  string
+	Scopes    []string
+	CreatedAt time.Time
+	ExpiresAt time.Time
+}
+
+// ClientToken is an access token issued to an OAuthClient
+type ClientToken struct {
+	AccessToken string
+	ExpiresIn   int // seconds until the access token expires
+	Scopes      []string
+}
+
+// ClientTokenTTL returns the configured lifetime of client access tokens
+func ClientTokenTTL() time.Duration {
+	if cfg.OAuth.AccessTokenTTLSeconds <= 0 {
+		return defaultClientTokenTTL
+	}
+	return time.Duration(cfg.OAuth.AccessTokenTTLSeconds) * time.Second
+}
+
+// NewOAuthClient registers an OAuthClient and returns it with the secret,
+// the secret can't be retrieved later
+// returns Unprocessable if the client ID, name or scopes are invalid
+// and Conflict if the client ID is already registered
+func NewOAuthClient(clientID, name string, scopes []string, db *storage.DB) (OAuthClient, string, error) {
+	clientID = strings.TrimSpace(clientID)
+	name = strings.TrimSpace(name)
+
+	var errs validate.Errors
+	if !clientIDPattern.MatchString(clientID) {
+		errs.Add("ClientID", "must be 2 to 64 lowercase letters, digits, dashes or underscores")
+	}
+	if name == "" {
+		errs.Add("Name", "is required")
+	}
+	if len(scopes) == 0 {
+		errs.Add("Scopes", "is required")
+	}
+	for _, scope := range scopes {
+		if !isKnownScope(scope) {
+			errs.Add("Scopes", "contains unknown scope %q", scope)
+		}
+	}
+	err := validationError(errs)
+	if err != nil {
+		return OAuthClient{}, "", errors.E(err)
+	}
+
+	secret := strutil.RandomSecure(clientSecretLength, "")
+
+	var client OAuthClient
+	q := `INSERT INTO oauth_clients (client_id, name, secret_hash, scopes)
+			VALUES ($1, $2, $3, $4) RETURNING *`
+	err = db.Get(&client, q, clientID, name, clientSecretHash(secret), pq.StringArray(scopes))
+	if err != nil {
+		if isPQError(err, "unique_violation") {
+			return OAuthClient{}, "", errors.E(err, errors.Conflict, fmt.Sprintf("client %v does already exist", clientID))
+		}
+		return OAuthClient{}, "", errors.E(err, errors.Internal)
+	}
+
+	log.Infow("oauth client registered", "clientID", client.ClientID)
+	return client, secret, nil
+}
+
+// OAuthClientByCredentials loads the OAuthClient with given client ID and checks the secret
+// returns the same Unauthorized error if the client is unknown or the secret is incorrect
+func OAuthClientByCredentials(clientID, secret string, db *storage.DB) (OAuthClient, error) {
+	unauthorized := errors.E(fmt.Errorf("invalid credentials of client %q", clientID), errors.Unauthorized, "Client credentials are invalid")
+
+	var client OAuthClient
+	err := db.Get(&client, `SELECT * FROM oauth_clients WHERE client_id=$1 LIMIT 1`, clientID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return client, unauthorized
+		}
+		return client, errors.E(err, errors.Internal)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(client.SecretHash), []byte(clientSecretHash(secret))) != 1 {
+		return OAuthClient{}, unauthorized
+	}
+
+	return client, nil
+}
+
+// NewClientToken issues an access token to the OAuthClient with the requested scopes,
+// all scopes of the client are granted if none are requested
+// returns Forbidden if a scope was not granted to the client
+func (c OAuthClient) NewClientToken(scopes []string, cache *storage.Cache) (ClientToken, error) {
+	if len(scopes) == 0 {
+		scopes = c.Scopes
+	}
+	for _, scope := range scopes {
+		if !c.HasScope(scope) {
+			err := fmt.Errorf("client %q requested scope %q", c.ClientID, scope)
+			return ClientToken{}, errors.E(err, errors.Forbidden, "Scope is not granted to the client")
+		}
+	}
+
+	now := time.Now()
+	session, err := json.Marshal(ClientSession{
+		ClientID:  c.ClientID,
+		Scopes:    scopes,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ClientTokenTTL()),
+	})
+	if err != nil {
+		return ClientToken{}, errors.E(err, errors.Internal)
+	}
+
+	token := ClientToken{
+		AccessToken: ClientTokenPrefix + strutil.RandomSecure(clientTokenLength, ""),
+		ExpiresIn:   int(ClientTokenTTL().Seconds()),
+		Scopes:      scopes,
+	}
+
+	err = cache.Set(clientTokenKey(token.AccessToken), session, ClientTokenTTL()).Err()
+	if err != nil {
+		return ClientToken{}, errors.E(err, errors.Internal)
+	}
+
+	log.Infow("client token issued", "clientID", c.ClientID, "scopes", scopes)
+	return token, nil
+}
+
+// HasScope returns true if the scope was granted to the OAuthClient
+func (c OAuthClient) HasScope(scope string) bool {
+	for _, s := range c.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// ClientSessionByToken loads the ClientSession of the given client access token
+// returns Unauthorized if the token is unknown or expired
+func ClientSessionByToken(token string, cache *storage.Cache) (ClientSession, error) {
+	session := ClientSession{}
+
+	value, err := cache.Get(clientTokenKey(token)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return session, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		return session, errors.E(err, errors.Internal)
+	}
+
+	err = json.Unmarshal(value, &session)
+	if err != nil {
+		return session, errors.E(err, errors.Internal)
+	}
+
+	return session, nil
+}
+
+// IsClientToken returns true if the token has the form of a client access token
+func IsClientToken(token string) bool {
+	return strings.HasPrefix(token, ClientTokenPrefix)
+}
+
+// clientSecretHash returns the stored hash of a client secret
+func clientSecretHash(secret string) string {
+	return strutil.Hash(secret, "client_secret")
+}
+
+// clientTokenKey returns the cache key of a client access token
+func clientTokenKey(token string) string {
+	return fmt.Sprintf("%s:client_token:%s", cachePrefix, strutil.Hash(token, "client_token"))
+}
+
+// Introspection describes an access token as defined by RFC 7662,
+// inactive tokens are only described by Active
+type Introspection struct {
+	Active    bool   `json:"active"`
+	Scope     string `json:"scope,omitempty"` // space separated
+	ClientID  string `json:"client_id,omitempty"`
+	Subject   string `json:"sub,omitempty"` // ID of the User
+	TokenType string `json:"token_type,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+}
+
+// Introspect describes the given client token, session access token or API key
+// unknown, expired or revoked tokens and tokens of blocked Users are inactive
+func Introspect(token string, db *storage.DB, cache *storage.Cache) (Introspection, error) {
+	introspection, err := introspect(token, db, cache)
+	if errors.IsKind(errors.Unauthorized, err) || errors.IsKind(errors.NotFound, err) || errors.IsKind(errors.Forbidden, err) {
+		return Introspection{}, nil
+	}
+	if err != nil {
+		return Introspection{}, errors.E(err)
+	}
+
+	introspection.Active = true
+	introspection.TokenType = "Bearer"
+	return introspection, nil
+}
+
+// introspect describes an active token depending on its kind
+func introspect(token string, db *storage.DB, cache *storage.Cache) (Introspection, error) {
+	switch {
+	case IsClientToken(token):
+		session, err := ClientSessionByToken(token, cache)
+		if err != nil {
+			return Introspection{}, errors.E(err)
+		}
+		return Introspection{
+			Scope:     strings.Join(session.Scopes, " "),
+			ClientID:  session.ClientID,
+			ExpiresAt: session.ExpiresAt.Unix(),
+			IssuedAt:  session.CreatedAt.Unix(),
+		}, nil
+
+	case IsAPIKey(token):
+		// introspection is no use of the key
+		apiKey, err := peekAPIKey(token, db)
+		if err != nil {
+			return Introspection{}, errors.E(err)
+		}
+		err = checkUserStatus(apiKey.UserID, db)
+		if err != nil {
+			return Introspection{}, errors.E(err)
+		}
+		introspection := Introspection{
+			Scope:    strings.Join(apiKey.Scopes, " "),
+			Subject:  fmt.Sprint(apiKey.UserID),
+			IssuedAt: apiKey.CreatedAt.Unix(),
+		}
+		if apiKey.ExpiresAt != nil {
+			introspection.ExpiresAt = apiKey.ExpiresAt.Unix()
+		}
+		return introspection, nil
+
+	default:
+		if token == "" {
+			return Introspection{}, errors.E(fmt.Errorf("empty token"), errors.Unauthorized)
+		}
+		session, err := SessionByToken(token, cache)
+		if err != nil {
+			return Introspection{}, errors.E(err)
+		}
+		// the User might have been deleted or blocked since the login
+		err = checkUserStatus(session.UserID, db)
+		if err != nil {
+			return Introspection{}, errors.E(err)
+		}
+		return Introspection{
+			Scope:     strings.Join(Scopes, " "),
+			Subject:   fmt.Sprint(session.UserID),
+			ExpiresAt: session.CreatedAt.Add(AccessTokenTTL()).Unix(),
+			IssuedAt:  session.CreatedAt.Unix(),
+		}, nil
+	}
+}
+
+// checkUserStatus returns NotFound if the User does not exist and Forbidden if the User is not active
+func checkUserStatus(userID int, db *storage.DB) error {
+	user, err := UserByID(userID, db)
+	if err != nil {
+		return errors.E(err)
+	}
+	return user.CheckStatus()
+}
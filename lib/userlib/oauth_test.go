@@ -0,0 +1,110 @@
+package userlib
+
+import (
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewOAuthClient(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	t.Run("valid client", func(t *testing.T) {
+		client, secret, err := NewOAuthClient("imager", "Imager", []string{ScopeUsersRead}, db)
+		require.NoError(t, err)
+		assert.NotEmpty(t, secret)
+		assert.NotEqual(t, secret, client.SecretHash)
+
+		loaded, err := OAuthClientByCredentials("imager", secret, db)
+		require.NoError(t, err)
+		assert.Equal(t, client.ID, loaded.ID)
+	})
+
+	t.Run("existing client ID", func(t *testing.T) {
+		_, _, err := NewOAuthClient("imager", "Imager", []string{ScopeUsersRead}, db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Conflict, err))
+	})
+
+	t.Run("invalid params", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			clientID string
+			scopes   []string
+		}{
+			{"invalid client ID", "Not Valid", []string{ScopeUsersRead}},
+			{"missing scopes", "product", nil},
+			{"unknown scope", "product", []string{"users:all"}},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, _, err := NewOAuthClient(tt.clientID, "Product", tt.scopes, db)
+				require.Error(t, err)
+				assert.True(t, errors.IsKind(errors.Unprocessable, err))
+			})
+		}
+	})
+
+	t.Run("invalid credentials", func(t *testing.T) {
+		_, err := OAuthClientByCredentials("imager", "wrong", db)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		_, err = OAuthClientByCredentials("unknown", "wrong", db)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
+
+func TestNewClientToken(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	client, _, err := NewOAuthClient("product", "Product", []string{ScopeUsersRead, ScopeUsersWrite}, db)
+	require.NoError(t, err)
+
+	t.Run("all scopes of the client", func(t *testing.T) {
+		token, err := client.NewClientToken(nil, cache)
+		require.NoError(t, err)
+		assert.True(t, IsClientToken(token.AccessToken))
+		assert.ElementsMatch(t, []string{ScopeUsersRead, ScopeUsersWrite}, token.Scopes)
+
+		session, err := ClientSessionByToken(token.AccessToken, cache)
+		require.NoError(t, err)
+		assert.Equal(t, "product", session.ClientID)
+		assert.True(t, session.ExpiresAt.After(session.CreatedAt))
+	})
+
+	t.Run("requested scopes", func(t *testing.T) {
+		token, err := client.NewClientToken([]string{ScopeUsersRead}, cache)
+		require.NoError(t, err)
+
+		introspection, err := Introspect(token.AccessToken, db, cache)
+		require.NoError(t, err)
+		assert.True(t, introspection.Active)
+		assert.Equal(t, ScopeUsersRead, introspection.Scope)
+		assert.Equal(t, "product", introspection.ClientID)
+	})
+
+	t.Run("scope not granted", func(t *testing.T) {
+		limited := client
+		limited.Scopes = []string{ScopeUsersRead}
+		_, err := limited.NewClientToken([]string{ScopeUsersWrite}, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Forbidden, err))
+	})
+
+	t.Run("unknown token", func(t *testing.T) {
+		_, err := ClientSessionByToken(ClientTokenPrefix+"unknown", cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		introspection, err := Introspect(ClientTokenPrefix+"unknown", db, cache)
+		require.NoError(t, err)
+		assert.False(t, introspection.Active)
+	})
+}
@@ -0,0 +1,202 @@
+package userlib
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/pkg/oidc"
+)
+
+// oidcLoginTTL is the time a User has to log in at the provider
+const oidcLoginTTL = 10 * time.Minute
+
+// provisionedPasswordLength is the length of the random password of provisioned Users
+const provisionedPasswordLength = 48
+
+// oidcLoginKind is the kind of the one-time tokens used as OIDC state
+const oidcLoginKind = "oidc_login"
+
+// oidcLogin is stored for every started OIDC login
+type oidcLogin struct {
+	Nonce           string
+	CodeVerifier    string
+	FingerprintHash string
+}
+
+// StartOIDCLogin returns the URL of the provider the User is sent to for the login,
+// the state of the URL is a single-use token and must be passed to CompleteOIDCLogin.
+// The fingerprint identifies the user agent starting the login, only it can complete the login
+func StartOIDCLogin(p *oidc.Provider, fingerprint string, cache *storage.Cache) (string, error) {
+	nonce, err := oidc.NewState()
+	if err != nil {
+		return "", errors.E(err, errors.Internal)
+	}
+	verifier, err := oidc.NewCodeVerifier()
+	if err != nil {
+		return "", errors.E(err, errors.Internal)
+	}
+
+	state, err := newOneTimeToken(oidcLoginKind, oidcLogin{
+		Nonce:           nonce,
+		CodeVerifier:    verifier,
+		FingerprintHash: oidcFingerprintHash(fingerprint),
+	}, oidcLoginTTL, cache)
+	if err != nil {
+		return "", errors.E(err)
+	}
+
+	return p.AuthCodeURL(state, nonce, verifier), nil
+}
+
+// CompleteOIDCLogin redeems the authorization code of the provider and returns the User of the ID token.
+// Users are found by their linked identity or else by the verified email of the ID token,
+// unknown emails get a new User if AutoProvision is configured.
+// The state is used up even if the fingerprint does not match the one of StartOIDCLogin,
+// so that nobody can log in a victim's browser with the state of an own login.
+// returns Unauthorized if the state, code or ID token is invalid or the login was started by another user agent
+// and Forbidden if the email is not verified on both sides or no User may be provisioned
+func CompleteOIDCLogin(ctx context.Context, p *oidc.Provider, state, code, fingerprint string, db *storage.DB, cache *storage.Cache) (User, error) {
+	var login oidcLogin
+	err := useOneTimeToken(oidcLoginKind, state, &login, cache)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	if login.FingerprintHash != oidcFingerprintHash(fingerprint) {
+		err := fmt.Errorf("oidc login completed by another user agent")
+		return User{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	token, err := p.Exchange(ctx, code, login.CodeVerifier)
+	if err != nil {
+		return User{}, errors.E(err, errors.Unauthorized, "Code is invalid or expired")
+	}
+
+	idToken, err := p.VerifyIDToken(ctx, token.IDToken, login.Nonce)
+	if err != nil {
+		return User{}, errors.E(err, errors.Unauthorized, "ID token is invalid")
+	}
+
+	// Users who logged in before are found by their identity, even if the email changed since
+	user, err := userByIdentity(idToken.Issuer, idToken.Subject, db)
+	if err == nil || !errors.IsKind(errors.NotFound, err) {
+		return user, err
+	}
+
+	if idToken.Email == "" || !idToken.EmailVerified {
+		err := fmt.Errorf("email of subject %q is not verified", idToken.Subject)
+		return User{}, errors.E(err, errors.Forbidden, "Email is not verified by the identity provider")
+	}
+
+	user, err = UserByEmail(idToken.Email, db)
+	if err == nil && !user.EmailVerified {
+		// anyone could have signed up with the email, linking would hand the account to the provider's User
+		// while the password of the sign up keeps working
+		err := fmt.Errorf("email of user %d is not verified, not linking subject %q", user.ID, idToken.Subject)
+		return User{}, errors.E(err, errors.Forbidden, "Email of the existing user is not verified")
+	}
+	if err != nil {
+		if !errors.IsKind(errors.NotFound, err) {
+			return User{}, errors.E(err)
+		}
+		if !cfg.OIDC.AutoProvision {
+			err := fmt.Errorf("no user for email of subject %q", idToken.Subject)
+			return User{}, errors.E(err, errors.Forbidden, "No user exists for the email")
+		}
+
+		user, err = provisionOIDCUser(idToken, db, cache)
+		if err != nil {
+			return User{}, errors.E(err)
+		}
+	}
+
+	err = linkIdentity(&user, idToken, db)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	return user, nil
+}
+
+// oidcFingerprintHash returns the stored hash of a user agent fingerprint
+func oidcFingerprintHash(fingerprint string) string {
+	return strutil.Hash(fingerprint, "oidc_login_fingerprint")
+}
+
+// userByIdentity loads the User linked to the subject of the issuer
+// returns NotFound if the subject is not linked
+func userByIdentity(issuer, subject string, db *storage.DB) (User, error) {
+	u := User{}
+	q := `SELECT users.* FROM users
+			JOIN user_identities ON user_identities.user_id = users.id
+			WHERE user_identities.issuer=$1 AND user_identities.subject=$2 AND users.deleted_at IS NULL LIMIT 1`
+	if err := db.Get(&u, q, issuer, subject); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return u, errors.E(err, errors.NotFound)
+		}
+		return u, errors.E(err, errors.Internal)
+	}
+
+	return u, nil
+}
+
+// provisionOIDCUser inserts a User for the ID token
+func provisionOIDCUser(idToken oidc.IDToken, db *storage.DB, cache *storage.Cache) (User, error) {
+	// the password is never revealed, the User logs in with the provider or resets it
+	// the fixed characters satisfy every password policy
+	user := User{
+		Email:     idToken.Email,
+		Password:  "Aa1!" + strutil.RandomSecure(provisionedPasswordLength, ""),
+		FirstName: idToken.GivenName,
+		LastName:  idToken.FamilyName,
+	}
+	err := user.Insert(db, cache)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	log.Infow("user provisioned by oidc login", "userID", user.ID, "issuer", idToken.Issuer)
+	return user, nil
+}
+
+// linkIdentity links the subject of the ID token to the User
+// and marks the email as verified, since the provider verified it
+func linkIdentity(user *User, idToken oidc.IDToken, db *storage.DB) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	_, err = tx.Exec(`INSERT INTO user_identities (user_id, issuer, subject) VALUES ($1, $2, $3)`,
+		user.ID, idToken.Issuer, idToken.Subject)
+	if err != nil {
+		if isPQError(err, "unique_violation") {
+			return errors.E(err, errors.Conflict, "Identity is already linked to another user")
+		}
+		return errors.E(err, errors.Internal)
+	}
+
+	// a pending change to another email stays pending
+	q := `UPDATE users SET email_verified=true,
+			email_to_verify=CASE WHEN lower(email_to_verify)=lower(email) THEN '' ELSE email_to_verify END
+			WHERE id=$1 RETURNING *`
+	err = tx.Get(user, q, user.ID)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	log.Infow("identity linked", "userID", user.ID, "issuer", idToken.Issuer)
+	return nil
+}
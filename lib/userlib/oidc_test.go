@@ -0,0 +1,164 @@
+package userlib
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/pkg/oidc"
+	"github.com/iconmobile-dev/go-interview/pkg/oidc/oidctest"
+)
+
+// oidcFingerprint is the user agent fingerprint of the OIDC logins of the tests
+const oidcFingerprint = "Mozilla/5.0|en-US"
+
+// mustOIDCLogin logs in the User at the stand-in provider
+// and returns the state and code the provider redirected back with
+func mustOIDCLogin(t *testing.T, p *oidc.Provider) (string, string) {
+	authURL, err := StartOIDCLogin(p, oidcFingerprint, cache)
+	require.NoError(t, err)
+
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return location.Query().Get("state"), location.Query().Get("code")
+}
+
+func TestCompleteOIDCLogin(t *testing.T) {
+	autoProvision := cfg.OIDC.AutoProvision
+	t.Cleanup(func() {
+		cfg.OIDC.AutoProvision = autoProvision
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	idp := oidctest.NewServer("gateway", "secret")
+	defer idp.Close()
+
+	ctx := context.Background()
+	p, err := oidc.NewProvider(ctx, oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:3000/oidc-callback",
+	}, nil)
+	require.NoError(t, err)
+
+	user := User{Email: "user_oidc0@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+	_, err = db.Exec(`UPDATE users SET email_verified=true WHERE id=$1`, user.ID)
+	require.NoError(t, err)
+
+	t.Run("link existing user by verified email", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub0", Email: "User_OIDC0@org.com", EmailVerified: true})
+
+		state, code := mustOIDCLogin(t, p)
+		loggedIn, err := CompleteOIDCLogin(ctx, p, state, code, oidcFingerprint, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, loggedIn.ID)
+		assert.True(t, loggedIn.EmailVerified)
+		assert.Empty(t, loggedIn.EmailToVerify)
+
+		// the state is single-use
+		_, err = CompleteOIDCLogin(ctx, p, state, code, oidcFingerprint, db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("existing user with unverified email is not linked", func(t *testing.T) {
+		// e.g. signed up by someone else before the owner of the email logs in with the provider
+		unverified := User{Email: "user_oidc3@org.com", Password: "password"}
+		require.NoError(t, unverified.Insert(db, cache))
+		idp.SetUser(oidctest.User{Subject: "sub4", Email: unverified.Email, EmailVerified: true})
+
+		state, code := mustOIDCLogin(t, p)
+		_, err := CompleteOIDCLogin(ctx, p, state, code, oidcFingerprint, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Forbidden, err))
+
+		_, err = userByIdentity(idp.URL, "sub4", db)
+		assert.True(t, errors.IsKind(errors.NotFound, err))
+		stored, err := UserByID(unverified.ID, db)
+		require.NoError(t, err)
+		assert.False(t, stored.EmailVerified)
+	})
+
+	t.Run("find linked user by subject", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub0", Email: "renamed@org.com", EmailVerified: false})
+
+		state, code := mustOIDCLogin(t, p)
+		loggedIn, err := CompleteOIDCLogin(ctx, p, state, code, oidcFingerprint, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, loggedIn.ID)
+	})
+
+	t.Run("unverified email", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub1", Email: "user_oidc0@org.com", EmailVerified: false})
+
+		state, code := mustOIDCLogin(t, p)
+		_, err := CompleteOIDCLogin(ctx, p, state, code, oidcFingerprint, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Forbidden, err))
+	})
+
+	t.Run("unknown email without auto provisioning", func(t *testing.T) {
+		cfg.OIDC.AutoProvision = false
+		idp.SetUser(oidctest.User{Subject: "sub2", Email: "user_oidc1@org.com", EmailVerified: true})
+
+		state, code := mustOIDCLogin(t, p)
+		_, err := CompleteOIDCLogin(ctx, p, state, code, oidcFingerprint, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Forbidden, err))
+	})
+
+	t.Run("unknown email with auto provisioning", func(t *testing.T) {
+		cfg.OIDC.AutoProvision = true
+		idp.SetUser(oidctest.User{Subject: "sub3", Email: "user_oidc2@org.com", EmailVerified: true, GivenName: "Jane", FamilyName: "Doe"})
+
+		state, code := mustOIDCLogin(t, p)
+		provisioned, err := CompleteOIDCLogin(ctx, p, state, code, oidcFingerprint, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, "user_oidc2@org.com", provisioned.Email)
+		assert.Equal(t, "Jane", provisioned.FirstName)
+		assert.Equal(t, "Doe", provisioned.LastName)
+		assert.Equal(t, RoleUser, provisioned.Role)
+		assert.True(t, provisioned.EmailVerified)
+	})
+
+	t.Run("invalid code", func(t *testing.T) {
+		state, _ := mustOIDCLogin(t, p)
+		_, err := CompleteOIDCLogin(ctx, p, state, "invalid", oidcFingerprint, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("invalid state of another user agent", func(t *testing.T) {
+		state, code := mustOIDCLogin(t, p)
+		_, err := CompleteOIDCLogin(ctx, p, state, code, "curl/7.68.0|", db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		// the state is used up
+		_, err = CompleteOIDCLogin(ctx, p, state, code, oidcFingerprint, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("invalid state", func(t *testing.T) {
+		_, code := mustOIDCLogin(t, p)
+		_, err := CompleteOIDCLogin(ctx, p, "invalid", code, oidcFingerprint, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
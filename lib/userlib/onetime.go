@@ -0,0 +1,94 @@
+package userlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+)
+
+// newOneTimeToken stores the value for the given time under a new random token of the given kind
+// The token itself is not stored, only its hash is used as cache key
+func newOneTimeToken(kind string, value interface{}, ttl time.Duration, cache *storage.Cache) (string, error) {
+	token := strutil.RandomSecure(sessionTokenLength, "")
+
+	b, err := json.Marshal(value)
+	if err != nil {
+		return "", errors.E(err, errors.Internal)
+	}
+
+	err = cache.Set(oneTimeTokenKey(kind, token), b, ttl).Err()
+	if err != nil {
+		return "", errors.E(err, errors.Internal)
+	}
+
+	return token, nil
+}
+
+// useOneTimeToken loads the value of the token and deletes the token, so that it can only be used once
+// returns Unauthorized if the token is unknown, expired or already used
+func useOneTimeToken(kind, token string, value interface{}, cache *storage.Cache) error {
+	if token == "" {
+		return errors.E(fmt.Errorf("empty %s token", kind), errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	// get and delete in one transaction, concurrent requests can't use the token twice
+	key := oneTimeTokenKey(kind, token)
+	var get *redis.StringCmd
+	_, err := cache.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		return errors.E(err, errors.Internal)
+	}
+
+	b, err := get.Bytes()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	err = json.Unmarshal(b, value)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	return nil
+}
+
+// peekOneTimeToken loads the value of the token without using it
+// returns Unauthorized if the token is unknown, expired or already used
+func peekOneTimeToken(kind, token string, value interface{}, cache *storage.Cache) error {
+	if token == "" {
+		return errors.E(fmt.Errorf("empty %s token", kind), errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	b, err := cache.Get(oneTimeTokenKey(kind, token)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		return errors.E(err, errors.Internal)
+	}
+
+	err = json.Unmarshal(b, value)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	return nil
+}
+
+// oneTimeTokenKey returns the cache key of a one-time token
+func oneTimeTokenKey(kind, token string) string {
+	return fmt.Sprintf("%s:%s:%s", cachePrefix, kind, strutil.Hash(token, kind))
+}
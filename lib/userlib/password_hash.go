@@ -0,0 +1,228 @@
+package userlib
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"strings"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+)
+
+// password hashing algorithms, see PasswordHasher
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+// default argon2id parameters if not configured, see RFC 9106
+const (
+	defaultArgon2Memory      = 64 * 1024 // KiB
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	argon2SaltLength         = 16
+	argon2KeyLength          = 32
+)
+
+// errPasswordMismatch is returned by PasswordHasher.Verify if the password does not match
+var errPasswordMismatch = fmt.Errorf("password does not match the hash")
+
+// PasswordHasher hashes passwords with an algorithm and its parameters.
+// The encoded hashes identify their algorithm and parameters,
+// so that they can be verified after the configuration changed
+type PasswordHasher interface {
+	// Hash returns the encoded hash of the password
+	Hash(password string) (string, error)
+	// Verify returns an error if the password does not match the hash of the algorithm
+	Verify(hash, password string) error
+	// IsCurrent returns true if the hash was created with the algorithm and parameters of the hasher
+	IsCurrent(hash string) bool
+}
+
+// BcryptHasher hashes passwords with bcrypt, the hashes have the form $2a$<cost>$<salt and hash>
+type BcryptHasher struct {
+	Cost int
+}
+
+// Hash returns the bcrypt hash of the password
+func (h BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// Verify returns an error if the password does not match the bcrypt hash
+func (h BcryptHasher) Verify(hash, password string) error {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return errPasswordMismatch
+	}
+	return err
+}
+
+// IsCurrent returns true if the hash is a bcrypt hash with the cost of the hasher
+func (h BcryptHasher) IsCurrent(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err == nil && cost == h.Cost
+}
+
+// Argon2idHasher hashes passwords with argon2id, the hashes have the PHC string format
+// $argon2id$v=19$m=<memory>,t=<iterations>,p=<parallelism>$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+}
+
+// Hash returns the argon2id hash of the password with a random salt
+func (h Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.Iterations, h.Memory, h.Parallelism, argon2KeyLength)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, h.Memory, h.Iterations, h.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
+
+// Verify returns an error if the password does not match the argon2id hash,
+// the parameters of the hash are used, not the ones of the hasher
+func (h Argon2idHasher) Verify(hash, password string) error {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return err
+	}
+
+	other := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+	if subtle.ConstantTimeCompare(key, other) != 1 {
+		return errPasswordMismatch
+	}
+	return nil
+}
+
+// IsCurrent returns true if the hash is an argon2id hash with the parameters of the hasher
+func (h Argon2idHasher) IsCurrent(hash string) bool {
+	params, _, key, err := decodeArgon2id(hash)
+	return err == nil && params == h && len(key) == argon2KeyLength
+}
+
+// decodeArgon2id parses an argon2id hash in the PHC string format
+func decodeArgon2id(hash string) (Argon2idHasher, []byte, []byte, error) {
+	var params Argon2idHasher
+	invalid := fmt.Errorf("invalid argon2id hash")
+
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return params, nil, nil, invalid
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, invalid
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, invalid
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, invalid
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, invalid
+	}
+
+	return params, salt, key, nil
+}
+
+// CurrentPasswordHasher returns the hasher for new passwords configured by the PasswordHash config
+func CurrentPasswordHasher() PasswordHasher {
+	c := cfg.PasswordHash
+
+	if c.Algorithm == HashArgon2id {
+		h := Argon2idHasher{
+			Memory:      uint32(c.Argon2Memory),
+			Iterations:  uint32(c.Argon2Iterations),
+			Parallelism: uint8(c.Argon2Parallelism),
+		}
+		if h.Memory == 0 {
+			h.Memory = defaultArgon2Memory
+		}
+		if h.Iterations == 0 {
+			h.Iterations = defaultArgon2Iterations
+		}
+		if h.Parallelism == 0 {
+			h.Parallelism = defaultArgon2Parallelism
+		}
+		return h
+	}
+
+	cost := c.BcryptCost
+	if cost < bcrypt.MinCost || cost > bcrypt.MaxCost {
+		cost = bcrypt.DefaultCost
+	}
+	return BcryptHasher{Cost: cost}
+}
+
+// hashPassword returns the hash of the password with the current hasher
+func hashPassword(password string) (string, error) {
+	hash, err := CurrentPasswordHasher().Hash(password)
+	if err != nil {
+		return "", errors.E(err, errors.Internal)
+	}
+	return hash, nil
+}
+
+// verifyPassword checks the password against a hash of any supported algorithm
+// returns Unauthorized if the password does not match
+func verifyPassword(hash, password string) error {
+	var hasher PasswordHasher
+	switch {
+	case strings.HasPrefix(hash, "$"+HashArgon2id+"$"):
+		hasher = Argon2idHasher{}
+	default:
+		hasher = BcryptHasher{}
+	}
+
+	err := hasher.Verify(hash, password)
+	if err != nil {
+		return errors.E(err, errors.Unauthorized, "Password is incorrect")
+	}
+	return nil
+}
+
+// rehashPassword replaces the stored hash with a hash of the hasher,
+// the password must have been verified against the stored hash.
+// Sessions are kept, since the password itself did not change
+func (u *User) rehashPassword(password string, hasher PasswordHasher, db *storage.DB) error {
+	hash, err := hasher.Hash(password)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	// the stored hash is compared, so that a concurrent password change is not overwritten
+	res, err := db.Exec(`UPDATE users SET password=$1 WHERE id=$2 AND password=$3`, hash, u.ID, u.Password)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	u.Password = hash
+	log.Infow("password rehashed", "userID", u.ID)
+	return nil
+}
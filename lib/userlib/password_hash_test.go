@@ -0,0 +1,132 @@
+package userlib
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/iconmobile-dev/go-interview/config"
+)
+
+func TestPasswordHashers(t *testing.T) {
+	hashers := []PasswordHasher{
+		BcryptHasher{Cost: bcrypt.MinCost},
+		Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1},
+	}
+
+	for _, h := range hashers {
+		h := h
+		t.Run(fmt.Sprintf("%T", h), func(t *testing.T) {
+			hash, err := h.Hash("password")
+			require.NoError(t, err)
+			assert.NotContains(t, hash, "password")
+
+			assert.NoError(t, h.Verify(hash, "password"))
+			assert.Error(t, h.Verify(hash, "incorrect_password"))
+			assert.True(t, h.IsCurrent(hash))
+
+			// the salt is random
+			other, err := h.Hash("password")
+			require.NoError(t, err)
+			assert.NotEqual(t, hash, other)
+
+			// the hash of any algorithm can be verified
+			assert.NoError(t, verifyPassword(hash, "password"))
+			err = verifyPassword(hash, "incorrect_password")
+			require.Error(t, err)
+			assert.True(t, errors.IsKind(errors.Unauthorized, err))
+		})
+	}
+
+	t.Run("argon2id hash identifies its parameters", func(t *testing.T) {
+		h := Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1}
+		hash, err := h.Hash("password")
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(hash, "$argon2id$v=19$m=1024,t=1,p=1$"))
+
+		// verification uses the parameters of the hash
+		stronger := Argon2idHasher{Memory: 2048, Iterations: 2, Parallelism: 1}
+		assert.NoError(t, stronger.Verify(hash, "password"))
+		assert.False(t, stronger.IsCurrent(hash))
+		assert.False(t, BcryptHasher{Cost: bcrypt.MinCost}.IsCurrent(hash))
+	})
+
+	t.Run("bcrypt hash with other cost is not current", func(t *testing.T) {
+		hash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("password")
+		require.NoError(t, err)
+		assert.False(t, BcryptHasher{Cost: bcrypt.MinCost + 1}.IsCurrent(hash))
+		assert.False(t, Argon2idHasher{Memory: 1024, Iterations: 1, Parallelism: 1}.IsCurrent(hash))
+	})
+
+	t.Run("invalid hashes", func(t *testing.T) {
+		for _, hash := range []string{"", "plain", "$argon2id$v=19$m=1024,t=1,p=1$salt", "$argon2id$v=1$m=1024,t=1,p=1$c2FsdA$a2V5"} {
+			assert.Error(t, verifyPassword(hash, "password"), hash)
+		}
+	})
+}
+
+func TestCurrentPasswordHasher(t *testing.T) {
+	hashConfig := cfg.PasswordHash
+	defer func() { cfg.PasswordHash = hashConfig }()
+
+	cfg.PasswordHash.Algorithm = HashBcrypt
+	cfg.PasswordHash.BcryptCost = 0
+	assert.Equal(t, BcryptHasher{Cost: bcrypt.DefaultCost}, CurrentPasswordHasher())
+
+	cfg.PasswordHash.Algorithm = HashArgon2id
+	cfg.PasswordHash.Argon2Memory = 1024
+	cfg.PasswordHash.Argon2Iterations = 2
+	cfg.PasswordHash.Argon2Parallelism = 1
+	assert.Equal(t, Argon2idHasher{Memory: 1024, Iterations: 2, Parallelism: 1}, CurrentPasswordHasher())
+}
+
+func TestRehashPasswordOnLogin(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	hashConfig := cfg.PasswordHash
+	defer func() { cfg.PasswordHash = hashConfig }()
+
+	cfg.PasswordHash = config.PasswordHash{Algorithm: HashBcrypt, BcryptCost: bcrypt.MinCost}
+	user := User{Email: "user0@org.com", Password: "password", FirstName: "firstname0", LastName: "lastname0"}
+	require.NoError(t, user.Insert(db, cache))
+	bcryptHash := user.Password
+
+	t.Run("unchanged configuration keeps the hash", func(t *testing.T) {
+		loggedIn, err := UserByCredentials("user0@org.com", "password", db)
+		require.NoError(t, err)
+		assert.Equal(t, bcryptHash, loggedIn.Password)
+	})
+
+	t.Run("incorrect password does not rehash", func(t *testing.T) {
+		cfg.PasswordHash = config.PasswordHash{Algorithm: HashArgon2id, Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1}
+		_, err := UserByCredentials("user0@org.com", "incorrect_password", db)
+		require.Error(t, err)
+
+		stored, err := UserByID(user.ID, db)
+		require.NoError(t, err)
+		assert.Equal(t, bcryptHash, stored.Password)
+	})
+
+	t.Run("changed algorithm rehashes the password", func(t *testing.T) {
+		cfg.PasswordHash = config.PasswordHash{Algorithm: HashArgon2id, Argon2Memory: 1024, Argon2Iterations: 1, Argon2Parallelism: 1}
+		loggedIn, err := UserByCredentials("user0@org.com", "password", db)
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(loggedIn.Password, "$argon2id$"))
+
+		stored, err := UserByID(user.ID, db)
+		require.NoError(t, err)
+		assert.Equal(t, loggedIn.Password, stored.Password)
+
+		// the new hash works for following logins
+		_, err = UserByCredentials("user0@org.com", "password", db)
+		require.NoError(t, err)
+	})
+}
@@ -0,0 +1,83 @@
+package userlib
+
+import (
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/pkg/validate"
+)
+
+// passwordHistoryCutoff returns the time before which previous passwords are forgotten,
+// the zero time if they are kept forever
+func passwordHistoryCutoff() time.Time {
+	if cfg.Password.HistoryRetentionDays <= 0 {
+		return time.Time{}
+	}
+	return time.Now().AddDate(0, 0, -cfg.Password.HistoryRetentionDays)
+}
+
+// checkPasswordHistory checks that the new password is none of the last passwords of the User,
+// the current hash counts as one of them
+// returns an Unprocessable error if the password was used before
+func checkPasswordHistory(userID int, currentHash, password string, db *storage.DB) error {
+	size := cfg.Password.HistorySize
+	if size <= 0 {
+		return nil
+	}
+
+	hashes := []string{currentHash}
+	if size > 1 {
+		var previous []string
+		q := `SELECT password FROM password_history
+				WHERE user_id=$1 AND created_at > $2
+				ORDER BY created_at DESC, id DESC LIMIT $3`
+		err := db.Select(&previous, q, userID, passwordHistoryCutoff(), size-1)
+		if err != nil {
+			return errors.E(err, errors.Internal)
+		}
+		hashes = append(hashes, previous...)
+	}
+
+	for _, hash := range hashes {
+		if verifyPassword(hash, password) == nil {
+			log.Infow("previous password reused", "userID", userID)
+			var errs validate.Errors
+			errs.Add("Password", "must not be one of the last %d passwords", size)
+			return validationError(errs)
+		}
+	}
+
+	return nil
+}
+
+// addPasswordHistory stores the replaced hash of the User
+// and removes entries beyond the configured size and retention
+func addPasswordHistory(userID int, hash string, tx *sqlx.Tx) error {
+	size := cfg.Password.HistorySize
+	if size <= 1 {
+		// the current hash is checked without history
+		_, err := tx.Exec(`DELETE FROM password_history WHERE user_id=$1`, userID)
+		if err != nil {
+			return errors.E(err, errors.Internal)
+		}
+		return nil
+	}
+
+	_, err := tx.Exec(`INSERT INTO password_history (user_id, password) VALUES ($1, $2)`, userID, hash)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	q := `DELETE FROM password_history WHERE user_id=$1 AND (
+				id NOT IN (SELECT id FROM password_history WHERE user_id=$1 ORDER BY created_at DESC, id DESC LIMIT $2)
+				OR created_at <= $3)`
+	_, err = tx.Exec(q, userID, size-1, passwordHistoryCutoff())
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package userlib
+
+import (
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
+)
+
+// mustChangePassword changes the password of the User
+func mustChangePassword(t *testing.T, user *User, oldPassword, password string) {
+	oldHashedPassword := user.Password
+	user.Password = password
+	require.NoError(t, user.Update(oldHashedPassword, &oldPassword, db, cache))
+}
+
+// changePassword tries to change the password of the User and returns the error
+func changePassword(user User, oldPassword, password string) error {
+	oldHashedPassword := user.Password
+	user.Password = password
+	return user.Update(oldHashedPassword, &oldPassword, db, cache)
+}
+
+func TestPasswordHistory(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	policy := cfg.Password
+	defer func() { cfg.Password = policy }()
+	cfg.Password.HistorySize = 3
+	cfg.Password.HistoryRetentionDays = 0
+
+	t.Run("reuse of the last passwords is rejected", func(t *testing.T) {
+		user := User{Email: "user0@org.com", Password: "password0"}
+		require.NoError(t, user.Insert(db, cache))
+
+		// the current password counts as one of the last passwords
+		err := changePassword(user, "password0", "password0")
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+		fieldErrs := mustFieldErrors(t, err)
+		assert.Equal(t, "must not be one of the last 3 passwords", fieldErrs[0].Msg)
+
+		mustChangePassword(t, &user, "password0", "password1")
+		mustChangePassword(t, &user, "password1", "password2")
+
+		for _, p := range []string{"password0", "password1", "password2"} {
+			err := changePassword(user, "password2", p)
+			require.Error(t, err, p)
+			assert.True(t, errors.IsKind(errors.Unprocessable, err), p)
+		}
+
+		// older passwords may be used again
+		mustChangePassword(t, &user, "password2", "password3")
+		mustChangePassword(t, &user, "password3", "password0")
+	})
+
+	t.Run("history is limited to the configured size", func(t *testing.T) {
+		user := User{Email: "user1@org.com", Password: "password0"}
+		require.NoError(t, user.Insert(db, cache))
+
+		mustChangePassword(t, &user, "password0", "password1")
+		mustChangePassword(t, &user, "password1", "password2")
+		mustChangePassword(t, &user, "password2", "password3")
+
+		var count int
+		require.NoError(t, db.Get(&count, `SELECT count(*) FROM password_history WHERE user_id=$1`, user.ID))
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("password reset checks the history", func(t *testing.T) {
+		outbox := mailer.NewOutbox("")
+		user := User{Email: "user2@org.com", Password: "password0"}
+		require.NoError(t, user.Insert(db, cache))
+
+		require.NoError(t, RequestPasswordReset(user.Email, db, cache, outbox))
+		token := mustMailToken(t, outbox, user.Email)
+		_, err := ResetPassword(token, "password0", db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+
+		// the token is kept and can be retried with another password
+		_, err = ResetPassword(token, "password1", db, cache)
+		require.NoError(t, err)
+		_, err = ResetPassword(token, "password2", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("disabled history allows reuse", func(t *testing.T) {
+		cfg.Password.HistorySize = 0
+		defer func() { cfg.Password.HistorySize = 3 }()
+
+		user := User{Email: "user3@org.com", Password: "password0"}
+		require.NoError(t, user.Insert(db, cache))
+		mustChangePassword(t, &user, "password0", "password0")
+	})
+
+	t.Run("entries are removed with the User", func(t *testing.T) {
+		user := User{Email: "user4@org.com", Password: "password0"}
+		require.NoError(t, user.Insert(db, cache))
+		mustChangePassword(t, &user, "password0", "password1")
+
+		// deleted Users are kept until they are purged
+		require.NoError(t, user.Delete(db, cache))
+		_, err := db.Exec(`UPDATE users SET deleted_at='2000-01-01' WHERE id=$1`, user.ID)
+		require.NoError(t, err)
+		_, err = PurgeDeletedUsers(db)
+		require.NoError(t, err)
+
+		var count int
+		require.NoError(t, db.Get(&count, `SELECT count(*) FROM password_history WHERE user_id=$1`, user.ID))
+		assert.Equal(t, 0, count)
+	})
+}
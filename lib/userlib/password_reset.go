@@ -0,0 +1,154 @@
+package userlib
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+)
+
+// defaults of the password reset if not configured
+const (
+	defaultPasswordResetTTL         = time.Hour
+	defaultPasswordResetMaxRequests = 3
+	defaultPasswordResetWindow      = time.Hour
+)
+
+// passwordResetKind is the kind of password reset one-time tokens
+const passwordResetKind = "password_reset"
+
+// passwordReset is stored for every password reset token
+type passwordReset struct {
+	UserID int
+	// the token is only valid as long as the password was not changed otherwise
+	PasswordHash string
+}
+
+// PasswordResetTTL returns the configured lifetime of password reset tokens
+func PasswordResetTTL() time.Duration {
+	if cfg.Links.PasswordResetTTLSeconds <= 0 {
+		return defaultPasswordResetTTL
+	}
+	return time.Duration(cfg.Links.PasswordResetTTLSeconds) * time.Second
+}
+
+// RequestPasswordReset sends a link with a single-use password reset token to the User with the given email.
+// Does nothing if there is no User with the email, so that callers can't reveal if the email exists.
+// Returns a ThrottledError if too many password resets were requested for the email
+func RequestPasswordReset(email string, db *storage.DB, cache *storage.Cache, m mailer.Mailer) error {
+	// requests are counted for unknown emails as well, so that the limit does not reveal them
+	err := countPasswordResetRequest(NormalizeEmail(email), cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	user, err := UserByEmail(email, db)
+	if err != nil {
+		if errors.IsKind(errors.NotFound, err) {
+			log.Infow("password reset requested for unknown email")
+			return nil
+		}
+		return errors.E(err)
+	}
+
+	token, err := newOneTimeToken(passwordResetKind, passwordReset{
+		UserID:       user.ID,
+		PasswordHash: user.Password,
+	}, PasswordResetTTL(), cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	link := fmt.Sprintf("%s/password-reset?token=%s", cfg.Links.BaseURL, url.QueryEscape(token))
+	err = m.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hello %s,\n\nopen the following link to set a new password:\n\n%s\n\n"+
+			"The link expires in %v. If you did not request a new password, you can ignore this email.\n",
+			user.FirstName, link, PasswordResetTTL()),
+	})
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	log.Infow("password reset requested", "userID", user.ID)
+	return nil
+}
+
+// ResetPassword sets the password of the User the password reset token was issued for
+// and revokes all sessions of the User.
+// Returns Unauthorized if the token is invalid, expired or already used
+func ResetPassword(token, password string, db *storage.DB, cache *storage.Cache) (User, error) {
+	// validate before using the token, so that it can be retried with a valid password
+	err := ValidatePassword(password)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	var reset passwordReset
+	err = peekOneTimeToken(passwordResetKind, token, &reset, cache)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	user, err := UserByID(reset.UserID, db)
+	if err != nil {
+		if errors.IsKind(errors.NotFound, err) {
+			return User{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		return User{}, errors.E(err)
+	}
+
+	if user.Password != reset.PasswordHash {
+		err := fmt.Errorf("password of user %d changed since the reset was requested", user.ID)
+		return User{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	// the password history needs the User of the token, it is checked again by Update
+	err = checkPasswordHistory(user.ID, user.Password, password, db)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	// the token is only used once the new password is valid
+	err = useOneTimeToken(passwordResetKind, token, &reset, cache)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	// Update hashes the new password and revokes all sessions
+	oldHashedPassword := user.Password
+	user.Password = password
+	err = user.Update(oldHashedPassword, nil, db, cache)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	// the owner of the email proved the identity, lift a login lockout
+	err = ResetLoginFailures(user.Email, cache)
+	if err != nil {
+		log.Errorw("error resetting login failures", "error", err)
+	}
+
+	log.Infow("password reset", "userID", user.ID)
+	return user, nil
+}
+
+// countPasswordResetRequest counts a password reset request for the email
+// returns a ThrottledError if the email exceeded the allowed requests
+func countPasswordResetRequest(email string, cache *storage.Cache) error {
+	maxRequests := cfg.Links.PasswordResetMaxRequests
+	if maxRequests <= 0 {
+		maxRequests = defaultPasswordResetMaxRequests
+	}
+	window := time.Duration(cfg.Links.PasswordResetWindowSeconds) * time.Second
+	if window <= 0 {
+		window = defaultPasswordResetWindow
+	}
+
+	return countMailRequest(passwordResetKind, email, maxRequests, window, "Too many password reset requests", cache)
+}
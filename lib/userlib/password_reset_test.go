@@ -0,0 +1,163 @@
+package userlib
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
+)
+
+// linkTokenRegexp matches the token of links sent by email
+var linkTokenRegexp = regexp.MustCompile(`token=([^\s&]+)`)
+
+// mustMailToken returns the token of the link in the last email sent to the address
+func mustMailToken(t *testing.T, outbox *mailer.Outbox, to string) string {
+	msg, ok := outbox.Last(to)
+	require.True(t, ok, "no mail sent to %s", to)
+
+	match := linkTokenRegexp.FindStringSubmatch(msg.Body)
+	require.Len(t, match, 2, "no token in mail to %s", to)
+
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
+
+func TestRequestPasswordReset(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	outbox := mailer.NewOutbox("")
+	user := User{Email: "user_reset0@org.com", Password: "password"}
+	err := user.Insert(db, cache)
+	require.NoError(t, err)
+
+	t.Run("request valid password reset", func(t *testing.T) {
+		err := RequestPasswordReset("User_Reset0@org.com", db, cache, outbox)
+		require.NoError(t, err)
+
+		token := mustMailToken(t, outbox, user.Email)
+		assert.Len(t, token, sessionTokenLength)
+
+		ttl, err := cache.TTL(oneTimeTokenKey(passwordResetKind, token)).Result()
+		require.NoError(t, err)
+		assert.InDelta(t, PasswordResetTTL().Seconds(), ttl.Seconds(), 5)
+	})
+
+	t.Run("request password reset for unknown email sends no mail", func(t *testing.T) {
+		count := len(outbox.Messages())
+		err := RequestPasswordReset("unknown@org.com", db, cache, outbox)
+		require.NoError(t, err)
+		assert.Len(t, outbox.Messages(), count)
+	})
+
+	t.Run("fail to request password reset with db == failingDB", func(t *testing.T) {
+		err := RequestPasswordReset(user.Email, failingDB, cache, outbox)
+		assert.Error(t, err)
+	})
+
+	t.Run("request too many password resets", func(t *testing.T) {
+		maxRequests := cfg.Links.PasswordResetMaxRequests
+		cfg.Links.PasswordResetMaxRequests = 2
+		defer func() { cfg.Links.PasswordResetMaxRequests = maxRequests }()
+
+		require.NoError(t, cache.Reset())
+		for i := 0; i < 2; i++ {
+			require.NoError(t, RequestPasswordReset(user.Email, db, cache, outbox))
+		}
+
+		count := len(outbox.Messages())
+		err := RequestPasswordReset(user.Email, db, cache, outbox)
+		require.Error(t, err)
+		var throttled *ThrottledError
+		require.True(t, errors.As(err, &throttled))
+		assert.Positive(t, throttled.RetryAfter())
+		assert.Len(t, outbox.Messages(), count)
+
+		// unknown emails are limited as well, other emails are not
+		for i := 0; i < 2; i++ {
+			require.NoError(t, RequestPasswordReset("unknown@org.com", db, cache, outbox))
+		}
+		err = RequestPasswordReset("unknown@org.com", db, cache, outbox)
+		assert.True(t, errors.As(err, &throttled))
+		require.NoError(t, RequestPasswordReset("other@org.com", db, cache, outbox))
+	})
+}
+
+func TestResetPassword(t *testing.T) {
+	maxRequests := cfg.Links.PasswordResetMaxRequests
+	t.Cleanup(func() {
+		cfg.Links.PasswordResetMaxRequests = maxRequests
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	// several resets are requested for the same User
+	cfg.Links.PasswordResetMaxRequests = 10
+
+	outbox := mailer.NewOutbox("")
+	user := User{Email: "user_reset1@org.com", Password: "password"}
+	err := user.Insert(db, cache)
+	require.NoError(t, err)
+
+	t.Run("reset valid password", func(t *testing.T) {
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		require.NoError(t, RequestPasswordReset(user.Email, db, cache, outbox))
+		token := mustMailToken(t, outbox, user.Email)
+
+		updatedUser, err := ResetPassword(token, "new_password", db, cache)
+		require.NoError(t, err)
+		assert.NoError(t, updatedUser.IsCorrectPassword("new_password"))
+
+		// all sessions are revoked
+		_, err = SessionByToken(tokens.AccessToken, cache)
+		assert.Error(t, err)
+
+		// the token can only be used once
+		_, err = ResetPassword(token, "other_password", db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("reset invalid password keeps the token", func(t *testing.T) {
+		require.NoError(t, RequestPasswordReset(user.Email, db, cache, outbox))
+		token := mustMailToken(t, outbox, user.Email)
+
+		_, err := ResetPassword(token, "short", db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+
+		_, err = ResetPassword(token, "valid_password", db, cache)
+		assert.NoError(t, err)
+	})
+
+	t.Run("older tokens are invalid after the password changed", func(t *testing.T) {
+		require.NoError(t, RequestPasswordReset(user.Email, db, cache, outbox))
+		token0 := mustMailToken(t, outbox, user.Email)
+		require.NoError(t, RequestPasswordReset(user.Email, db, cache, outbox))
+		token1 := mustMailToken(t, outbox, user.Email)
+
+		_, err := ResetPassword(token1, "new_password1", db, cache)
+		require.NoError(t, err)
+
+		_, err = ResetPassword(token0, "new_password0", db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("reset invalid password with unknown or empty token", func(t *testing.T) {
+		_, err := ResetPassword("unknown", "new_password", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+		_, err = ResetPassword("", "new_password", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
@@ -0,0 +1,65 @@
+package userlib
+
+import (
+	"reflect"
+	"strings"
+)
+
+// visibleTagName is the struct tag declaring who may see a User field.
+// Fields without the tag are visible to everyone, otherwise the tag is
+// a comma separated list of:
+//   - "self" the User itself
+//   - a Role name like "support", Users with at least that Role
+//   - "-" nobody, the field is always removed
+//
+// Example:
+//
+//	Email string `visible:"self,support"`
+const visibleTagName = "visible"
+
+// Redact returns a copy of the User with all fields the viewer may not see
+// according to their visible tag reset to the zero value.
+// The viewer is nil for unauthenticated requests.
+func (u User) Redact(viewer *User) User {
+	v := reflect.ValueOf(&u).Elem()
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+
+		tag, ok := field.Tag.Lookup(visibleTagName)
+		if !ok || !v.Field(i).CanSet() {
+			continue
+		}
+
+		if !isVisibleTo(tag, u, viewer) {
+			v.Field(i).Set(reflect.Zero(field.Type))
+		}
+	}
+
+	return u
+}
+
+// isVisibleTo returns true if the visible tag allows the viewer to see a field of the User
+func isVisibleTo(tag string, u User, viewer *User) bool {
+	if viewer == nil {
+		return false
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		switch rule = strings.TrimSpace(rule); rule {
+		case "-":
+			return false
+		case "self":
+			if viewer.ID == u.ID {
+				return true
+			}
+		default:
+			role, ok := roleByName(rule)
+			if ok && viewer.HasRole(role) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,72 @@
+package userlib
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUserRedact(t *testing.T) {
+	target := User{
+		ID:        1,
+		Email:     "user0@org.com",
+		Password:  "hashed_password",
+		Role:      RoleUser,
+		FirstName: "firstname0",
+	}
+
+	t.Run("redact for unauthenticated viewer", func(t *testing.T) {
+		redacted := target.Redact(nil)
+
+		assert.Equal(t, "", redacted.Password)
+		assert.Equal(t, "", redacted.Email)
+		assert.Equal(t, target.ID, redacted.ID)
+		assert.Equal(t, target.FirstName, redacted.FirstName)
+	})
+
+	t.Run("redact for the User itself", func(t *testing.T) {
+		redacted := target.Redact(&target)
+
+		assert.Equal(t, "", redacted.Password)
+		assert.Equal(t, target.Email, redacted.Email)
+	})
+
+	t.Run("redact for other User", func(t *testing.T) {
+		redacted := target.Redact(&User{ID: 2, Role: RoleUser})
+
+		assert.Equal(t, "", redacted.Password)
+		assert.Equal(t, "", redacted.Email)
+	})
+
+	t.Run("redact for Support", func(t *testing.T) {
+		redacted := target.Redact(&User{ID: 2, Role: RoleSupport})
+
+		assert.Equal(t, "", redacted.Password)
+		assert.Equal(t, target.Email, redacted.Email)
+	})
+
+	t.Run("redact for Admin", func(t *testing.T) {
+		redacted := target.Redact(&User{ID: 2, Role: RoleAdmin})
+
+		assert.Equal(t, "", redacted.Password)
+		assert.Equal(t, target.Email, redacted.Email)
+	})
+
+	t.Run("original User is not modified", func(t *testing.T) {
+		_ = target.Redact(nil)
+
+		assert.Equal(t, "hashed_password", target.Password)
+	})
+}
+
+func TestIsVisibleTo(t *testing.T) {
+	owner := User{ID: 1, Role: RoleUser}
+
+	assert.False(t, isVisibleTo("-", owner, &User{ID: 2, Role: RoleAdmin}))
+	assert.False(t, isVisibleTo("self", owner, &User{ID: 2, Role: RoleAdmin}))
+	assert.True(t, isVisibleTo("self", owner, &owner))
+	assert.True(t, isVisibleTo("admin", owner, &User{ID: 2, Role: RoleAdmin}))
+	assert.False(t, isVisibleTo("admin", owner, &User{ID: 2, Role: RoleSupport}))
+	assert.False(t, isVisibleTo("unknown", owner, &User{ID: 2, Role: RoleAdmin}))
+	assert.False(t, isVisibleTo("self", owner, nil))
+}
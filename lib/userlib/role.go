@@ -0,0 +1,108 @@
+package userlib
+
+import (
+	"fmt"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+)
+
+// Role defines the permissions of a User, it is stored in the database.
+// A higher Role includes all permissions of the lower Roles.
+type Role int
+
+// Role types.
+//
+// Do not change the values since they are stored in the database.
+// The gaps allow adding Roles in between later.
+const (
+	RoleUser    Role = 0   // default Role, manages only itself
+	RoleSupport Role = 50  // manages Users with a lower Role
+	RoleAdmin   Role = 100 // manages all Users
+)
+
+// String transforms Role type to text.
+func (r Role) String() string {
+	switch r {
+	case RoleUser:
+		return "user"
+	case RoleSupport:
+		return "support"
+	case RoleAdmin:
+		return "admin"
+	}
+	return fmt.Sprintf("unknown role %d", int(r))
+}
+
+// roleByName returns the Role with the given String value
+func roleByName(name string) (Role, bool) {
+	for _, role := range []Role{RoleUser, RoleSupport, RoleAdmin} {
+		if role.String() == name {
+			return role, true
+		}
+	}
+	return 0, false
+}
+
+// IsValid returns true if the Role is one of the defined Roles
+func (r Role) IsValid() bool {
+	switch r {
+	case RoleUser, RoleSupport, RoleAdmin:
+		return true
+	}
+	return false
+}
+
+// RequiresTOTP returns true if the Role may only be used with TOTP enabled,
+// Support and Admin manage other Users and need a second factor
+func (r Role) RequiresTOTP() bool {
+	return r >= RoleSupport
+}
+
+// HasRole returns true if the User has at least the given Role
+func (u User) HasRole(role Role) bool {
+	return u.Role >= role
+}
+
+// CanModify returns a Forbidden error if the User is not allowed to modify the target User.
+// Users may modify themselves, Support may modify Users with a lower Role
+// and Admins may modify all Users.
+func (u User) CanModify(target User) error {
+	switch {
+	case u.ID == target.ID:
+		return nil
+	case u.HasRole(RoleAdmin):
+		return nil
+	case u.HasRole(RoleSupport) && u.Role > target.Role:
+		return nil
+	}
+
+	err := fmt.Errorf("user %d with role %v may not modify user %d with role %v", u.ID, u.Role, target.ID, target.Role)
+	return errors.E(err, errors.Forbidden, "Insufficient role")
+}
+
+// SetRole updates the Role of the User in database and revokes all sessions of the User,
+// signed access tokens carry the Role and must not outlive it
+// Should not be called without prior role check!
+func (u *User) SetRole(role Role, db *storage.DB, cache *storage.Cache) error {
+	if !role.IsValid() {
+		return errors.E(fmt.Errorf("invalid role %d", int(role)), errors.Unprocessable, "Role is invalid")
+	}
+
+	var updatedUser User
+	sql := `UPDATE users SET role=$1 WHERE id=$2 RETURNING *`
+	err := db.Get(&updatedUser, sql, role, u.ID)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	*u = updatedUser
+
+	err = DeleteUserSessions(u.ID, cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	log.Infow("user role set", "userID", u.ID, "role", role)
+	return nil
+}
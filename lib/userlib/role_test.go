@@ -0,0 +1,112 @@
+package userlib
+
+import (
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserHasRole(t *testing.T) {
+	support := User{Role: RoleSupport}
+
+	assert.True(t, support.HasRole(RoleUser))
+	assert.True(t, support.HasRole(RoleSupport))
+	assert.False(t, support.HasRole(RoleAdmin))
+}
+
+func TestRoleRequiresTOTP(t *testing.T) {
+	assert.False(t, RoleUser.RequiresTOTP())
+	assert.True(t, RoleSupport.RequiresTOTP())
+	assert.True(t, RoleAdmin.RequiresTOTP())
+}
+
+func TestUserCanModify(t *testing.T) {
+	user0 := User{ID: 1, Role: RoleUser}
+	user1 := User{ID: 2, Role: RoleUser}
+	support0 := User{ID: 3, Role: RoleSupport}
+	support1 := User{ID: 4, Role: RoleSupport}
+	admin0 := User{ID: 5, Role: RoleAdmin}
+	admin1 := User{ID: 6, Role: RoleAdmin}
+
+	tests := []struct {
+		name    string
+		actor   User
+		target  User
+		allowed bool
+	}{
+		{"user modifies itself", user0, user0, true},
+		{"user modifies other user", user0, user1, false},
+		{"user modifies support", user0, support0, false},
+		{"support modifies user", support0, user0, true},
+		{"support modifies other support", support0, support1, false},
+		{"support modifies admin", support0, admin0, false},
+		{"admin modifies support", admin0, support0, true},
+		{"admin modifies other admin", admin0, admin1, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.actor.CanModify(tt.target)
+			if tt.allowed {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, errors.IsKind(errors.Forbidden, err))
+		})
+	}
+}
+
+func TestUserSetRole(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	validUser := User{
+		Email:     "user0@org.com",
+		Password:  "password",
+		FirstName: "firstname0",
+		LastName:  "lastname0",
+	}
+
+	t.Run("set valid Role", func(t *testing.T) {
+		user := validUser
+		err := user.Insert(db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, RoleUser, user.Role)
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		err = user.SetRole(RoleAdmin, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, RoleAdmin, user.Role)
+
+		// tokens of the old Role are revoked
+		_, err = SessionByToken(tokens.AccessToken, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		loadedUser, err := UserByID(user.ID, db)
+		require.NoError(t, err)
+		assert.Equal(t, RoleAdmin, loadedUser.Role)
+	})
+
+	t.Run("set invalid Role", func(t *testing.T) {
+		user := validUser
+		user.Email = "user1@org.com"
+		err := user.Insert(db, cache)
+		require.NoError(t, err)
+
+		err = user.SetRole(Role(1), db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("set valid Role with db == failingDB", func(t *testing.T) {
+		user := validUser
+		err := user.SetRole(RoleAdmin, failingDB, cache)
+		assert.Error(t, err)
+	})
+}
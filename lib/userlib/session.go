@@ -0,0 +1,368 @@
+package userlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+)
+
+// default token lifetimes if not configured
+const (
+	defaultAccessTokenTTL  = 15 * time.Minute
+	defaultRefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+// sessionTokenLength is the length of a generated session token
+const sessionTokenLength = 64
+
+// Session is stored in the cache for every issued access token
+type Session struct {
+	UserID    int
+	Role      Role
+	FamilyID  string
+	CreatedAt time.Time
+
+	user *User // set from the claims of signed access tokens, see ClaimsUser
+}
+
+// refreshSession is stored in the cache for every issued refresh token
+type refreshSession struct {
+	UserID   int
+	FamilyID string
+}
+
+// Tokens is a short-lived access token with the refresh token to renew it.
+// Every refresh token belongs to a family of tokens created by one login,
+// the family is revoked if an already used refresh token is presented again.
+type Tokens struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int // seconds until the access token expires
+}
+
+// AccessTokenTTL returns the configured lifetime of access tokens
+func AccessTokenTTL() time.Duration {
+	if cfg.Session.AccessTokenTTLSeconds <= 0 {
+		return defaultAccessTokenTTL
+	}
+	return time.Duration(cfg.Session.AccessTokenTTLSeconds) * time.Second
+}
+
+// RefreshTokenTTL returns the configured lifetime of refresh tokens
+func RefreshTokenTTL() time.Duration {
+	if cfg.Session.RefreshTokenTTLSeconds <= 0 {
+		return defaultRefreshTokenTTL
+	}
+	return time.Duration(cfg.Session.RefreshTokenTTLSeconds) * time.Second
+}
+
+// NewTokens creates access and refresh tokens for the given User starting a new token family.
+// Depending on the configured token mode the access token is opaque or signed, see SignedTokens.
+// Opaque tokens themselves are not stored, only their hashes are used as cache keys
+func NewTokens(user User, cache *storage.Cache) (Tokens, error) {
+	familyID := strutil.RandomSecure(sessionTokenLength, "")
+	return newFamilyTokens(user, familyID, cache)
+}
+
+// RefreshTokens rotates the refresh token and issues a new access token of the same family
+// returns Unauthorized if the refresh token is unknown or expired.
+// If the refresh token was already used the whole family is revoked.
+func RefreshTokens(refreshToken string, db *storage.DB, cache *storage.Cache) (Tokens, error) {
+	unauthorized := errors.E(fmt.Errorf("unknown refresh token"), errors.Unauthorized, "RefreshToken is invalid or expired")
+	if refreshToken == "" {
+		return Tokens{}, unauthorized
+	}
+
+	key := refreshKey(refreshToken)
+	value, err := cache.Get(key).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return Tokens{}, unauthorized
+		}
+		return Tokens{}, errors.E(err, errors.Internal)
+	}
+
+	var refresh refreshSession
+	err = json.Unmarshal(value, &refresh)
+	if err != nil {
+		return Tokens{}, errors.E(err, errors.Internal)
+	}
+
+	// mark the refresh token as used, atomically to detect concurrent reuse
+	firstUse, err := cache.SetNX(key+":used", time.Now().Unix(), RefreshTokenTTL()).Result()
+	if err != nil {
+		return Tokens{}, errors.E(err, errors.Internal)
+	}
+	if !firstUse {
+		log.Warnw("refresh token reused, revoking token family", "userID", refresh.UserID)
+		err = revokeFamily(refresh.FamilyID, cache)
+		if err != nil {
+			return Tokens{}, errors.E(err)
+		}
+		return Tokens{}, unauthorized
+	}
+
+	err = cache.SAdd(familyKeysKey(refresh.FamilyID), key+":used").Err()
+	if err != nil {
+		return Tokens{}, errors.E(err, errors.Internal)
+	}
+
+	// load the User again, the Role might have changed since the login
+	user, err := UserByID(refresh.UserID, db)
+	if err != nil {
+		if errors.IsKind(errors.NotFound, err) {
+			return Tokens{}, unauthorized
+		}
+		return Tokens{}, errors.E(err)
+	}
+
+	return newFamilyTokens(user, refresh.FamilyID, cache)
+}
+
+// newFamilyTokens creates access and refresh tokens of the given family
+// returns Forbidden if the User is not active
+func newFamilyTokens(user User, familyID string, cache *storage.Cache) (Tokens, error) {
+	err := user.CheckStatus()
+	if err != nil {
+		return Tokens{}, errors.E(err)
+	}
+
+	session := Session{
+		UserID:    user.ID,
+		Role:      user.Role,
+		FamilyID:  familyID,
+		CreatedAt: time.Now(),
+	}
+
+	tokens := Tokens{
+		RefreshToken: strutil.RandomSecure(sessionTokenLength, ""),
+		ExpiresIn:    int(AccessTokenTTL().Seconds()),
+	}
+
+	// signed access tokens are not stored, they are verified by their signature
+	var accessKey string
+	var sessionValue []byte
+	if SignedTokens() {
+		tokens.AccessToken, err = newSignedToken(session, user)
+		if err != nil {
+			return Tokens{}, errors.E(err)
+		}
+	} else {
+		tokens.AccessToken = strutil.RandomSecure(sessionTokenLength, "")
+		accessKey = sessionKey(tokens.AccessToken)
+		sessionValue, err = json.Marshal(session)
+		if err != nil {
+			return Tokens{}, errors.E(err, errors.Internal)
+		}
+	}
+
+	refresh, err := json.Marshal(refreshSession{
+		UserID:   user.ID,
+		FamilyID: familyID,
+	})
+	if err != nil {
+		return Tokens{}, errors.E(err, errors.Internal)
+	}
+
+	// store the tokens and add them to the indexes of the family and User
+	refreshKey := refreshKey(tokens.RefreshToken)
+	_, err = cache.TxPipelined(func(pipe redis.Pipeliner) error {
+		if accessKey != "" {
+			pipe.Set(accessKey, sessionValue, AccessTokenTTL())
+			pipe.SAdd(familyKeysKey(familyID), accessKey)
+		}
+		pipe.Set(refreshKey, refresh, RefreshTokenTTL())
+		pipe.SAdd(familyKeysKey(familyID), refreshKey)
+		pipe.Expire(familyKeysKey(familyID), RefreshTokenTTL())
+		pipe.SAdd(userSessionsKey(user.ID), familyKeysKey(familyID))
+		pipe.Expire(userSessionsKey(user.ID), RefreshTokenTTL())
+		return nil
+	})
+	if err != nil {
+		return Tokens{}, errors.E(err, errors.Internal)
+	}
+
+	return tokens, nil
+}
+
+// SessionByToken loads the Session of the given access token
+// returns Unauthorized if the token is unknown or expired
+func SessionByToken(token string, cache *storage.Cache) (Session, error) {
+	session := Session{}
+	if token == "" {
+		return session, errors.E(fmt.Errorf("empty session token"), errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	if SignedTokens() && isSignedToken(token) {
+		return sessionBySignedToken(token, cache)
+	}
+
+	value, err := cache.Get(sessionKey(token)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return session, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		return session, errors.E(err, errors.Internal)
+	}
+
+	err = json.Unmarshal(value, &session)
+	if err != nil {
+		return session, errors.E(err, errors.Internal)
+	}
+
+	return session, nil
+}
+
+// DeleteSession revokes the given access token together with its token family
+// returns Unauthorized if the token is unknown or expired
+func DeleteSession(token string, cache *storage.Cache) error {
+	session, err := SessionByToken(token, cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	err = revokeFamily(session.FamilyID, cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	err = cache.SRem(userSessionsKey(session.UserID), familyKeysKey(session.FamilyID)).Err()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	return nil
+}
+
+// DeleteUserSessions revokes all token families of the given User ID
+func DeleteUserSessions(userID int, cache *storage.Cache) error {
+	indexKey := userSessionsKey(userID)
+	familyKeys, err := cache.SMembers(indexKey).Result()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	keys := []string{indexKey}
+	for _, familyKey := range familyKeys {
+		members, err := cache.SMembers(familyKey).Result()
+		if err != nil {
+			return errors.E(err, errors.Internal)
+		}
+		keys = append(keys, familyKey)
+		keys = append(keys, members...)
+	}
+
+	_, err = cache.TxPipelined(func(pipe redis.Pipeliner) error {
+		if SignedTokens() {
+			for _, familyKey := range familyKeys {
+				pipe.Set(familyRevokedKey(familyKey), 1, AccessTokenTTL())
+			}
+		}
+		pipe.Del(keys...)
+		return nil
+	})
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	log.Infow("revoked all sessions", "userID", userID, "sessions", len(familyKeys))
+	return nil
+}
+
+// revokeFamily deletes all tokens of a token family,
+// signed access tokens of the family are denied until they expire
+func revokeFamily(familyID string, cache *storage.Cache) error {
+	familyKey := familyKeysKey(familyID)
+	keys, err := cache.SMembers(familyKey).Result()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	_, err = cache.TxPipelined(func(pipe redis.Pipeliner) error {
+		if SignedTokens() {
+			pipe.Set(familyRevokedKey(familyKey), 1, AccessTokenTTL())
+		}
+		pipe.Del(append(keys, familyKey)...)
+		return nil
+	})
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	return nil
+}
+
+// sessionKey returns the cache key of an access token
+func sessionKey(token string) string {
+	return fmt.Sprintf("%s:session:%s", cachePrefix, strutil.Hash(token, "session"))
+}
+
+// refreshKey returns the cache key of a refresh token
+func refreshKey(token string) string {
+	return fmt.Sprintf("%s:refresh:%s", cachePrefix, strutil.Hash(token, "refresh"))
+}
+
+// familyKeysKey returns the cache key of the set of token keys of a token family
+func familyKeysKey(familyID string) string {
+	return fmt.Sprintf("%s:token_family:%s", cachePrefix, strutil.Hash(familyID, "family"))
+}
+
+// familyRevokedKey returns the cache key of the denylist entry of a token family
+func familyRevokedKey(familyKey string) string {
+	return familyKey + ":revoked"
+}
+
+// userSessionsKey returns the cache key of the set of token family keys of a User
+func userSessionsKey(userID int) string {
+	return fmt.Sprintf("%s:user_sessions:%d", cachePrefix, userID)
+}
+
+// dummyPassword is compared against if no User exists for an email
+// so that both failure cases take the same amount of time
+var dummyPassword struct {
+	once sync.Once
+	hash string
+}
+
+// UserByCredentials loads the User with given email and checks the password
+// returns the same Unauthorized error if the email is unknown or the password is incorrect
+func UserByCredentials(email, password string, db *storage.DB) (User, error) {
+	user, err := UserByEmail(email, db)
+	if err != nil {
+		if !errors.IsKind(errors.NotFound, err) {
+			return user, errors.E(err)
+		}
+
+		dummyPassword.once.Do(func() {
+			dummyPassword.hash, _ = CurrentPasswordHasher().Hash("dummy password")
+		})
+		_ = verifyPassword(dummyPassword.hash, password)
+
+		return User{}, errors.E(err, errors.Unauthorized, "Email or password is incorrect")
+	}
+
+	// do not wrap the IsCorrectPassword error, its message would reveal that the email exists
+	if user.IsCorrectPassword(password) != nil {
+		err := fmt.Errorf("incorrect password for user %d", user.ID)
+		return User{}, errors.E(err, errors.Unauthorized, "Email or password is incorrect")
+	}
+
+	// the password is only known here, so outdated hashes are upgraded on login
+	hasher := CurrentPasswordHasher()
+	if !hasher.IsCurrent(user.Password) {
+		err := user.rehashPassword(password, hasher, db)
+		if err != nil {
+			// the login succeeds anyway, the hash is upgraded on the next one
+			log.Errorw("error rehashing password", "userID", user.ID, "error", err)
+		}
+	}
+
+	return user, nil
+}
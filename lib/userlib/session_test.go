@@ -0,0 +1,290 @@
+package userlib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewTokens(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	t.Run("create valid Tokens", func(t *testing.T) {
+		tokens, err := NewTokens(User{ID: 1}, cache)
+		require.NoError(t, err)
+		assert.Len(t, tokens.AccessToken, sessionTokenLength)
+		assert.Len(t, tokens.RefreshToken, sessionTokenLength)
+		assert.Equal(t, int(AccessTokenTTL().Seconds()), tokens.ExpiresIn)
+
+		session, err := SessionByToken(tokens.AccessToken, cache)
+		require.NoError(t, err)
+		assert.Equal(t, 1, session.UserID)
+		assert.NotEmpty(t, session.FamilyID)
+		assert.WithinDuration(t, time.Now(), session.CreatedAt, 100*time.Millisecond)
+		_, ok := session.ClaimsUser()
+		assert.False(t, ok)
+
+		ttl, err := cache.TTL(sessionKey(tokens.AccessToken)).Result()
+		require.NoError(t, err)
+		assert.InDelta(t, AccessTokenTTL().Seconds(), ttl.Seconds(), 5)
+
+		ttl, err = cache.TTL(refreshKey(tokens.RefreshToken)).Result()
+		require.NoError(t, err)
+		assert.InDelta(t, RefreshTokenTTL().Seconds(), ttl.Seconds(), 5)
+	})
+
+	t.Run("tokens are unique", func(t *testing.T) {
+		tokens0, err := NewTokens(User{ID: 1}, cache)
+		require.NoError(t, err)
+		tokens1, err := NewTokens(User{ID: 1}, cache)
+		require.NoError(t, err)
+
+		assert.NotEqual(t, tokens0.AccessToken, tokens1.AccessToken)
+		assert.NotEqual(t, tokens0.RefreshToken, tokens1.RefreshToken)
+		assert.NotEqual(t, tokens0.AccessToken, tokens0.RefreshToken)
+	})
+
+	t.Run("tokens are not stored as plain text", func(t *testing.T) {
+		tokens, err := NewTokens(User{ID: 1}, cache)
+		require.NoError(t, err)
+
+		keys, err := cache.Keys("*" + tokens.AccessToken + "*").Result()
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+		keys, err = cache.Keys("*" + tokens.RefreshToken + "*").Result()
+		require.NoError(t, err)
+		assert.Empty(t, keys)
+	})
+}
+
+func TestRefreshTokens(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{
+		Email:    "user_refresh0@org.com",
+		Password: "password",
+		Role:     RoleSupport,
+	}
+	err := user.Insert(db, cache)
+	require.NoError(t, err)
+
+	t.Run("refresh valid Tokens", func(t *testing.T) {
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		refreshed, err := RefreshTokens(tokens.RefreshToken, db, cache)
+		require.NoError(t, err)
+		assert.NotEqual(t, tokens.AccessToken, refreshed.AccessToken)
+		assert.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+		// the new tokens belong to the same family
+		session, err := SessionByToken(tokens.AccessToken, cache)
+		require.NoError(t, err)
+		refreshedSession, err := SessionByToken(refreshed.AccessToken, cache)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, refreshedSession.UserID)
+		assert.Equal(t, RoleSupport, refreshedSession.Role)
+		assert.Equal(t, session.FamilyID, refreshedSession.FamilyID)
+
+		// the rotated refresh token can be used again
+		_, err = RefreshTokens(refreshed.RefreshToken, db, cache)
+		require.NoError(t, err)
+	})
+
+	t.Run("reuse of refresh token revokes the family", func(t *testing.T) {
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+		otherTokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		refreshed, err := RefreshTokens(tokens.RefreshToken, db, cache)
+		require.NoError(t, err)
+
+		_, err = RefreshTokens(tokens.RefreshToken, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		// all tokens of the family are revoked
+		_, err = SessionByToken(tokens.AccessToken, cache)
+		assert.Error(t, err)
+		_, err = SessionByToken(refreshed.AccessToken, cache)
+		assert.Error(t, err)
+		_, err = RefreshTokens(refreshed.RefreshToken, db, cache)
+		assert.Error(t, err)
+
+		// other families are still valid
+		_, err = SessionByToken(otherTokens.AccessToken, cache)
+		assert.NoError(t, err)
+	})
+
+	t.Run("refresh invalid Tokens with access token", func(t *testing.T) {
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		_, err = RefreshTokens(tokens.AccessToken, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("refresh invalid Tokens of deleted User", func(t *testing.T) {
+		deletedUser := User{Email: "user_refresh1@org.com", Password: "password"}
+		err := deletedUser.Insert(db, cache)
+		require.NoError(t, err)
+		tokens, err := NewTokens(deletedUser, cache)
+		require.NoError(t, err)
+		err = deletedUser.Delete(db, cache)
+		require.NoError(t, err)
+
+		_, err = RefreshTokens(tokens.RefreshToken, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("refresh invalid Tokens with unknown or empty token", func(t *testing.T) {
+		_, err := RefreshTokens("unknown", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+		_, err = RefreshTokens("", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
+
+func TestSessionByToken(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, cache.Reset())
+	})
+
+	t.Run("get invalid Session with unknown token", func(t *testing.T) {
+		_, err := SessionByToken("unknown", cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("get invalid Session with empty token", func(t *testing.T) {
+		_, err := SessionByToken("", cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
+
+func TestUserByCredentials(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	insertedUser := User{
+		Email:     "user0@org.com",
+		Password:  "password",
+		FirstName: "firstname0",
+		LastName:  "lastname0",
+	}
+	err := insertedUser.Insert(db, cache)
+	require.NoError(t, err)
+
+	t.Run("get valid User with correct credentials", func(t *testing.T) {
+		user, err := UserByCredentials("user0@org.com", "password", db)
+		require.NoError(t, err)
+		assert.Equal(t, insertedUser.ID, user.ID)
+	})
+
+	t.Run("get invalid User with incorrect password", func(t *testing.T) {
+		_, err := UserByCredentials("user0@org.com", "incorrect_password", db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("get invalid User with unknown email", func(t *testing.T) {
+		_, err := UserByCredentials("unknown@org.com", "password", db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("both failures return the same message", func(t *testing.T) {
+		_, errPassword := UserByCredentials("user0@org.com", "incorrect_password", db)
+		_, errEmail := UserByCredentials("unknown@org.com", "password", db)
+
+		var appErrPassword, appErrEmail *errors.Error
+		require.True(t, errors.As(errPassword, &appErrPassword))
+		require.True(t, errors.As(errEmail, &appErrEmail))
+		assert.Equal(t, errors.ToHTTPResponse(appErrEmail), errors.ToHTTPResponse(appErrPassword))
+	})
+
+	t.Run("fail to get User with db == failingDB", func(t *testing.T) {
+		_, err := UserByCredentials("user0@org.com", "password", failingDB)
+		require.Error(t, err)
+		assert.False(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
+
+func TestDeleteSession(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, cache.Reset())
+	})
+
+	t.Run("delete valid Session", func(t *testing.T) {
+		tokens, err := NewTokens(User{ID: 1}, cache)
+		require.NoError(t, err)
+		session, err := SessionByToken(tokens.AccessToken, cache)
+		require.NoError(t, err)
+
+		err = DeleteSession(tokens.AccessToken, cache)
+		require.NoError(t, err)
+
+		_, err = SessionByToken(tokens.AccessToken, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		// the refresh token of the session is revoked too
+		_, err = RefreshTokens(tokens.RefreshToken, db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		isMember, err := cache.SIsMember(userSessionsKey(1), familyKeysKey(session.FamilyID)).Result()
+		require.NoError(t, err)
+		assert.False(t, isMember)
+	})
+
+	t.Run("delete invalid Session with unknown token", func(t *testing.T) {
+		err := DeleteSession("unknown", cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
+
+func TestDeleteUserSessions(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, cache.Reset())
+	})
+
+	tokens0, err := NewTokens(User{ID: 1}, cache)
+	require.NoError(t, err)
+	tokens1, err := NewTokens(User{ID: 1}, cache)
+	require.NoError(t, err)
+	otherTokens, err := NewTokens(User{ID: 2}, cache)
+	require.NoError(t, err)
+
+	err = DeleteUserSessions(1, cache)
+	require.NoError(t, err)
+
+	_, err = SessionByToken(tokens0.AccessToken, cache)
+	assert.Error(t, err)
+	_, err = SessionByToken(tokens1.AccessToken, cache)
+	assert.Error(t, err)
+	_, err = RefreshTokens(tokens1.RefreshToken, db, cache)
+	assert.Error(t, err)
+
+	_, err = SessionByToken(otherTokens.AccessToken, cache)
+	assert.NoError(t, err)
+
+	t.Run("delete sessions of User without sessions", func(t *testing.T) {
+		err := DeleteUserSessions(3, cache)
+		assert.NoError(t, err)
+	})
+}
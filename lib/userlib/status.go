@@ -0,0 +1,128 @@
+package userlib
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+)
+
+// Status defines if a User may use the account, it is stored in the database.
+// Only active Users may log in and use their tokens.
+type Status int
+
+// Status types.
+//
+// Do not change the values since they are stored in the database.
+const (
+	StatusActive    Status = 0 // default Status
+	StatusPending   Status = 1 // not activated yet
+	StatusSuspended Status = 2 // blocked until reactivated or until StatusUntil
+	StatusBanned    Status = 3 // blocked permanently
+)
+
+// maxStatusReasonLength is the maximum length of the reason of a Status change
+const maxStatusReasonLength = 500
+
+// String transforms Status type to text.
+func (s Status) String() string {
+	switch s {
+	case StatusActive:
+		return "active"
+	case StatusPending:
+		return "pending"
+	case StatusSuspended:
+		return "suspended"
+	case StatusBanned:
+		return "banned"
+	}
+	return fmt.Sprintf("unknown status %d", int(s))
+}
+
+// IsValid returns true if the Status is one of the defined Statuses
+func (s Status) IsValid() bool {
+	switch s {
+	case StatusActive, StatusPending, StatusSuspended, StatusBanned:
+		return true
+	}
+	return false
+}
+
+// CurrentStatus returns the Status of the User, suspensions end automatically at StatusUntil
+func (u User) CurrentStatus() Status {
+	if u.Status == StatusSuspended && u.StatusUntil != nil && !time.Now().Before(*u.StatusUntil) {
+		return StatusActive
+	}
+	return u.Status
+}
+
+// CheckStatus returns a Forbidden error describing the Status if the User is not active
+func (u User) CheckStatus() error {
+	status := u.CurrentStatus()
+	err := fmt.Errorf("user %d is %v", u.ID, status)
+
+	switch status {
+	case StatusActive:
+		return nil
+	case StatusPending:
+		return errors.E(err, errors.Forbidden, "Account is not activated yet")
+	case StatusSuspended:
+		if u.StatusUntil != nil {
+			msg := fmt.Sprintf("Account is suspended until %s", u.StatusUntil.UTC().Format(time.RFC3339))
+			return errors.E(err, errors.Forbidden, msg)
+		}
+		return errors.E(err, errors.Forbidden, "Account is suspended")
+	case StatusBanned:
+		return errors.E(err, errors.Forbidden, "Account is banned")
+	}
+	return errors.E(err, errors.Forbidden, "Account is not active")
+}
+
+// SetStatus updates the Status of the User in database with the reason of the change,
+// until optionally ends a suspension automatically. Reason and until are cleared for active Users.
+// Revokes all sessions of the User if the User is not active anymore
+// Should not be called without prior role check!
+func (u *User) SetStatus(status Status, reason string, until *time.Time, db *storage.DB, cache *storage.Cache) error {
+	if !status.IsValid() {
+		return errors.E(fmt.Errorf("invalid status %d", int(status)), errors.Unprocessable, "Status is invalid")
+	}
+	if utf8.RuneCountInString(reason) > maxStatusReasonLength {
+		err := fmt.Errorf("status reason of %d characters", utf8.RuneCountInString(reason))
+		return errors.E(err, errors.Unprocessable, fmt.Sprintf("Reason must be at most %d characters long", maxStatusReasonLength))
+	}
+	if until != nil {
+		if status != StatusSuspended {
+			err := fmt.Errorf("until set for status %v", status)
+			return errors.E(err, errors.Unprocessable, "Until is only allowed for suspensions")
+		}
+		if !until.After(time.Now()) {
+			err := fmt.Errorf("until %v is not in the future", until)
+			return errors.E(err, errors.Unprocessable, "Until must be in the future")
+		}
+	}
+	if status == StatusActive {
+		reason, until = "", nil
+	}
+
+	var updatedUser User
+	sql := `UPDATE users SET status=$1, status_reason=$2, status_until=$3 WHERE id=$4 RETURNING *`
+	err := db.Get(&updatedUser, sql, status, reason, until, u.ID)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	*u = updatedUser
+
+	// blocked Users are signed out everywhere
+	if status != StatusActive {
+		err = DeleteUserSessions(u.ID, cache)
+		if err != nil {
+			return errors.E(err)
+		}
+	}
+
+	log.Infow("user status set", "userID", u.ID, "status", status)
+	return nil
+}
@@ -0,0 +1,119 @@
+package userlib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserCheckStatus(t *testing.T) {
+	past := time.Now().Add(-time.Minute)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name   string
+		user   User
+		status Status
+		msg    string
+	}{
+		{"active", User{Status: StatusActive}, StatusActive, ""},
+		{"pending", User{Status: StatusPending}, StatusPending, "Account is not activated yet"},
+		{"suspended", User{Status: StatusSuspended}, StatusSuspended, "Account is suspended"},
+		{"suspended until", User{Status: StatusSuspended, StatusUntil: &future}, StatusSuspended, "Account is suspended until"},
+		{"suspension expired", User{Status: StatusSuspended, StatusUntil: &past}, StatusActive, ""},
+		{"banned", User{Status: StatusBanned}, StatusBanned, "Account is banned"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.status, tt.user.CurrentStatus())
+
+			err := tt.user.CheckStatus()
+			if tt.msg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.True(t, errors.IsKind(errors.Forbidden, err))
+
+			var appErr *errors.Error
+			require.True(t, errors.As(err, &appErr))
+			assert.Contains(t, errors.ToHTTPResponse(appErr), tt.msg)
+		})
+	}
+}
+
+func TestUserSetStatus(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	validUser := User{
+		Email:     "user0@org.com",
+		Password:  "password",
+		FirstName: "firstname0",
+		LastName:  "lastname0",
+	}
+
+	t.Run("suspend User revokes sessions", func(t *testing.T) {
+		user := validUser
+		require.NoError(t, user.Insert(db, cache))
+		assert.Equal(t, StatusActive, user.Status)
+
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		until := time.Now().Add(time.Hour)
+		err = user.SetStatus(StatusSuspended, "spam", &until, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, StatusSuspended, user.Status)
+		assert.Equal(t, "spam", user.StatusReason)
+		require.NotNil(t, user.StatusUntil)
+
+		_, err = SessionByToken(tokens.AccessToken, cache)
+		assert.Error(t, err)
+		_, err = RefreshTokens(tokens.RefreshToken, db, cache)
+		assert.Error(t, err)
+
+		// no new sessions or login challenges
+		_, err = NewTokens(user, cache)
+		assert.True(t, errors.IsKind(errors.Forbidden, err))
+		_, err = NewLoginChallenge(user, cache)
+		assert.True(t, errors.IsKind(errors.Forbidden, err))
+
+		// reactivation clears reason and expiry
+		err = user.SetStatus(StatusActive, "ignored", nil, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, StatusActive, user.Status)
+		assert.Empty(t, user.StatusReason)
+		assert.Nil(t, user.StatusUntil)
+
+		_, err = NewTokens(user, cache)
+		assert.NoError(t, err)
+	})
+
+	t.Run("set invalid Status", func(t *testing.T) {
+		user := validUser
+		user.Email = "user1@org.com"
+		require.NoError(t, user.Insert(db, cache))
+
+		past := time.Now().Add(-time.Hour)
+		future := time.Now().Add(time.Hour)
+
+		err := user.SetStatus(Status(42), "", nil, db, cache)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+		err = user.SetStatus(StatusSuspended, "", &past, db, cache)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+		err = user.SetStatus(StatusBanned, "", &future, db, cache)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("set valid Status with db == failingDB", func(t *testing.T) {
+		user := validUser
+		err := user.SetStatus(StatusBanned, "", nil, failingDB, cache)
+		assert.Error(t, err)
+	})
+}
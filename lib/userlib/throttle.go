@@ -0,0 +1,244 @@
+package userlib
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+)
+
+// default login throttle if not configured
+const (
+	defaultLoginMaxFailures    = 10
+	defaultLoginIPMaxFailures  = 100
+	defaultLoginBackoffBase    = time.Second
+	defaultLoginBackoffMax     = time.Minute
+	defaultLoginLockout        = 15 * time.Minute
+	defaultLoginThrottleWindow = time.Hour
+)
+
+// ThrottledError is returned if logins are blocked after too many failures
+type ThrottledError struct {
+	Wait time.Duration
+}
+
+// Error describes the block
+func (e *ThrottledError) Error() string {
+	return fmt.Sprintf("too many failed logins, retry after %v", e.Wait)
+}
+
+// RetryAfter returns the time until logins are allowed again
+func (e *ThrottledError) RetryAfter() time.Duration {
+	return e.Wait
+}
+
+// LoginAllowed returns a ThrottledError if logins for the email or from the IP are blocked
+func LoginAllowed(email, ip string, cache *storage.Cache) error {
+	var emailTTL, ipTTL *redis.DurationCmd
+	_, err := cache.Pipelined(func(pipe redis.Pipeliner) error {
+		emailTTL = pipe.PTTL(loginBlockedKey("email", NormalizeEmail(email)))
+		ipTTL = pipe.PTTL(loginBlockedKey("ip", ip))
+		return nil
+	})
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	wait := emailTTL.Val()
+	if ipTTL.Val() > wait {
+		wait = ipTTL.Val()
+	}
+
+	// a negative TTL means the key does not exist
+	if wait > 0 {
+		return errors.E(&ThrottledError{Wait: wait}, "Too many failed login attempts")
+	}
+
+	return nil
+}
+
+// RegisterLoginFailure counts a failed login for the email and IP
+// and blocks further logins with exponential backoff or a lockout
+func RegisterLoginFailure(email, ip string, cache *storage.Cache) error {
+	email = NormalizeEmail(email)
+
+	emailFailures, err := countLoginFailure("email", email, cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	ipFailures, err := countLoginFailure("ip", ip, cache)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	// block the email with exponential backoff, lock the account at MaxFailures
+	var emailBlock time.Duration
+	switch {
+	case emailFailures >= loginMaxFailures():
+		emailBlock = loginLockout()
+		log.Warnw("locked login after too many failures", "failures", emailFailures)
+	case emailFailures > cfg.LoginThrottle.FreeFailures:
+		emailBlock = loginBackoff(emailFailures - cfg.LoginThrottle.FreeFailures)
+	}
+
+	if emailBlock > 0 {
+		err = cache.Set(loginBlockedKey("email", email), emailFailures, emailBlock).Err()
+		if err != nil {
+			return errors.E(err, errors.Internal)
+		}
+	}
+
+	// lock the IP at IPMaxFailures, many different emails are tried from it
+	if ipFailures >= loginIPMaxFailures() {
+		err = cache.Set(loginBlockedKey("ip", ip), ipFailures, loginLockout()).Err()
+		if err != nil {
+			return errors.E(err, errors.Internal)
+		}
+		log.Warnw("locked login for ip after too many failures", "ip", ip, "failures", ipFailures)
+	}
+
+	return nil
+}
+
+// ResetLoginFailures forgets the failed logins of the email after a successful login
+func ResetLoginFailures(email string, cache *storage.Cache) error {
+	email = NormalizeEmail(email)
+	err := cache.Del(loginFailuresKey("email", email), loginBlockedKey("email", email)).Err()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	return nil
+}
+
+// countLoginFailure increments the failure counter and returns the new count
+func countLoginFailure(kind, value string, cache *storage.Cache) (int, error) {
+	var incr *redis.IntCmd
+	_, err := cache.TxPipelined(func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(loginFailuresKey(kind, value))
+		pipe.Expire(loginFailuresKey(kind, value), loginThrottleWindow())
+		return nil
+	})
+	if err != nil {
+		return 0, errors.E(err, errors.Internal)
+	}
+
+	return int(incr.Val()), nil
+}
+
+// countMailRequest counts a request of an email of the kind, e.g. a magic link, sent to the address
+// returns a ThrottledError with msg if the address exceeded maxRequests within the window
+func countMailRequest(kind, email string, maxRequests int, window time.Duration, msg string, cache *storage.Cache) error {
+	// the window starts with the first request, further requests don't extend it
+	key := mailRequestsKey(kind, email)
+	var incr *redis.IntCmd
+	var ttl *redis.DurationCmd
+	_, err := cache.TxPipelined(func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(key)
+		ttl = pipe.PTTL(key)
+		return nil
+	})
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	// a negative TTL means the counter has no expiry yet
+	wait := ttl.Val()
+	if wait < 0 {
+		wait = window
+		err = cache.Expire(key, window).Err()
+		if err != nil {
+			return errors.E(err, errors.Internal)
+		}
+	}
+
+	if int(incr.Val()) > maxRequests {
+		log.Warnw("too many mail requests", "kind", kind, "requests", incr.Val())
+		return errors.E(&ThrottledError{Wait: wait}, msg)
+	}
+
+	return nil
+}
+
+// loginBackoff returns the delay after the nth throttled failure, starting at 1
+func loginBackoff(n int) time.Duration {
+	backoff := loginBackoffBase()
+	max := loginBackoffMax()
+
+	for i := 1; i < n && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+
+	return backoff
+}
+
+// loginMaxFailures returns the configured failures per email until the account is locked
+func loginMaxFailures() int {
+	if cfg.LoginThrottle.MaxFailures <= 0 {
+		return defaultLoginMaxFailures
+	}
+	return cfg.LoginThrottle.MaxFailures
+}
+
+// loginIPMaxFailures returns the configured failures per IP until the IP is locked
+func loginIPMaxFailures() int {
+	if cfg.LoginThrottle.IPMaxFailures <= 0 {
+		return defaultLoginIPMaxFailures
+	}
+	return cfg.LoginThrottle.IPMaxFailures
+}
+
+// loginBackoffBase returns the configured delay after the first throttled failure
+func loginBackoffBase() time.Duration {
+	if cfg.LoginThrottle.BackoffBaseSeconds <= 0 {
+		return defaultLoginBackoffBase
+	}
+	return time.Duration(cfg.LoginThrottle.BackoffBaseSeconds) * time.Second
+}
+
+// loginBackoffMax returns the configured maximum delay of the backoff
+func loginBackoffMax() time.Duration {
+	if cfg.LoginThrottle.BackoffMaxSeconds <= 0 {
+		return defaultLoginBackoffMax
+	}
+	return time.Duration(cfg.LoginThrottle.BackoffMaxSeconds) * time.Second
+}
+
+// loginLockout returns the configured duration of a lockout
+func loginLockout() time.Duration {
+	if cfg.LoginThrottle.LockoutSeconds <= 0 {
+		return defaultLoginLockout
+	}
+	return time.Duration(cfg.LoginThrottle.LockoutSeconds) * time.Second
+}
+
+// loginThrottleWindow returns the configured time after which failures are forgotten
+func loginThrottleWindow() time.Duration {
+	if cfg.LoginThrottle.WindowSeconds <= 0 {
+		return defaultLoginThrottleWindow
+	}
+	return time.Duration(cfg.LoginThrottle.WindowSeconds) * time.Second
+}
+
+// loginFailuresKey returns the cache key of the failure counter
+func loginFailuresKey(kind, value string) string {
+	return fmt.Sprintf("%s:login_failures:%s:%s", cachePrefix, kind, strutil.Hash(value, "login"))
+}
+
+// mailRequestsKey returns the cache key of the request counter of an email of the kind
+func mailRequestsKey(kind, email string) string {
+	return fmt.Sprintf("%s:%s_requests:%s", cachePrefix, kind, strutil.Hash(email, kind))
+}
+
+// loginBlockedKey returns the cache key of a login block
+func loginBlockedKey(kind, value string) string {
+	return fmt.Sprintf("%s:login_blocked:%s:%s", cachePrefix, kind, strutil.Hash(value, "login"))
+}
@@ -0,0 +1,123 @@
+package userlib
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/config"
+)
+
+// mustThrottledError returns the ThrottledError of err
+func mustThrottledError(t *testing.T, err error) *ThrottledError {
+	require.Error(t, err)
+
+	var throttled *ThrottledError
+	require.True(t, errors.As(err, &throttled))
+	return throttled
+}
+
+func TestLoginThrottle(t *testing.T) {
+	defaultThrottle := cfg.LoginThrottle
+	t.Cleanup(func() {
+		cfg.LoginThrottle = defaultThrottle
+		assert.NoError(t, cache.Reset())
+	})
+
+	cfg.LoginThrottle = config.LoginThrottle{
+		FreeFailures:       2,
+		BackoffBaseSeconds: 10,
+		BackoffMaxSeconds:  30,
+		MaxFailures:        6,
+		IPMaxFailures:      10,
+		LockoutSeconds:     600,
+		WindowSeconds:      3600,
+	}
+
+	t.Run("free failures are not throttled", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			require.NoError(t, RegisterLoginFailure("free@org.com", "10.0.0.1", cache))
+		}
+		assert.NoError(t, LoginAllowed("free@org.com", "10.0.0.1", cache))
+	})
+
+	t.Run("failures beyond free failures are throttled with exponential backoff", func(t *testing.T) {
+		expectedWaits := []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second}
+
+		for i := 0; i < 2; i++ {
+			require.NoError(t, RegisterLoginFailure("backoff@org.com", "10.0.0.2", cache))
+		}
+		for _, expectedWait := range expectedWaits {
+			require.NoError(t, RegisterLoginFailure("backoff@org.com", "10.0.0.2", cache))
+
+			throttled := mustThrottledError(t, LoginAllowed("backoff@org.com", "10.0.0.2", cache))
+			assert.InDelta(t, expectedWait.Seconds(), throttled.RetryAfter().Seconds(), 1)
+		}
+	})
+
+	t.Run("account is locked after max failures", func(t *testing.T) {
+		for i := 0; i < 6; i++ {
+			require.NoError(t, RegisterLoginFailure("locked@org.com", "10.0.0.3", cache))
+		}
+
+		// the email is locked from every IP, also in other case
+		throttled := mustThrottledError(t, LoginAllowed("Locked@org.com", "10.0.0.4", cache))
+		assert.InDelta(t, 600, throttled.RetryAfter().Seconds(), 1)
+	})
+
+	t.Run("IP is locked after IP max failures", func(t *testing.T) {
+		for i := 0; i < 10; i++ {
+			require.NoError(t, RegisterLoginFailure(fmt.Sprintf("ip%d@org.com", i), "10.0.0.5", cache))
+		}
+
+		throttled := mustThrottledError(t, LoginAllowed("other@org.com", "10.0.0.5", cache))
+		assert.InDelta(t, 600, throttled.RetryAfter().Seconds(), 1)
+
+		assert.NoError(t, LoginAllowed("other@org.com", "10.0.0.6", cache))
+	})
+
+	t.Run("reset failures after successful login", func(t *testing.T) {
+		for i := 0; i < 3; i++ {
+			require.NoError(t, RegisterLoginFailure("reset@org.com", "10.0.0.7", cache))
+		}
+		require.Error(t, LoginAllowed("reset@org.com", "10.0.0.7", cache))
+
+		require.NoError(t, ResetLoginFailures("reset@org.com", cache))
+		assert.NoError(t, LoginAllowed("reset@org.com", "10.0.0.7", cache))
+
+		// the counter starts from zero again
+		require.NoError(t, RegisterLoginFailure("reset@org.com", "10.0.0.7", cache))
+		assert.NoError(t, LoginAllowed("reset@org.com", "10.0.0.7", cache))
+	})
+
+	t.Run("empty config uses the defaults", func(t *testing.T) {
+		cfg.LoginThrottle = config.LoginThrottle{}
+		defer func() { cfg.LoginThrottle = defaultThrottle }()
+
+		// failures are counted and expire after the default window
+		require.NoError(t, RegisterLoginFailure("empty@org.com", "10.0.0.8", cache))
+		ttl, err := cache.TTL(loginFailuresKey("email", "empty@org.com")).Result()
+		require.NoError(t, err)
+		assert.InDelta(t, defaultLoginThrottleWindow.Seconds(), ttl.Seconds(), 1)
+
+		// every failure is throttled, the block expires
+		throttled := mustThrottledError(t, LoginAllowed("empty@org.com", "10.0.0.8", cache))
+		assert.InDelta(t, defaultLoginBackoffBase.Seconds(), throttled.RetryAfter().Seconds(), 1)
+
+		// the account is locked for the default lockout
+		for i := 1; i < defaultLoginMaxFailures; i++ {
+			require.NoError(t, RegisterLoginFailure("empty@org.com", "10.0.0.8", cache))
+		}
+		throttled = mustThrottledError(t, LoginAllowed("empty@org.com", "10.0.0.8", cache))
+		assert.InDelta(t, defaultLoginLockout.Seconds(), throttled.RetryAfter().Seconds(), 1)
+
+		// the IP is not locked before the default IP max failures
+		ttl, err = cache.PTTL(loginBlockedKey("ip", "10.0.0.8")).Result()
+		require.NoError(t, err)
+		assert.True(t, ttl < 0)
+	})
+}
@@ -0,0 +1,151 @@
+package userlib
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/pkg/jwtutil"
+)
+
+// token modes selectable in the session config
+const (
+	TokenModeOpaque = "opaque" // random access tokens stored in the cache
+	TokenModeSigned = "signed" // HS256 JWT access tokens verified by their signature
+)
+
+// accessClaims are the claims of a signed access token,
+// they carry the User so the token can be used without loading the User from the database
+type accessClaims struct {
+	jwtutil.Claims
+	Role          Role   `json:"role"`
+	Status        Status `json:"status"`
+	EmailVerified bool   `json:"email_verified"`
+	TOTPEnabled   bool   `json:"totp_enabled"`
+	FamilyID      string `json:"fid"`
+}
+
+// SignedTokens returns true if access tokens are issued as signed JWTs
+func SignedTokens() bool {
+	return cfg.Session.TokenMode == TokenModeSigned
+}
+
+// newSignedToken returns a signed access token for the Session of the User
+func newSignedToken(session Session, user User) (string, error) {
+	keyring, err := tokenKeyring()
+	if err != nil {
+		return "", errors.E(err)
+	}
+
+	claims := accessClaims{
+		Claims: jwtutil.Claims{
+			Subject:   strconv.Itoa(session.UserID),
+			ID:        strutil.RandomSecure(32, ""),
+			IssuedAt:  session.CreatedAt.Unix(),
+			ExpiresAt: session.CreatedAt.Add(AccessTokenTTL()).Unix(),
+		},
+		Role:          user.Role,
+		Status:        user.Status,
+		EmailVerified: user.EmailVerified,
+		TOTPEnabled:   user.TOTPEnabled,
+		FamilyID:      session.FamilyID,
+	}
+
+	token, err := keyring.Sign(claims)
+	if err != nil {
+		return "", errors.E(err, errors.Internal)
+	}
+
+	return token, nil
+}
+
+// sessionBySignedToken verifies a signed access token and returns its Session with the User of its claims,
+// blocking a User or changing its Role revokes its token families, see ClaimsUser
+// returns Unauthorized if the signature is invalid, the token expired or its family was revoked
+func sessionBySignedToken(token string, cache *storage.Cache) (Session, error) {
+	keyring, err := tokenKeyring()
+	if err != nil {
+		return Session{}, errors.E(err)
+	}
+
+	var claims accessClaims
+	err = keyring.Verify(token, &claims)
+	if err != nil {
+		return Session{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return Session{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	// the denylist is the only cache lookup of signed tokens
+	revoked, err := cache.Exists(familyRevokedKey(familyKeysKey(claims.FamilyID))).Result()
+	if err != nil {
+		return Session{}, errors.E(err, errors.Internal)
+	}
+	if revoked > 0 {
+		err := fmt.Errorf("token family of user %d is revoked", userID)
+		return Session{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	return Session{
+		UserID:    userID,
+		Role:      claims.Role,
+		FamilyID:  claims.FamilyID,
+		CreatedAt: time.Unix(claims.IssuedAt, 0),
+		user: &User{
+			ID:            userID,
+			Role:          claims.Role,
+			Status:        claims.Status,
+			EmailVerified: claims.EmailVerified,
+			TOTPEnabled:   claims.TOTPEnabled,
+		},
+	}, nil
+}
+
+// ClaimsUser returns the User carried by the claims of a signed access token,
+// only ID, Role, Status, EmailVerified and TOTPEnabled are set, load the User for the other fields.
+// A verified email or changed TOTP is only carried by tokens issued afterwards, e.g. by a refresh
+// returns false for opaque access tokens
+func (s Session) ClaimsUser() (User, bool) {
+	if s.user == nil {
+		return User{}, false
+	}
+	return *s.user, true
+}
+
+// isSignedToken returns true if the token has the form of a JWT,
+// opaque tokens never contain dots
+func isSignedToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// tokenKeyring returns the configured keys to sign and verify access tokens,
+// the TokenValuePassword is kept with the empty key ID to verify tokens issued before the keyring
+func tokenKeyring() (jwtutil.Keyring, error) {
+	keyring := jwtutil.Keyring{
+		ActiveID: cfg.Crypto.ActiveKeyID,
+		Keys:     map[string][]byte{},
+	}
+	for id, secret := range cfg.Crypto.Keys {
+		if secret != "" {
+			keyring.Keys[id] = []byte(secret)
+		}
+	}
+	if cfg.Crypto.TokenValuePassword != "" {
+		keyring.Keys[""] = []byte(cfg.Crypto.TokenValuePassword)
+	}
+
+	if _, ok := keyring.Keys[keyring.ActiveID]; !ok {
+		err := fmt.Errorf("active crypto key %q is not configured", keyring.ActiveID)
+		return keyring, errors.E(err, errors.Internal)
+	}
+
+	return keyring, nil
+}
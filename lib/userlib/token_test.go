@@ -0,0 +1,152 @@
+package userlib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/config"
+)
+
+// useSignedTokens switches to signed access tokens until the test finished
+func useSignedTokens(t *testing.T) {
+	defaultSession, defaultCrypto := cfg.Session, cfg.Crypto
+	t.Cleanup(func() {
+		cfg.Session, cfg.Crypto = defaultSession, defaultCrypto
+	})
+
+	cfg.Session.TokenMode = TokenModeSigned
+	cfg.Crypto = config.Crypto{
+		ActiveKeyID: "test1",
+		Keys:        map[string]string{"test1": "test-token-signing-key"},
+	}
+}
+
+func TestSignedTokens(t *testing.T) {
+	useSignedTokens(t)
+	t.Cleanup(func() {
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{ID: 1, Role: RoleAdmin, EmailVerified: true}
+
+	t.Run("create valid signed Tokens", func(t *testing.T) {
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+		assert.True(t, isSignedToken(tokens.AccessToken))
+
+		session, err := SessionByToken(tokens.AccessToken, cache)
+		require.NoError(t, err)
+		assert.Equal(t, 1, session.UserID)
+		assert.Equal(t, RoleAdmin, session.Role)
+		assert.NotEmpty(t, session.FamilyID)
+
+		// the User is served from the claims
+		claimsUser, ok := session.ClaimsUser()
+		require.True(t, ok)
+		assert.Equal(t, User{ID: 1, Role: RoleAdmin, Status: StatusActive, EmailVerified: true}, claimsUser)
+
+		// the access token is not stored
+		_, err = cache.Get(sessionKey(tokens.AccessToken)).Result()
+		assert.Error(t, err)
+	})
+
+	t.Run("get invalid Session with tampered token", func(t *testing.T) {
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		parts := strings.Split(tokens.AccessToken, ".")
+		parts[2] = strings.Repeat("A", len(parts[2]))
+		_, err = SessionByToken(strings.Join(parts, "."), cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("get invalid Session with token of other key", func(t *testing.T) {
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		defaultKeys := cfg.Crypto.Keys
+		cfg.Crypto.Keys = map[string]string{"test1": "other-token-signing-key"}
+		defer func() { cfg.Crypto.Keys = defaultKeys }()
+
+		_, err = SessionByToken(tokens.AccessToken, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("revoked signed token is denied", func(t *testing.T) {
+		tokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+		otherTokens, err := NewTokens(user, cache)
+		require.NoError(t, err)
+
+		err = DeleteSession(tokens.AccessToken, cache)
+		require.NoError(t, err)
+
+		_, err = SessionByToken(tokens.AccessToken, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+		_, err = SessionByToken(otherTokens.AccessToken, cache)
+		assert.NoError(t, err)
+
+		err = DeleteUserSessions(user.ID, cache)
+		require.NoError(t, err)
+		_, err = SessionByToken(otherTokens.AccessToken, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("fail to create Tokens without active key", func(t *testing.T) {
+		cfg.Crypto.ActiveKeyID = "test2"
+		defer func() { cfg.Crypto.ActiveKeyID = "test1" }()
+
+		_, err := NewTokens(user, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Internal, err))
+	})
+}
+
+func TestSignedTokensKeyRotation(t *testing.T) {
+	useSignedTokens(t)
+	t.Cleanup(func() {
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{ID: 1}
+
+	// tokens issued with the single TokenValuePassword before the keyring
+	cfg.Crypto = config.Crypto{TokenValuePassword: "legacy-token-value-password"}
+	legacyTokens, err := NewTokens(user, cache)
+	require.NoError(t, err)
+
+	cfg.Crypto = config.Crypto{
+		TokenValuePassword: "legacy-token-value-password",
+		ActiveKeyID:        "test1",
+		Keys:               map[string]string{"test1": "test-token-signing-key1"},
+	}
+	tokens1, err := NewTokens(user, cache)
+	require.NoError(t, err)
+
+	// rotate to a new key, the old one is still accepted
+	cfg.Crypto.ActiveKeyID = "test2"
+	cfg.Crypto.Keys["test2"] = "test-token-signing-key2"
+	tokens2, err := NewTokens(user, cache)
+	require.NoError(t, err)
+
+	for _, token := range []string{legacyTokens.AccessToken, tokens1.AccessToken, tokens2.AccessToken} {
+		_, err = SessionByToken(token, cache)
+		assert.NoError(t, err)
+	}
+
+	// removed keys are no longer accepted
+	cfg.Crypto.TokenValuePassword = ""
+	delete(cfg.Crypto.Keys, "test1")
+	_, err = SessionByToken(legacyTokens.AccessToken, cache)
+	assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	_, err = SessionByToken(tokens1.AccessToken, cache)
+	assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	_, err = SessionByToken(tokens2.AccessToken, cache)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,324 @@
+package userlib
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis"
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/strutil"
+
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/pkg/totp"
+)
+
+const (
+	defaultTOTPIssuer = "Gateway"
+	totpSkew          = 1 // accepted time steps before and after the current one
+
+	recoveryCodeCount  = 10
+	recoveryCodeLength = 10
+
+	loginChallengeKind        = "login_challenge"
+	loginChallengeTTL         = 5 * time.Minute
+	maxLoginChallengeAttempts = 5
+)
+
+// TOTPEnrollment is the secret to add to an authenticator app,
+// URI can be shown as QR code
+type TOTPEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// loginChallenge is stored for every login waiting for the second factor
+type loginChallenge struct {
+	UserID int
+}
+
+// EnrollTOTP generates and stores a new TOTP secret for the User,
+// the second factor is enabled once a code of the secret is confirmed with ConfirmTOTP
+// returns Unprocessable if TOTP is already enabled
+func (u *User) EnrollTOTP(db *storage.DB) (TOTPEnrollment, error) {
+	if u.TOTPEnabled {
+		return TOTPEnrollment{}, errors.E(fmt.Errorf("totp of user %d is enabled", u.ID), errors.Unprocessable, "TOTP is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return TOTPEnrollment{}, errors.E(err, errors.Internal)
+	}
+
+	var updatedUser User
+	q := `UPDATE users SET totp_secret=$1 WHERE id=$2 RETURNING *`
+	err = db.Get(&updatedUser, q, secret, u.ID)
+	if err != nil {
+		return TOTPEnrollment{}, errors.E(err, errors.Internal)
+	}
+	*u = updatedUser
+
+	issuer := cfg.TOTP.Issuer
+	if issuer == "" {
+		issuer = defaultTOTPIssuer
+	}
+
+	return TOTPEnrollment{
+		Secret: secret,
+		URI:    totp.URI(issuer, u.Email, secret),
+	}, nil
+}
+
+// ConfirmTOTP enables TOTP if the code matches the enrolled secret
+// and returns new single-use recovery codes, only their hashes are stored
+// returns Unprocessable if TOTP is not enrolled, already enabled or the code is incorrect
+func (u *User) ConfirmTOTP(code string, db *storage.DB, cache *storage.Cache) ([]string, error) {
+	switch {
+	case u.TOTPEnabled:
+		return nil, errors.E(fmt.Errorf("totp of user %d is enabled", u.ID), errors.Unprocessable, "TOTP is already enabled")
+	case u.TOTPSecret == "":
+		return nil, errors.E(fmt.Errorf("totp of user %d is not enrolled", u.ID), errors.Unprocessable, "TOTP is not enrolled")
+	}
+
+	err := u.verifyTOTPCode(code, cache)
+	if err != nil {
+		return nil, errors.E(err, errors.Unprocessable, "Code is incorrect")
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code := strutil.RandomSecure(recoveryCodeLength, "pin")
+		codes[i] = code[:recoveryCodeLength/2] + "-" + code[recoveryCodeLength/2:]
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return nil, errors.E(err, errors.Internal)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var updatedUser User
+	err = tx.Get(&updatedUser, `UPDATE users SET totp_enabled=true WHERE id=$1 RETURNING *`, u.ID)
+	if err != nil {
+		return nil, errors.E(err, errors.Internal)
+	}
+
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id=$1`, u.ID)
+	if err != nil {
+		return nil, errors.E(err, errors.Internal)
+	}
+	for _, code := range codes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, u.ID, recoveryCodeHash(u.ID, code))
+		if err != nil {
+			return nil, errors.E(err, errors.Internal)
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return nil, errors.E(err, errors.Internal)
+	}
+	*u = updatedUser
+
+	log.Infow("totp enabled", "userID", u.ID)
+	return codes, nil
+}
+
+// DisableTOTP disables TOTP and removes the secret and recovery codes
+// if the code is a valid TOTP or recovery code
+// returns Unprocessable if TOTP is not enabled or the code is incorrect
+func (u *User) DisableTOTP(code string, db *storage.DB, cache *storage.Cache) error {
+	if !u.TOTPEnabled {
+		return errors.E(fmt.Errorf("totp of user %d is not enabled", u.ID), errors.Unprocessable, "TOTP is not enabled")
+	}
+
+	err := u.VerifySecondFactor(code, db, cache)
+	if err != nil {
+		if errors.IsKind(errors.Unauthorized, err) {
+			return errors.E(err, errors.Unprocessable, "Code is incorrect")
+		}
+		return errors.E(err)
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
+	var updatedUser User
+	err = tx.Get(&updatedUser, `UPDATE users SET totp_enabled=false, totp_secret='' WHERE id=$1 RETURNING *`, u.ID)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id=$1`, u.ID)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	*u = updatedUser
+
+	log.Infow("totp disabled", "userID", u.ID)
+	return nil
+}
+
+// VerifySecondFactor checks a TOTP code or uses up a recovery code of the User
+// returns Unauthorized if the code is incorrect or was already used
+func (u User) VerifySecondFactor(code string, db *storage.DB, cache *storage.Cache) error {
+	code = strings.TrimSpace(code)
+	if len(code) == totp.Digits {
+		return u.verifyTOTPCode(code, cache)
+	}
+
+	// recovery codes can only be used once
+	result, err := db.Exec(`UPDATE recovery_codes SET used_at=NOW()
+			WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL`, u.ID, recoveryCodeHash(u.ID, code))
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	used, err := result.RowsAffected()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	if used == 0 {
+		return errors.E(fmt.Errorf("incorrect recovery code for user %d", u.ID), errors.Unauthorized, "Code is incorrect")
+	}
+
+	log.Infow("recovery code used", "userID", u.ID)
+	return nil
+}
+
+// verifyTOTPCode checks the TOTP code, every code is only accepted once
+// returns Unauthorized if the code is incorrect or was already used
+func (u User) verifyTOTPCode(code string, cache *storage.Cache) error {
+	incorrect := errors.E(fmt.Errorf("incorrect totp code for user %d", u.ID), errors.Unauthorized, "Code is incorrect")
+	if u.TOTPSecret == "" {
+		return incorrect
+	}
+
+	counter, ok := totp.Validate(u.TOTPSecret, code, time.Now(), totpSkew)
+	if !ok {
+		return incorrect
+	}
+
+	// remember the time step until it can't be valid anymore
+	key := fmt.Sprintf("%s:totp_used:%d:%d", cachePrefix, u.ID, counter)
+	firstUse, err := cache.SetNX(key, 1, time.Duration(2*totpSkew+1)*totp.Period).Result()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	if !firstUse {
+		return incorrect
+	}
+
+	return nil
+}
+
+// NewLoginChallenge returns a token to complete the login of the User with the second factor
+func NewLoginChallenge(user User, cache *storage.Cache) (string, error) {
+	err := user.CheckStatus()
+	if err != nil {
+		return "", errors.E(err)
+	}
+
+	return newOneTimeToken(loginChallengeKind, loginChallenge{UserID: user.ID}, loginChallengeTTL, cache)
+}
+
+// LoginChallengeUser returns the User of the login challenge token without using the token
+// returns Unauthorized if the token is invalid or expired
+func LoginChallengeUser(token string, db *storage.DB, cache *storage.Cache) (User, error) {
+	value, err := cache.Get(oneTimeTokenKey(loginChallengeKind, token)).Bytes()
+	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return User{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		return User{}, errors.E(err, errors.Internal)
+	}
+
+	var challenge loginChallenge
+	err = json.Unmarshal(value, &challenge)
+	if err != nil {
+		return User{}, errors.E(err, errors.Internal)
+	}
+
+	user, err := UserByID(challenge.UserID, db)
+	if err != nil {
+		if errors.IsKind(errors.NotFound, err) {
+			return User{}, errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		return User{}, errors.E(err)
+	}
+
+	return user, nil
+}
+
+// CompleteLoginChallenge returns the User of the login challenge token if the code is a valid second factor,
+// the token is revoked after it was used or after too many incorrect codes
+// returns Unauthorized if the token is invalid or expired or the code is incorrect
+func CompleteLoginChallenge(token, code string, db *storage.DB, cache *storage.Cache) (User, error) {
+	user, err := LoginChallengeUser(token, db, cache)
+	if err != nil {
+		return User{}, errors.E(err)
+	}
+
+	key := oneTimeTokenKey(loginChallengeKind, token)
+	err = user.VerifySecondFactor(code, db, cache)
+	if err != nil {
+		if !errors.IsKind(errors.Unauthorized, err) {
+			return User{}, errors.E(err)
+		}
+
+		revokeErr := countLoginChallengeFailure(key, cache)
+		if revokeErr != nil {
+			return User{}, errors.E(revokeErr)
+		}
+		return User{}, errors.E(err)
+	}
+
+	// concurrent requests can't complete the same challenge twice
+	deleted, err := cache.Del(key, key+":attempts").Result()
+	if err != nil {
+		return User{}, errors.E(err, errors.Internal)
+	}
+	if deleted == 0 {
+		return User{}, errors.E(fmt.Errorf("login challenge already used"), errors.Unauthorized, "Token is invalid or expired")
+	}
+
+	return user, nil
+}
+
+// countLoginChallengeFailure counts an incorrect code for the login challenge
+// and revokes the challenge after too many incorrect codes
+func countLoginChallengeFailure(key string, cache *storage.Cache) error {
+	var attempts *redis.IntCmd
+	_, err := cache.TxPipelined(func(pipe redis.Pipeliner) error {
+		attempts = pipe.Incr(key + ":attempts")
+		pipe.Expire(key+":attempts", loginChallengeTTL)
+		return nil
+	})
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	if attempts.Val() >= maxLoginChallengeAttempts {
+		log.Warnw("too many incorrect codes, revoking login challenge")
+		err = cache.Del(key, key+":attempts").Err()
+		if err != nil {
+			return errors.E(err, errors.Internal)
+		}
+	}
+
+	return nil
+}
+
+// recoveryCodeHash returns the stored hash of a recovery code,
+// codes are compared regardless of case and separators
+func recoveryCodeHash(userID int, code string) string {
+	code = strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return strutil.Hash(fmt.Sprintf("%d:%s", userID, code), "recovery_code")
+}
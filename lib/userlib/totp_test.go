@@ -0,0 +1,198 @@
+package userlib
+
+import (
+	"testing"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/pkg/totp"
+)
+
+// mustTOTPCode returns the code of the secret for the time step at offset steps from now
+func mustTOTPCode(t *testing.T, secret string, offset int) string {
+	code, err := totp.Code(secret, time.Now().Add(time.Duration(offset)*totp.Period))
+	require.NoError(t, err)
+	return code
+}
+
+// mustEnableTOTP enrolls and confirms TOTP for the User and returns the secret and recovery codes
+func mustEnableTOTP(t *testing.T, user *User) (string, []string) {
+	enrollment, err := user.EnrollTOTP(db)
+	require.NoError(t, err)
+
+	codes, err := user.ConfirmTOTP(mustTOTPCode(t, enrollment.Secret, 0), db, cache)
+	require.NoError(t, err)
+
+	return enrollment.Secret, codes
+}
+
+func TestEnrollAndConfirmTOTP(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{Email: "user_totp0@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+
+	enrollment, err := user.EnrollTOTP(db)
+	require.NoError(t, err)
+	assert.NotEmpty(t, enrollment.Secret)
+	assert.Contains(t, enrollment.URI, "otpauth://totp/")
+	assert.Contains(t, enrollment.URI, "secret="+enrollment.Secret)
+	assert.False(t, user.TOTPEnabled)
+
+	t.Run("confirm invalid code", func(t *testing.T) {
+		_, err := user.ConfirmTOTP("000000", db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("confirm valid code", func(t *testing.T) {
+		codes, err := user.ConfirmTOTP(mustTOTPCode(t, enrollment.Secret, 0), db, cache)
+		require.NoError(t, err)
+		assert.Len(t, codes, recoveryCodeCount)
+		assert.True(t, user.TOTPEnabled)
+
+		// only hashes of recovery codes are stored
+		var count int
+		err = db.Get(&count, `SELECT COUNT(*) FROM recovery_codes WHERE user_id=$1 AND code_hash=ANY($2)`, user.ID, pq.Array(codes))
+		require.NoError(t, err)
+		assert.Equal(t, 0, count)
+	})
+
+	t.Run("enroll and confirm again", func(t *testing.T) {
+		_, err := user.EnrollTOTP(db)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+		_, err = user.ConfirmTOTP(mustTOTPCode(t, enrollment.Secret, 1), db, cache)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("confirm without enrollment", func(t *testing.T) {
+		otherUser := User{Email: "user_totp1@org.com", Password: "password"}
+		require.NoError(t, otherUser.Insert(db, cache))
+
+		_, err := otherUser.ConfirmTOTP("123456", db, cache)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+}
+
+func TestVerifySecondFactor(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{Email: "user_totp2@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+	secret, codes := mustEnableTOTP(t, &user)
+
+	t.Run("verify valid TOTP code only once", func(t *testing.T) {
+		code := mustTOTPCode(t, secret, 1)
+		require.NoError(t, user.VerifySecondFactor(code, db, cache))
+
+		err := user.VerifySecondFactor(code, db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("verify valid recovery code only once", func(t *testing.T) {
+		require.NoError(t, user.VerifySecondFactor(codes[0], db, cache))
+
+		err := user.VerifySecondFactor(codes[0], db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("verify recovery code regardless of case and separators", func(t *testing.T) {
+		require.NoError(t, user.VerifySecondFactor(" "+codes[1][:5]+codes[1][6:]+" ", db, cache))
+	})
+
+	t.Run("verify invalid codes", func(t *testing.T) {
+		for _, code := range []string{"", "000000", "AAAAA-AAAAA"} {
+			err := user.VerifySecondFactor(code, db, cache)
+			assert.True(t, errors.IsKind(errors.Unauthorized, err), code)
+		}
+	})
+}
+
+func TestDisableTOTP(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{Email: "user_totp3@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+	secret, _ := mustEnableTOTP(t, &user)
+
+	err := user.DisableTOTP("000000", db, cache)
+	assert.True(t, errors.IsKind(errors.Unprocessable, err))
+
+	err = user.DisableTOTP(mustTOTPCode(t, secret, -1), db, cache)
+	require.NoError(t, err)
+	assert.False(t, user.TOTPEnabled)
+	assert.Empty(t, user.TOTPSecret)
+
+	var count int
+	require.NoError(t, db.Get(&count, `SELECT COUNT(*) FROM recovery_codes WHERE user_id=$1`, user.ID))
+	assert.Equal(t, 0, count)
+
+	err = user.DisableTOTP(mustTOTPCode(t, secret, 1), db, cache)
+	assert.True(t, errors.IsKind(errors.Unprocessable, err))
+}
+
+func TestCompleteLoginChallenge(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{Email: "user_totp4@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+	_, codes := mustEnableTOTP(t, &user)
+
+	t.Run("complete valid login challenge", func(t *testing.T) {
+		token, err := NewLoginChallenge(user, cache)
+		require.NoError(t, err)
+
+		// the User of the challenge can be loaded without using the token
+		challengeUser, err := LoginChallengeUser(token, db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, challengeUser.ID)
+
+		// incorrect codes can be retried
+		_, err = CompleteLoginChallenge(token, "000000", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+
+		completedUser, err := CompleteLoginChallenge(token, codes[0], db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, completedUser.ID)
+
+		// the challenge can only be completed once
+		_, err = CompleteLoginChallenge(token, codes[1], db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("login challenge is revoked after too many incorrect codes", func(t *testing.T) {
+		token, err := NewLoginChallenge(user, cache)
+		require.NoError(t, err)
+
+		for i := 0; i < maxLoginChallengeAttempts; i++ {
+			_, err = CompleteLoginChallenge(token, "000000", db, cache)
+			assert.True(t, errors.IsKind(errors.Unauthorized, err))
+		}
+
+		_, err = CompleteLoginChallenge(token, codes[2], db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+
+	t.Run("complete invalid login challenge with unknown token", func(t *testing.T) {
+		_, err := CompleteLoginChallenge("unknown", codes[3], db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+		_, err = LoginChallengeUser("unknown", db, cache)
+		assert.True(t, errors.IsKind(errors.Unauthorized, err))
+	})
+}
@@ -3,32 +3,43 @@ package userlib
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/iconmobile-dev/go-core/errors"
 	"github.com/iconmobile-dev/go-core/structs"
 	"github.com/lib/pq"
-	"golang.org/x/crypto/bcrypt"
 
 	"github.com/iconmobile-dev/go-interview/lib/storage"
 	"github.com/iconmobile-dev/go-interview/pkg/sqlutil"
+	"github.com/iconmobile-dev/go-interview/pkg/validate"
 )
 
 // User contains the database entry
+// the visible tags declare who may see a field, see Redact
 type User struct {
-	ID          int
-	Email       string
-	Password    string `json:"-"`
-	Description string
-	FirstName   string
-	LastName    string
-	CreatedAt   time.Time `db:"created_at"`
-	UpdatedAt   time.Time `db:"updated_at"`
-}
-
-// Insert sanitizes and inserts a User in database
-// VALIDATION IS MISSING
-// Should not be called without prior role check!
+	ID            int
+	Email         string `visible:"self,support"`
+	EmailToVerify string `db:"email_to_verify" visible:"self,support"` // new email until it is verified, see VerifyEmail
+	EmailVerified bool   `db:"email_verified"`
+	Password      string `json:"-" visible:"-"`
+	TOTPSecret    string `db:"totp_secret" json:"-" visible:"-"`
+	TOTPEnabled   bool   `db:"totp_enabled" visible:"self,support"`
+	Role          Role
+	Status        Status     // see CurrentStatus
+	StatusReason  string     `db:"status_reason" visible:"self,support"`
+	StatusUntil   *time.Time `db:"status_until" visible:"self,support"` // end of a suspension
+	Description   string
+	FirstName     string
+	LastName      string
+	CreatedAt     time.Time  `db:"created_at"`
+	UpdatedAt     time.Time  `db:"updated_at"`
+	DeletedAt     *time.Time `db:"deleted_at" visible:"support"` // set until the User is purged, see Delete
+}
+
+// Insert sanitizes, validates and inserts a User in database
+// Should not be called without prior role check, the Role of the new User
+// must not be higher than the Role of the acting User!
 func (u *User) Insert(db *storage.DB, cache *storage.Cache) error {
 	// removes all leading and trailing white spaces from string fields
 	err := u.Sanitize()
@@ -36,40 +47,38 @@ func (u *User) Insert(db *storage.DB, cache *storage.Cache) error {
 		return errors.E(err)
 	}
 
-	// hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+	err = u.Validate()
 	if err != nil {
-		return errors.E(err, errors.Internal)
+		return errors.E(err)
 	}
-	u.Password = string(hashedPassword)
 
-	// is the email already in the database? it must be unique
-	_, err = UserByEmail(u.Email, db)
+	// hash password
+	u.Password, err = hashPassword(u.Password)
 	if err != nil {
-		var errorsError *errors.Error
-		if !errors.As(err, &errorsError) || errorsError.Kind != errors.NotFound {
-			return errors.E(err)
-		}
-	} else {
-		msg := fmt.Sprintf("user with email %v does already exist", u.Email)
-		return errors.E(fmt.Errorf(msg), errors.Conflict, msg)
+		return errors.E(err)
 	}
 
-	// insert to database
+	// insert to database, the email is unverified until VerifyEmail
+	// the email must be unique, which is checked by the database to be race-safe
 	var createdUser User
-	sql := `INSERT INTO users (email, password, firstname, lastname)
-			VALUES ($1, $2, $3, $4) RETURNING *`
+	sql := `INSERT INTO users (email, email_to_verify, password, role, firstname, lastname)
+			VALUES ($1, $1, $2, $3, $4, $5) RETURNING *`
 
-	err = db.Get(&createdUser, sql, u.Email, u.Password, u.FirstName, u.LastName)
+	err = db.Get(&createdUser, sql, u.Email, u.Password, u.Role, u.FirstName, u.LastName)
 	if err != nil {
+		if isPQError(err, "unique_violation") {
+			msg := fmt.Sprintf("user with email %v does already exist", u.Email)
+			return errors.E(err, errors.Conflict, msg)
+		}
 		return errors.E(err, errors.Internal)
 	}
 	*u = createdUser
 	return nil
 }
 
-// Update sanitizes and updates User in database
-// Should not be called without prior role check!
+// Update sanitizes, validates and updates User in database
+// revokes all sessions of the User if the password has changed
+// Should not be called without prior role check, see CanModify!
 func (u *User) Update(oldHashedPassword string, oldPassword *string, db *storage.DB, cache *storage.Cache) error {
 	// removes all leading and trailing white spaces from string fields
 	err := u.Sanitize()
@@ -78,73 +87,135 @@ func (u *User) Update(oldHashedPassword string, oldPassword *string, db *storage
 	}
 
 	// check if password has changed
-	if u.Password != oldHashedPassword && oldPassword != nil {
-		err := bcrypt.CompareHashAndPassword([]byte(oldHashedPassword), []byte(*oldPassword))
+	// the old password may only be nil if the change was verified otherwise
+	passwordChanged := u.Password != oldHashedPassword
+
+	var errs validate.Errors
+	u.validateProfile(&errs)
+	if passwordChanged {
+		validatePassword(&errs, "Password", u.Password)
+	}
+	err = validationError(errs)
+	if err != nil {
+		return errors.E(err)
+	}
+
+	if passwordChanged {
+		if oldPassword != nil {
+			err := verifyPassword(oldHashedPassword, *oldPassword)
+			if err != nil {
+				return errors.E(err, errors.Unprocessable, "OldPassword is incorrect")
+			}
+		}
+
+		err = checkPasswordHistory(u.ID, oldHashedPassword, u.Password, db)
 		if err != nil {
-			return errors.E(err, errors.Unprocessable, "OldPassword is incorrect")
+			return errors.E(err)
 		}
 
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(u.Password), bcrypt.DefaultCost)
+		u.Password, err = hashPassword(u.Password)
 		if err != nil {
 			log.Errorw("error generating password", "error", err)
 			return errors.E(err, errors.Internal, "Internal server error")
 		}
-		u.Password = string(hashedPassword)
 	}
 
-	// update in database
+	// update in database, the replaced password is kept in the history
+	tx, err := db.Beginx()
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+	defer tx.Rollback() //nolint:errcheck
+
 	var updatedUser User
 	sql := `UPDATE users
 			SET password=$1, firstname=$2, lastname=$3
 			WHERE id=$4 RETURNING *`
 
-	err = db.Get(&updatedUser, sql, u.Password, u.FirstName, u.LastName, u.ID)
+	err = tx.Get(&updatedUser, sql, u.Password, u.FirstName, u.LastName, u.ID)
+	if err != nil {
+		return errors.E(err, errors.Internal)
+	}
+
+	if passwordChanged {
+		err = addPasswordHistory(u.ID, oldHashedPassword, tx)
+		if err != nil {
+			return errors.E(err)
+		}
+	}
+
+	err = tx.Commit()
 	if err != nil {
 		return errors.E(err, errors.Internal)
 	}
 	*u = updatedUser
+
+	// sign out everywhere after a password change
+	if passwordChanged {
+		err = DeleteUserSessions(u.ID, cache)
+		if err != nil {
+			return errors.E(err)
+		}
+	}
+
 	return nil
 }
 
 // Sanitize removes all leading and trailing white spaces from string fields
+// and normalizes the email
 func (u *User) Sanitize() error {
 	err := structs.Sanitize(u)
 	if err != nil {
 		return errors.E(err, errors.Internal)
 	}
 
+	u.Email = NormalizeEmail(u.Email)
+
 	return nil
 }
 
+// NormalizeEmail returns the email in the form it is stored in the database
+// emails are unique regardless of their case
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
 // IsCorrectPassword checks if the password is correct
 func (u *User) IsCorrectPassword(password string) error {
-	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
-	if err != nil {
-		return errors.E(err, errors.Unauthorized, "Password is incorrect")
-	}
-
-	return nil
+	return verifyPassword(u.Password, password)
 }
 
-// UserByID loads User with given ID, returns if not found
+// UserByID loads User with given ID, returns NotFound if not found or deleted
 func UserByID(id int, db *storage.DB) (User, error) {
-	u := User{}
-	q := `SELECT * FROM users WHERE id=$1 LIMIT 1;`
-	if err := db.Get(&u, q, id); err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return u, errors.E(err, errors.NotFound)
-		}
-		return u, errors.E(err, errors.Internal)
-	}
+	return userBy(`id=$1`, id, false, db)
+}
 
-	return u, nil
+// UserByIDIncludingDeleted loads User with given ID even if it is deleted, returns NotFound if not found
+func UserByIDIncludingDeleted(id int, db *storage.DB) (User, error) {
+	return userBy(`id=$1`, id, true, db)
 }
 
-// UserByEmail loads User with given email, returns nil if not found
+// UserByEmail loads User with given email case-insensitive, returns NotFound if not found or deleted
 func UserByEmail(email string, db *storage.DB) (User, error) {
+	return userBy(`lower(email)=lower($1)`, email, false, db)
+}
+
+// UserByEmailIncludingDeleted loads User with given email case-insensitive even if it is deleted,
+// returns NotFound if not found
+func UserByEmailIncludingDeleted(email string, db *storage.DB) (User, error) {
+	return userBy(`lower(email)=lower($1)`, email, true, db)
+}
+
+// userBy loads the User matching the condition with the argument
+func userBy(condition string, arg interface{}, includeDeleted bool, db *storage.DB) (User, error) {
 	u := User{}
-	q := `SELECT * FROM users WHERE email=$1 LIMIT 1;`
-	if err := db.Get(&u, q, email); err != nil {
+	q := `SELECT * FROM users WHERE ` + condition
+	if !includeDeleted {
+		q += ` AND deleted_at IS NULL`
+	}
+	q += ` LIMIT 1;`
+
+	if err := db.Get(&u, q, arg); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return u, errors.E(err, errors.NotFound)
 		}
@@ -167,7 +238,8 @@ type UserFilter struct {
 	Role          *sqlutil.IntFilter
 	Email         *sqlutil.StringFilter
 	EmailToVerify *sqlutil.StringFilter `db:"email_to_verify"`
-	Password      *sqlutil.StringFilter
+	Password      *sqlutil.StringFilter `json:"-"` // not exposed to API clients
+	TOTPEnabled   *sqlutil.BoolFilter   `db:"totp_enabled"`
 	FirstName     *sqlutil.StringFilter
 	LastName      *sqlutil.StringFilter
 	Description   *sqlutil.StringFilter
@@ -178,6 +250,9 @@ type UserFilter struct {
 	LastLogin     *sqlutil.TimeFilter `db:"last_login"`
 	CreatedAt     *sqlutil.TimeFilter `db:"created_at"`
 	UpdatedAt     *sqlutil.TimeFilter `db:"updated_at"`
+	DeletedAt     *sqlutil.TimeFilter `db:"deleted_at"` // requires IncludeDeleted
+	// deleted Users are only listed if set
+	IncludeDeleted bool
 }
 
 // ListUsers returns a list of Users
@@ -185,6 +260,9 @@ func ListUsers(params UserListParams, db *storage.DB) ([]User, error) {
 	us := []User{}
 
 	q := sqlutil.Select("*").From("users")
+	if !params.Filter.IncludeDeleted {
+		q = q.Where("deleted_at IS NULL")
+	}
 
 	q, err := sqlutil.UseStructFilter(q, "", params.Filter)
 	if err != nil {
@@ -198,6 +276,12 @@ func ListUsers(params UserListParams, db *storage.DB) ([]User, error) {
 		return us, errors.E(err)
 	}
 
+	// sorting by secrets would leak information about them
+	delete(columnMapping, "password")
+	delete(columnMapping, "Password")
+	delete(columnMapping, "totp_secret")
+	delete(columnMapping, "TOTPSecret")
+
 	q, err = sqlutil.UseOneColumnSort(q, params.Sort, columnMapping)
 	if err != nil {
 		return us, errors.E(err)
@@ -210,12 +294,54 @@ func ListUsers(params UserListParams, db *storage.DB) ([]User, error) {
 
 	err = db.Select(&us, sql, args...)
 	if err != nil {
-		return us, errors.E(err, errors.Internal)
+		return us, listQueryError(err)
 	}
 
 	return us, nil
 }
 
+// CountUsers returns the number of Users matching the filter
+func CountUsers(filter UserFilter, db *storage.DB) (int, error) {
+	count := 0
+
+	q := sqlutil.Select("COUNT(*)").From("users")
+	if !filter.IncludeDeleted {
+		q = q.Where("deleted_at IS NULL")
+	}
+
+	q, err := sqlutil.UseStructFilter(q, "", filter)
+	if err != nil {
+		return count, errors.E(err)
+	}
+
+	sql, args, err := q.ToSql()
+	if err != nil {
+		return count, errors.E(err, errors.Internal)
+	}
+
+	err = db.Get(&count, sql, args...)
+	if err != nil {
+		return count, listQueryError(err)
+	}
+
+	return count, nil
+}
+
+// listQueryError translates errors of filtered list queries
+// a filter on a column which does not exist is a client error
+func listQueryError(err error) error {
+	if isPQError(err, "undefined_column") {
+		return errors.E(err, errors.Unprocessable, fmt.Sprintf("can't filter by column: %s", err.(*pq.Error).Message))
+	}
+	return errors.E(err, errors.Internal)
+}
+
+// isPQError returns true if err is a postgres error with the given code name
+func isPQError(err error, codeName string) bool {
+	pqErr, ok := err.(*pq.Error)
+	return ok && pqErr.Code.Name() == codeName
+}
+
 func getUserIDs(os []User) []int {
 	ids := []int{}
 
@@ -226,24 +352,79 @@ func getUserIDs(os []User) []int {
 	return ids
 }
 
-// Delete deletes User in database
-func (u User) Delete(db *storage.DB) error {
-	sql := "DELETE FROM users WHERE id=$1"
-	_, err := db.Exec(sql, u.ID)
+// defaultDeletedUserRetentionDays is the time deleted Users can be restored if not configured
+const defaultDeletedUserRetentionDays = 30
+
+// Delete soft-deletes the User in database and revokes all sessions,
+// the User can be restored until it is purged, see Restore and PurgeDeletedUsers
+// returns NotFound if the User does not exist or is already deleted
+func (u *User) Delete(db *storage.DB, cache *storage.Cache) error {
+	var deletedUser User
+	q := `UPDATE users SET deleted_at=NOW() WHERE id=$1 AND deleted_at IS NULL RETURNING *`
+	err := db.Get(&deletedUser, q, u.ID)
 	if err != nil {
-		switch err := err.(type) {
-		case *pq.Error:
-			switch err.Code.Name() {
-			case "foreign_key_violation":
-				err := fmt.Errorf("User is still referenced for ID: %d", u.ID)
-				return errors.E(err, errors.Unprocessable)
-			default:
-				break
-			}
-		default:
-			return errors.E(err, errors.Internal)
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.E(err, errors.NotFound)
 		}
+		return errors.E(err, errors.Internal)
+	}
+	*u = deletedUser
+
+	err = DeleteUserSessions(u.ID, cache)
+	if err != nil {
+		return errors.E(err)
 	}
 
 	return nil
 }
+
+// Restore undoes the soft delete of the User in database
+// returns Unprocessable if the User is not deleted
+// and Conflict if another User took the email since the deletion
+// Should not be called without prior role check!
+func (u *User) Restore(db *storage.DB) error {
+	if u.DeletedAt == nil {
+		return errors.E(fmt.Errorf("user %d is not deleted", u.ID), errors.Unprocessable, "User is not deleted")
+	}
+
+	var restoredUser User
+	q := `UPDATE users SET deleted_at=NULL WHERE id=$1 RETURNING *`
+	err := db.Get(&restoredUser, q, u.ID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return errors.E(err, errors.NotFound)
+		}
+		if isPQError(err, "unique_violation") {
+			return errors.E(err, errors.Conflict, fmt.Sprintf("user with email %v does already exist", u.Email))
+		}
+		return errors.E(err, errors.Internal)
+	}
+	*u = restoredUser
+
+	return nil
+}
+
+// PurgeDeletedUsers permanently deletes Users which were deleted longer than the configured retention ago,
+// their API keys, identities and password history are deleted with them
+// returns the number of purged Users
+func PurgeDeletedUsers(db *storage.DB) (int64, error) {
+	days := cfg.UserDeletion.RetentionDays
+	if days <= 0 {
+		days = defaultDeletedUserRetentionDays
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+
+	res, err := db.Exec(`DELETE FROM users WHERE deleted_at IS NOT NULL AND deleted_at < $1`, cutoff)
+	if err != nil {
+		return 0, errors.E(err, errors.Internal)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, errors.E(err, errors.Internal)
+	}
+
+	if n > 0 {
+		log.Infow("deleted users purged", "count", n)
+	}
+	return n, nil
+}
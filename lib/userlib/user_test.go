@@ -1,9 +1,13 @@
 package userlib
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/iconmobile-dev/go-core/errors"
+
 	"github.com/iconmobile-dev/go-interview/pkg/ptrutil"
 	"github.com/iconmobile-dev/go-interview/pkg/sqlutil"
 	"github.com/stretchr/testify/assert"
@@ -46,6 +50,23 @@ func TestUserInsert(t *testing.T) {
 		})
 	})
 
+	t.Run(`insert invalid User with User.Email == "invalid"`, func(t *testing.T) {
+		user := validUser
+		user.Email = "invalid"
+		err := user.Insert(db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run(`insert invalid User with User.Password == ""`, func(t *testing.T) {
+		user := validUser
+		user.Email = "user2@org.com"
+		user.Password = ""
+		err := user.Insert(db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
 	t.Run(`insert invalid User with User.Email already existing`, func(t *testing.T) {
 		user := validUser
 		user.Email = "user1@org.com"
@@ -54,6 +75,68 @@ func TestUserInsert(t *testing.T) {
 
 		err = user.Insert(db, cache)
 		assert.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Conflict, err))
+	})
+
+	t.Run(`insert invalid User with User.Email already existing in other case`, func(t *testing.T) {
+		user := validUser
+		user.Email = "bob@org.com"
+		err := user.Insert(db, cache)
+		require.NoError(t, err)
+
+		user = validUser
+		user.Email = "Bob@org.com"
+		err = user.Insert(db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Conflict, err))
+	})
+
+	t.Run(`insert valid User normalizes User.Email`, func(t *testing.T) {
+		user := validUser
+		user.Email = " Alice@Org.com "
+		err := user.Insert(db, cache)
+		require.NoError(t, err)
+		assert.Equal(t, "alice@org.com", user.Email)
+
+		loadedUser, err := UserByEmail("ALICE@org.com", db)
+		require.NoError(t, err)
+		assert.Equal(t, user.ID, loadedUser.ID)
+	})
+
+	t.Run(`insert invalid User with email differing in case bypassing normalization`, func(t *testing.T) {
+		// the database itself rejects emails differing only in case
+		_, err := db.Exec(`INSERT INTO users (email, password) VALUES ('carol@org.com', 'x')`)
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO users (email, password) VALUES ('Carol@org.com', 'x')`)
+		require.Error(t, err)
+	})
+
+	t.Run(`insert concurrent Users with same User.Email`, func(t *testing.T) {
+		const concurrency = 10
+
+		errs := make(chan error, concurrency)
+		var wg sync.WaitGroup
+		for i := 0; i < concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				user := validUser
+				user.Email = "concurrent@org.com"
+				errs <- user.Insert(db, cache)
+			}()
+		}
+		wg.Wait()
+		close(errs)
+
+		inserted := 0
+		for err := range errs {
+			if err == nil {
+				inserted++
+				continue
+			}
+			assert.True(t, errors.IsKind(errors.Conflict, err), "unexpected error: %v", err)
+		}
+		assert.Equal(t, 1, inserted)
 	})
 }
 
@@ -168,6 +251,49 @@ func TestUserUpdate(t *testing.T) {
 		require.NoError(t, err)
 	})
 
+	t.Run("update valid User with new password, but without old password", func(t *testing.T) {
+		insertedUser := validUser
+		insertedUser.Email = "user6@org.com"
+		err := insertedUser.Insert(db, cache)
+		require.NoError(t, err)
+
+		updatedUser := insertedUser
+		updatedUser.Password = "new_password"
+		err = updatedUser.Update(insertedUser.Password, nil, db, cache)
+		require.NoError(t, err)
+
+		// the password is never stored as plain text
+		assert.NotEqual(t, "new_password", updatedUser.Password)
+		err = updatedUser.IsCorrectPassword("new_password")
+		require.NoError(t, err)
+	})
+
+	t.Run("update valid User with new password revokes sessions", func(t *testing.T) {
+		insertedUser := validUser
+		insertedUser.Email = "user4@org.com"
+		err := insertedUser.Insert(db, cache)
+		require.NoError(t, err)
+
+		tokens, err := NewTokens(insertedUser, cache)
+		require.NoError(t, err)
+		token := tokens.AccessToken
+
+		// sessions survive updates without password change
+		updatedUser := insertedUser
+		updatedUser.FirstName = "name_b"
+		err = updatedUser.Update(insertedUser.Password, nil, db, cache)
+		require.NoError(t, err)
+		_, err = SessionByToken(token, cache)
+		require.NoError(t, err)
+
+		updatedUser.Password = "new_password"
+		err = updatedUser.Update(insertedUser.Password, &validUser.Password, db, cache)
+		require.NoError(t, err)
+
+		_, err = SessionByToken(token, cache)
+		assert.Error(t, err)
+	})
+
 	t.Run("update valid User with new password, but incorrect old password", func(t *testing.T) {
 		insertedUser := validUser
 		insertedUser.Email = "user3@org.com"
@@ -181,6 +307,19 @@ func TestUserUpdate(t *testing.T) {
 		require.Error(t, err)
 	})
 
+	t.Run("update invalid User with too short new password", func(t *testing.T) {
+		insertedUser := validUser
+		insertedUser.Email = "user7@org.com"
+		err := insertedUser.Insert(db, cache)
+		require.NoError(t, err)
+
+		updatedUser := insertedUser
+		updatedUser.Password = "short"
+		err = updatedUser.Update(insertedUser.Password, &validUser.Password, db, cache)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
 	t.Run("update valid User with failing DB", func(t *testing.T) {
 		insertedUser := validUser
 		insertedUser.Email = "user5@org.com"
@@ -213,20 +352,133 @@ func TestUserDelete(t *testing.T) {
 		err := insertedUser.Insert(db, cache)
 		require.NoError(t, err)
 
-		err = insertedUser.Delete(db)
+		tokens, err := NewTokens(insertedUser, cache)
+		require.NoError(t, err)
+
+		err = insertedUser.Delete(db, cache)
+		require.NoError(t, err)
+		assert.NotNil(t, insertedUser.DeletedAt)
+
+		// deleted Users are excluded unless asked for
+		_, err = UserByID(insertedUser.ID, db)
+		assert.True(t, errors.IsKind(errors.NotFound, err))
+		_, err = UserByEmail(insertedUser.Email, db)
+		assert.True(t, errors.IsKind(errors.NotFound, err))
+
+		loadedUser, err := UserByIDIncludingDeleted(insertedUser.ID, db)
 		require.NoError(t, err)
+		assert.NotNil(t, loadedUser.DeletedAt)
+		_, err = UserByEmailIncludingDeleted(insertedUser.Email, db)
+		require.NoError(t, err)
+
+		// sessions are revoked
+		_, err = SessionByToken(tokens.AccessToken, cache)
+		assert.Error(t, err)
+
+		// the email is free for other Users
+		otherUser := validUser
+		err = otherUser.Insert(db, cache)
+		assert.NoError(t, err)
+
+		// deleting twice fails
+		err = insertedUser.Delete(db, cache)
+		assert.True(t, errors.IsKind(errors.NotFound, err))
 	})
 
 	t.Run("delete valid User with db == failingDB", func(t *testing.T) {
 		insertedUser := validUser
+		insertedUser.Email = "user1@org.com"
 		err := insertedUser.Insert(db, cache)
 		require.NoError(t, err)
 
-		err = insertedUser.Delete(failingDB)
+		err = insertedUser.Delete(failingDB, cache)
 		assert.NotNil(t, err)
 	})
 }
 
+func TestUserRestore(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	user := User{Email: "user0@org.com", Password: "password"}
+	require.NoError(t, user.Insert(db, cache))
+
+	t.Run("restore User which is not deleted", func(t *testing.T) {
+		err := user.Restore(db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("restore deleted User", func(t *testing.T) {
+		require.NoError(t, user.Delete(db, cache))
+
+		err := user.Restore(db)
+		require.NoError(t, err)
+		assert.Nil(t, user.DeletedAt)
+	})
+
+	t.Run("restore deleted User whose email was taken", func(t *testing.T) {
+		deletedUser := User{Email: "user1@org.com", Password: "password"}
+		require.NoError(t, deletedUser.Insert(db, cache))
+		require.NoError(t, deletedUser.Delete(db, cache))
+
+		// deleted Users free their email
+		require.NoError(t, CheckEmailAvailable("USER1@org.com", db))
+		otherUser := User{Email: "USER1@org.com", Password: "password"}
+		require.NoError(t, otherUser.Insert(db, cache))
+
+		err := deletedUser.Restore(db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Conflict, err))
+		assert.NotNil(t, deletedUser.DeletedAt)
+
+		_, err = UserByID(user.ID, db)
+		assert.NoError(t, err)
+		_, err = UserByCredentials(user.Email, "password", db)
+		assert.NoError(t, err)
+	})
+}
+
+func TestPurgeDeletedUsers(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	retention := cfg.UserDeletion.RetentionDays
+	defer func() { cfg.UserDeletion.RetentionDays = retention }()
+	cfg.UserDeletion.RetentionDays = 30
+
+	var users []User
+	for i := 0; i < 3; i++ {
+		user := User{Email: fmt.Sprintf("user%d@org.com", i), Password: "password"}
+		require.NoError(t, user.Insert(db, cache))
+		users = append(users, user)
+	}
+
+	// user0 is active, user1 was deleted recently and user2 beyond the retention
+	require.NoError(t, users[1].Delete(db, cache))
+	require.NoError(t, users[2].Delete(db, cache))
+	_, err := db.Exec(`UPDATE users SET deleted_at=NOW() - INTERVAL '31 days' WHERE id=$1`, users[2].ID)
+	require.NoError(t, err)
+
+	n, err := PurgeDeletedUsers(db)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), n)
+
+	_, err = UserByID(users[0].ID, db)
+	assert.NoError(t, err)
+	_, err = UserByIDIncludingDeleted(users[1].ID, db)
+	assert.NoError(t, err)
+	_, err = UserByIDIncludingDeleted(users[2].ID, db)
+	assert.True(t, errors.IsKind(errors.NotFound, err))
+
+	_, err = PurgeDeletedUsers(failingDB)
+	assert.Error(t, err)
+}
+
 func TestUserList(t *testing.T) {
 	t.Cleanup(func() {
 		assert.NoError(t, db.Reset())
@@ -353,4 +605,75 @@ func TestUserList(t *testing.T) {
 		require.NoError(t, err)
 		assert.Equal(t, []User{}, emptyReturn)
 	})
+	// runs last, since it deletes a User
+	t.Run("list Users excludes deleted Users unless asked", func(t *testing.T) {
+		total, err := CountUsers(UserFilter{}, db)
+		require.NoError(t, err)
+
+		require.NoError(t, user2.Delete(db, cache))
+
+		users, err := ListUsers(UserListParams{}, db)
+		require.NoError(t, err)
+		assert.NotContains(t, getUserIDs(users), user2.ID)
+		count, err := CountUsers(UserFilter{}, db)
+		require.NoError(t, err)
+		assert.Equal(t, total-1, count)
+
+		deleted := UserFilter{IncludeDeleted: true, DeletedAt: &sqlutil.TimeFilter{After: &user2.CreatedAt}}
+		users, err = ListUsers(UserListParams{Filter: deleted}, db)
+		require.NoError(t, err)
+		assert.Equal(t, []int{user2.ID}, getUserIDs(users))
+		count, err = CountUsers(UserFilter{IncludeDeleted: true}, db)
+		require.NoError(t, err)
+		assert.Equal(t, total, count)
+	})
+}
+
+func TestCountUsers(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, db.Reset())
+		assert.NoError(t, cache.Reset())
+	})
+
+	for _, email := range []string{"user0@org.com", "user1@org.com", "user2@other.com"} {
+		user := User{
+			Email:    email,
+			Password: "password",
+		}
+		err := user.Insert(db, cache)
+		require.NoError(t, err)
+	}
+
+	t.Run("count all Users", func(t *testing.T) {
+		count, err := CountUsers(UserFilter{}, db)
+		require.NoError(t, err)
+		assert.Equal(t, 3, count)
+	})
+
+	t.Run("count filtered Users", func(t *testing.T) {
+		filter := UserFilter{
+			Email: &sqlutil.StringFilter{
+				EndsWith: ptrutil.String("@org.com"),
+			},
+		}
+		count, err := CountUsers(filter, db)
+		require.NoError(t, err)
+		assert.Equal(t, 2, count)
+	})
+
+	t.Run("fail to count Users with filter on unknown column", func(t *testing.T) {
+		filter := UserFilter{
+			Language: &sqlutil.StringFilter{
+				Is: ptrutil.String("de"),
+			},
+		}
+		_, err := CountUsers(filter, db)
+		require.Error(t, err)
+		assert.True(t, errors.IsKind(errors.Unprocessable, err))
+	})
+
+	t.Run("fail to count Users with db == failingDB", func(t *testing.T) {
+		_, err := CountUsers(UserFilter{}, failingDB)
+		require.Error(t, err)
+	})
 }
@@ -0,0 +1,109 @@
+package userlib
+
+import (
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/iconmobile-dev/go-core/structs"
+
+	"github.com/iconmobile-dev/go-interview/pkg/validate"
+)
+
+// field length limits
+const (
+	maxEmailLength = 100 // users.email is varchar(100)
+	maxNameLength  = 100
+	// bcrypt ignores everything after the first 72 bytes
+	maxPasswordBytes = 72
+)
+
+// Validate checks all fields of a User with a plain text Password
+// returns an Unprocessable error listing every invalid field
+func (u User) Validate() error {
+	var errs validate.Errors
+	validateEmail(&errs, "Email", u.Email)
+	u.validateProfile(&errs)
+	validatePassword(&errs, "Password", u.Password)
+
+	return validationError(errs)
+}
+
+// ValidatePassword checks a plain text password against the configured password policy
+// returns an Unprocessable error listing every failed rule
+func ValidatePassword(password string) error {
+	var errs validate.Errors
+	validatePassword(&errs, "Password", password)
+
+	return validationError(errs)
+}
+
+// validationError wraps validation errors as Unprocessable error
+func validationError(errs validate.Errors) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errors.E(errs.Err(), errors.Unprocessable, "Params validation error")
+}
+
+func validateEmail(errs *validate.Errors, field string, email string) {
+	switch {
+	case email == "":
+		errs.Add(field, "is required")
+	case len(email) > maxEmailLength:
+		errs.Add(field, "must be at most %d characters long", maxEmailLength)
+	case !structs.IsEmail(email):
+		errs.Add(field, "must be a valid email address")
+	}
+}
+
+func (u User) validateProfile(errs *validate.Errors) {
+	if utf8.RuneCountInString(u.FirstName) > maxNameLength {
+		errs.Add("FirstName", "must be at most %d characters long", maxNameLength)
+	}
+	if utf8.RuneCountInString(u.LastName) > maxNameLength {
+		errs.Add("LastName", "must be at most %d characters long", maxNameLength)
+	}
+}
+
+func validatePassword(errs *validate.Errors, field string, password string) {
+	policy := cfg.Password
+
+	switch {
+	case password == "":
+		errs.Add(field, "is required")
+	case utf8.RuneCountInString(password) < policy.MinLength:
+		errs.Add(field, "must be at least %d characters long", policy.MinLength)
+	case len(password) > maxPasswordBytes:
+		errs.Add(field, "must be at most %d bytes long", maxPasswordBytes)
+	case breachedPasswords.Contains(password):
+		errs.Add(field, "has appeared in a data breach and must not be used")
+	}
+
+	var hasUpper, hasLower, hasDigit, hasSymbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			hasUpper = true
+		case unicode.IsLower(r):
+			hasLower = true
+		case unicode.IsDigit(r):
+			hasDigit = true
+		case unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r):
+			hasSymbol = true
+		}
+	}
+
+	if policy.RequireUpper && !hasUpper {
+		errs.Add(field, "must contain an upper case letter")
+	}
+	if policy.RequireLower && !hasLower {
+		errs.Add(field, "must contain a lower case letter")
+	}
+	if policy.RequireDigit && !hasDigit {
+		errs.Add(field, "must contain a digit")
+	}
+	if policy.RequireSymbol && !hasSymbol {
+		errs.Add(field, "must contain a symbol")
+	}
+}
@@ -0,0 +1,114 @@
+package userlib
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/iconmobile-dev/go-core/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/config"
+	"github.com/iconmobile-dev/go-interview/pkg/validate"
+)
+
+// mustFieldErrors returns the validation errors of err
+func mustFieldErrors(t *testing.T, err error) validate.Errors {
+	require.Error(t, err)
+	require.True(t, errors.IsKind(errors.Unprocessable, err))
+
+	var fieldErrs validate.Errors
+	require.True(t, errors.As(err, &fieldErrs))
+	return fieldErrs
+}
+
+func TestUserValidate(t *testing.T) {
+	validUser := User{
+		Email:     "user0@org.com",
+		Password:  "password",
+		FirstName: "firstname0",
+		LastName:  "lastname0",
+	}
+
+	t.Run("validate valid User", func(t *testing.T) {
+		assert.NoError(t, validUser.Validate())
+	})
+
+	t.Run("validate invalid User with every field invalid", func(t *testing.T) {
+		user := validUser
+		user.Email = "not an email"
+		user.Password = ""
+		user.FirstName = strings.Repeat("a", maxNameLength+1)
+		user.LastName = strings.Repeat("a", maxNameLength+1)
+
+		fieldErrs := mustFieldErrors(t, user.Validate())
+
+		fields := []string{}
+		for _, fe := range fieldErrs {
+			fields = append(fields, fe.Field)
+		}
+		assert.ElementsMatch(t, []string{"Email", "Password", "FirstName", "LastName"}, fields)
+	})
+
+	t.Run("validate invalid User with .Email too long", func(t *testing.T) {
+		user := validUser
+		user.Email = strings.Repeat("a", maxEmailLength) + "@org.com"
+
+		fieldErrs := mustFieldErrors(t, user.Validate())
+		require.Len(t, fieldErrs, 1)
+		assert.Equal(t, "Email", fieldErrs[0].Field)
+	})
+
+	t.Run("validate invalid User with .Email empty", func(t *testing.T) {
+		user := validUser
+		user.Email = ""
+
+		fieldErrs := mustFieldErrors(t, user.Validate())
+		require.Len(t, fieldErrs, 1)
+		assert.Equal(t, "is required", fieldErrs[0].Msg)
+	})
+}
+
+func TestValidatePassword(t *testing.T) {
+	defaultPolicy := cfg.Password
+	t.Cleanup(func() {
+		cfg.Password = defaultPolicy
+	})
+
+	cfg.Password = config.Password{
+		MinLength:     10,
+		RequireUpper:  true,
+		RequireLower:  true,
+		RequireDigit:  true,
+		RequireSymbol: true,
+	}
+
+	t.Run("validate valid password", func(t *testing.T) {
+		assert.NoError(t, ValidatePassword("Pass word 1!"))
+	})
+
+	t.Run("validate invalid password too short", func(t *testing.T) {
+		fieldErrs := mustFieldErrors(t, ValidatePassword("Pa1!"))
+		require.Len(t, fieldErrs, 1)
+		assert.Equal(t, "must be at least 10 characters long", fieldErrs[0].Msg)
+	})
+
+	t.Run("validate invalid password longer than 72 bytes", func(t *testing.T) {
+		fieldErrs := mustFieldErrors(t, ValidatePassword("Pa1!"+strings.Repeat("ä", 36)))
+		require.Len(t, fieldErrs, 1)
+		assert.Equal(t, "must be at most 72 bytes long", fieldErrs[0].Msg)
+	})
+
+	t.Run("validate invalid password without character classes", func(t *testing.T) {
+		fieldErrs := mustFieldErrors(t, ValidatePassword("          "))
+		assert.Len(t, fieldErrs, 3)
+
+		fieldErrs = mustFieldErrors(t, ValidatePassword("password_without_upper_and_digit"))
+		assert.Len(t, fieldErrs, 2)
+	})
+
+	t.Run("validate invalid empty password", func(t *testing.T) {
+		fieldErrs := mustFieldErrors(t, ValidatePassword(""))
+		assert.Equal(t, "is required", fieldErrs[0].Msg)
+	})
+}
@@ -0,0 +1,112 @@
+// Package hibp looks up passwords in a local copy of the Have I Been Pwned password list.
+// The list is a text file with one upper case SHA-1 hash and its breach count per line,
+// sorted by hash, like the output of the HIBP downloader:
+//
+//	000000005AD76BD555C1D6D771DE417A4B87E4B4:10
+//	00000000A8DAE4228F821FB418F59826079BF368:4
+//
+// Range API responses are not supported, they lack the first 5 characters of the hashes.
+//
+// The file is memory-mapped and searched in place, so that the service does not
+// need network access and the list does not have to fit into the heap.
+// On systems without mmap support the file is read into memory instead.
+package hibp
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// hashLength is the length of a hex encoded SHA-1 hash
+const hashLength = 2 * sha1.Size
+
+// List is a memory-mapped password list, a nil List contains no passwords
+type List struct {
+	data []byte
+}
+
+// Open maps the sorted list at path into memory, the caller should call Close when finished
+func Open(path string) (*List, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	// empty files can't be mapped
+	if info.Size() == 0 {
+		return &List{}, nil
+	}
+	if int64(int(info.Size())) != info.Size() {
+		return nil, fmt.Errorf("hibp: %s is too large to map", path)
+	}
+
+	data, err := mapFile(f, int(info.Size()))
+	if err != nil {
+		return nil, fmt.Errorf("hibp: mapping %s: %w", path, err)
+	}
+
+	return &List{data: data}, nil
+}
+
+// Close unmaps the list
+func (l *List) Close() error {
+	if l == nil || l.data == nil {
+		return nil
+	}
+	data := l.data
+	l.data = nil
+	return unmapFile(data)
+}
+
+// Contains returns true if the password is in the list
+func (l *List) Contains(password string) bool {
+	sum := sha1.Sum([]byte(password))
+	return l.ContainsHash(hex.EncodeToString(sum[:]))
+}
+
+// ContainsHash returns true if the hex encoded SHA-1 hash is in the list
+func (l *List) ContainsHash(hash string) bool {
+	if l == nil || len(hash) != hashLength {
+		return false
+	}
+	key := []byte(strings.ToUpper(hash))
+
+	// binary search over the bytes, each probe is moved to the start of its line
+	lo, hi := 0, len(l.data)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start := bytes.LastIndexByte(l.data[lo:mid], '\n') + 1 + lo
+		end := bytes.IndexByte(l.data[start:hi], '\n')
+		if end < 0 {
+			end = hi
+		} else {
+			end += start
+		}
+
+		line := l.data[start:end]
+		if len(line) > hashLength {
+			line = line[:hashLength]
+		}
+
+		switch bytes.Compare(line, key) {
+		case 0:
+			return true
+		case -1:
+			lo = end + 1
+		default:
+			hi = start
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,87 @@
+package hibp
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mustWriteList writes a sorted list of the passwords and returns its path
+func mustWriteList(t *testing.T, lineEnding string, passwords ...string) string {
+	var lines []string
+	for i, p := range passwords {
+		sum := sha1.Sum([]byte(p))
+		lines = append(lines, fmt.Sprintf("%s:%d", strings.ToUpper(hex.EncodeToString(sum[:])), i+1))
+	}
+	sort.Strings(lines)
+
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	err := os.WriteFile(path, []byte(strings.Join(lines, lineEnding)+lineEnding), 0o600)
+	require.NoError(t, err)
+	return path
+}
+
+func TestList(t *testing.T) {
+	breached := []string{"password", "123456", "qwerty", "letmein", "hunter2", "correct horse battery staple"}
+	for i := 0; i < 200; i++ {
+		breached = append(breached, fmt.Sprintf("breached%d", i))
+	}
+
+	for name, lineEnding := range map[string]string{"LF": "\n", "CRLF": "\r\n"} {
+		t.Run(name, func(t *testing.T) {
+			l, err := Open(mustWriteList(t, lineEnding, breached...))
+			require.NoError(t, err)
+			defer l.Close()
+
+			for _, p := range breached {
+				assert.True(t, l.Contains(p), p)
+			}
+			for _, p := range []string{"", "Password", "not breached", "breached200", "zzzzzzzzzzzz"} {
+				assert.False(t, l.Contains(p), p)
+			}
+
+			// hashes are case-insensitive
+			assert.True(t, l.ContainsHash("5baa61e4c9b93f3f0682250b6cf8331b7ee68fd8"))
+			assert.False(t, l.ContainsHash("5BAA61E4"))
+		})
+	}
+}
+
+func TestListSingleLineWithoutTrailingNewline(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwned-passwords.txt")
+	require.NoError(t, os.WriteFile(path, []byte("5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:3730471"), 0o600))
+
+	l, err := Open(path)
+	require.NoError(t, err)
+	defer l.Close()
+
+	assert.True(t, l.Contains("password"))
+	assert.False(t, l.Contains("123456"))
+}
+
+func TestListEmptyAndNil(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "empty.txt")
+	require.NoError(t, os.WriteFile(path, nil, 0o600))
+
+	l, err := Open(path)
+	require.NoError(t, err)
+	assert.False(t, l.Contains("password"))
+	assert.NoError(t, l.Close())
+
+	var nilList *List
+	assert.False(t, nilList.Contains("password"))
+	assert.NoError(t, nilList.Close())
+}
+
+func TestOpenMissingFile(t *testing.T) {
+	_, err := Open(filepath.Join(t.TempDir(), "missing.txt"))
+	assert.Error(t, err)
+}
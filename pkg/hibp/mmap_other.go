@@ -0,0 +1,24 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package hibp
+
+import (
+	"io"
+	"os"
+)
+
+// mapFile reads size bytes of the file into memory, the system has no mmap support
+func mapFile(f *os.File, size int) ([]byte, error) {
+	data := make([]byte, size)
+	_, err := io.ReadFull(f, data)
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// unmapFile releases the memory of mapFile, the garbage collector frees it
+func unmapFile(data []byte) error {
+	return nil
+}
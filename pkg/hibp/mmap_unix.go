@@ -0,0 +1,19 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package hibp
+
+import (
+	"os"
+	"syscall"
+)
+
+// mapFile maps size bytes of the file read-only into memory
+func mapFile(f *os.File, size int) ([]byte, error) {
+	return syscall.Mmap(int(f.Fd()), 0, size, syscall.PROT_READ, syscall.MAP_SHARED)
+}
+
+// unmapFile releases the memory of mapFile
+func unmapFile(data []byte) error {
+	return syscall.Munmap(data)
+}
@@ -0,0 +1,143 @@
+// Package jwtutil signs and verifies HS256 JSON Web Tokens (RFC 7519)
+package jwtutil
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// ErrInvalid is returned if a token is malformed or its signature does not match
+var ErrInvalid = errors.New("token is invalid")
+
+// ErrExpired is returned if a token is past its expiry
+var ErrExpired = errors.New("token is expired")
+
+// ErrUnknownKey is returned if a token was signed with a key ID missing in the Keyring
+var ErrUnknownKey = errors.New("token key is unknown")
+
+// algorithm is the only supported signing algorithm
+const algorithm = "HS256"
+
+// header is the JOSE header of a token
+type header struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+	Kid string `json:"kid,omitempty"`
+}
+
+// Keyring holds the keys by key ID, tokens are signed with the active key
+// and verified with the key of the ID in their header.
+// Tokens without key ID are verified with the key of the empty ID
+type Keyring struct {
+	ActiveID string
+	Keys     map[string][]byte
+}
+
+// Claims are the registered claims used by the services,
+// embed it into a struct to add private claims
+type Claims struct {
+	Subject   string `json:"sub,omitempty"`
+	ID        string `json:"jti,omitempty"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// now returns the current time, replaced in tests
+var now = time.Now
+
+// Sign encodes the claims as JSON and returns the token signed with the key
+func Sign(claims interface{}, key []byte) (string, error) {
+	return Keyring{Keys: map[string][]byte{"": key}}.Sign(claims)
+}
+
+// Verify checks the signature and expiry of a token signed by Sign and decodes its claims
+func Verify(token string, key []byte, claims interface{}) error {
+	return Keyring{Keys: map[string][]byte{"": key}}.Verify(token, claims)
+}
+
+// Sign encodes the claims as JSON and returns the token signed with the active key
+func (k Keyring) Sign(claims interface{}) (string, error) {
+	key, ok := k.Keys[k.ActiveID]
+	if !ok {
+		return "", ErrUnknownKey
+	}
+
+	h, err := json.Marshal(header{Alg: algorithm, Typ: "JWT", Kid: k.ActiveID})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signingInput := encode(h) + "." + encode(payload)
+	return signingInput + "." + encode(sign(signingInput, key)), nil
+}
+
+// Verify checks the signature and expiry of the token and decodes its claims
+// returns ErrInvalid, ErrUnknownKey or ErrExpired if the token must not be accepted
+func (k Keyring) Verify(token string, claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ErrInvalid
+	}
+
+	// check the header before trusting the signature, only HS256 is accepted
+	var h header
+	if err := decodeJSON(parts[0], &h); err != nil || h.Alg != algorithm {
+		return ErrInvalid
+	}
+	key, ok := k.Keys[h.Kid]
+	if !ok {
+		return ErrUnknownKey
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return ErrInvalid
+	}
+	if !hmac.Equal(signature, sign(parts[0]+"."+parts[1], key)) {
+		return ErrInvalid
+	}
+
+	var registered Claims
+	if err := decodeJSON(parts[1], &registered); err != nil {
+		return ErrInvalid
+	}
+	if registered.ExpiresAt != 0 && now().Unix() >= registered.ExpiresAt {
+		return ErrExpired
+	}
+
+	if err := decodeJSON(parts[1], claims); err != nil {
+		return ErrInvalid
+	}
+
+	return nil
+}
+
+// sign returns the HMAC-SHA256 of the signing input
+func sign(signingInput string, key []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(signingInput))
+	return mac.Sum(nil)
+}
+
+// encode returns the unpadded base64url encoding of b
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decodeJSON decodes an unpadded base64url encoded JSON object into v
+func decodeJSON(s string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
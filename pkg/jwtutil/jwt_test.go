@@ -0,0 +1,140 @@
+package jwtutil
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testClaims struct {
+	Claims
+	Role int `json:"role"`
+}
+
+func TestSignAndVerify(t *testing.T) {
+	key := []byte("secret")
+	claims := testClaims{
+		Claims: Claims{
+			Subject:   "1",
+			ExpiresAt: time.Now().Add(time.Minute).Unix(),
+		},
+		Role: 50,
+	}
+
+	token, err := Sign(claims, key)
+	require.NoError(t, err)
+	assert.Equal(t, 2, strings.Count(token, "."))
+
+	t.Run("verify valid token", func(t *testing.T) {
+		var verified testClaims
+		err := Verify(token, key, &verified)
+		require.NoError(t, err)
+		assert.Equal(t, claims, verified)
+	})
+
+	t.Run("verify invalid token with other key", func(t *testing.T) {
+		var verified testClaims
+		err := Verify(token, []byte("other secret"), &verified)
+		assert.Equal(t, ErrInvalid, err)
+	})
+
+	t.Run("verify invalid token with modified payload", func(t *testing.T) {
+		other, err := Sign(testClaims{Claims: claims.Claims, Role: 100}, []byte("other secret"))
+		require.NoError(t, err)
+
+		parts := strings.Split(token, ".")
+		otherParts := strings.Split(other, ".")
+		modified := parts[0] + "." + otherParts[1] + "." + parts[2]
+
+		var verified testClaims
+		err = Verify(modified, key, &verified)
+		assert.Equal(t, ErrInvalid, err)
+	})
+
+	t.Run("verify invalid token with alg none", func(t *testing.T) {
+		parts := strings.Split(token, ".")
+		none := encode([]byte(`{"alg":"none","typ":"JWT"}`)) + "." + parts[1] + "."
+
+		var verified testClaims
+		err := Verify(none, key, &verified)
+		assert.Equal(t, ErrInvalid, err)
+	})
+
+	t.Run("verify invalid malformed tokens", func(t *testing.T) {
+		for _, malformed := range []string{"", "a.b", "a.b.c", "a.b.c.d"} {
+			var verified testClaims
+			err := Verify(malformed, key, &verified)
+			assert.Equal(t, ErrInvalid, err, malformed)
+		}
+	})
+
+	t.Run("verify expired token", func(t *testing.T) {
+		defer func() { now = time.Now }()
+		now = func() time.Time { return time.Now().Add(2 * time.Minute) }
+
+		var verified testClaims
+		err := Verify(token, key, &verified)
+		assert.Equal(t, ErrExpired, err)
+	})
+}
+
+func TestKeyring(t *testing.T) {
+	claims := Claims{Subject: "1"}
+	oldKeyring := Keyring{
+		ActiveID: "k1",
+		Keys:     map[string][]byte{"k1": []byte("secret1")},
+	}
+	keyring := Keyring{
+		ActiveID: "k2",
+		Keys: map[string][]byte{
+			"k1": []byte("secret1"),
+			"k2": []byte("secret2"),
+		},
+	}
+
+	t.Run("sign valid token with active key", func(t *testing.T) {
+		token, err := keyring.Sign(claims)
+		require.NoError(t, err)
+
+		h := header{}
+		require.NoError(t, decodeJSON(strings.Split(token, ".")[0], &h))
+		assert.Equal(t, "k2", h.Kid)
+
+		var verified Claims
+		require.NoError(t, keyring.Verify(token, &verified))
+		assert.Equal(t, claims, verified)
+	})
+
+	t.Run("verify valid token of older key", func(t *testing.T) {
+		token, err := oldKeyring.Sign(claims)
+		require.NoError(t, err)
+
+		var verified Claims
+		assert.NoError(t, keyring.Verify(token, &verified))
+	})
+
+	t.Run("verify invalid token of removed key", func(t *testing.T) {
+		token, err := keyring.Sign(claims)
+		require.NoError(t, err)
+
+		var verified Claims
+		assert.Equal(t, ErrUnknownKey, oldKeyring.Verify(token, &verified))
+	})
+
+	t.Run("verify invalid token with other key of same ID", func(t *testing.T) {
+		token, err := keyring.Sign(claims)
+		require.NoError(t, err)
+
+		other := Keyring{Keys: map[string][]byte{"k2": []byte("other")}}
+		var verified Claims
+		assert.Equal(t, ErrInvalid, other.Verify(token, &verified))
+	})
+
+	t.Run("fail to sign without active key", func(t *testing.T) {
+		_, err := Keyring{ActiveID: "k3", Keys: keyring.Keys}.Sign(claims)
+		assert.Equal(t, ErrUnknownKey, err)
+	})
+}
@@ -0,0 +1,467 @@
+// Package oidc implements an OpenID Connect relying party:
+// discovery, the authorization code flow with PKCE (RFC 7636)
+// and the validation of ID tokens against the JWKS of the provider
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrInvalid is returned if an ID token is malformed, its signature does not match
+// or its claims were not issued for this relying party
+var ErrInvalid = errors.New("id token is invalid")
+
+// ErrExpired is returned if an ID token is past its expiry
+var ErrExpired = errors.New("id token is expired")
+
+// leeway tolerates clock differences to the provider
+const leeway = time.Minute
+
+// maxResponseBytes limits the size of responses read from the provider
+const maxResponseBytes = 1 << 20
+
+// now returns the current time, replaced in tests
+var now = time.Now
+
+// Config of the relying party registered at the provider
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string // "openid" is always requested
+}
+
+// Metadata is the part of the provider metadata (OpenID Connect Discovery 1.0) used by the relying party
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDToken contains the validated claims of an ID token
+type IDToken struct {
+	Issuer        string   `json:"iss"`
+	Subject       string   `json:"sub"`
+	Audience      Audience `json:"aud"`
+	AuthorizedBy  string   `json:"azp,omitempty"`
+	ExpiresAt     int64    `json:"exp"`
+	IssuedAt      int64    `json:"iat"`
+	Nonce         string   `json:"nonce,omitempty"`
+	Email         string   `json:"email,omitempty"`
+	EmailVerified bool     `json:"email_verified,omitempty"`
+	GivenName     string   `json:"given_name,omitempty"`
+	FamilyName    string   `json:"family_name,omitempty"`
+}
+
+// Audience is the aud claim, which is either a string or an array of strings
+type Audience []string
+
+// UnmarshalJSON decodes a string or an array of strings
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var single string
+	if err := json.Unmarshal(b, &single); err == nil {
+		*a = Audience{single}
+		return nil
+	}
+
+	var multiple []string
+	if err := json.Unmarshal(b, &multiple); err != nil {
+		return err
+	}
+	*a = multiple
+	return nil
+}
+
+// contains returns true if the audience includes the client ID
+func (a Audience) contains(clientID string) bool {
+	for _, aud := range a {
+		if aud == clientID {
+			return true
+		}
+	}
+	return false
+}
+
+// TokenResponse is the response of the token endpoint
+type TokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+}
+
+// Provider is an OpenID provider discovered for the relying party Config
+// it is safe for concurrent use
+type Provider struct {
+	Config   Config
+	Metadata Metadata
+
+	client *http.Client
+
+	mu   sync.RWMutex
+	keys map[string]crypto.PublicKey // by key ID
+}
+
+// NewProvider discovers the provider of the configured issuer and loads its keys,
+// the http.DefaultClient is used if client is nil
+func NewProvider(ctx context.Context, config Config, client *http.Client) (*Provider, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	p := &Provider{Config: config, client: client}
+
+	discoveryURL := strings.TrimSuffix(config.Issuer, "/") + "/.well-known/openid-configuration"
+	err := p.getJSON(ctx, discoveryURL, &p.Metadata)
+	if err != nil {
+		return nil, fmt.Errorf("discovery failed: %w", err)
+	}
+
+	// the metadata must be issued for the configured issuer, see section 4.3 of the discovery spec
+	if p.Metadata.Issuer != config.Issuer {
+		return nil, fmt.Errorf("discovery failed: issuer %q does not match %q", p.Metadata.Issuer, config.Issuer)
+	}
+	if p.Metadata.AuthorizationEndpoint == "" || p.Metadata.TokenEndpoint == "" || p.Metadata.JWKSURI == "" {
+		return nil, fmt.Errorf("discovery failed: endpoints are missing")
+	}
+
+	err = p.loadKeys(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return p, nil
+}
+
+// AuthCodeURL returns the URL of the provider the User is sent to for the login
+// the state and nonce must be random and are checked on the callback,
+// the code verifier is sent as S256 challenge, see NewCodeVerifier
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	scopes := []string{"openid"}
+	for _, scope := range p.Config.Scopes {
+		if scope != "openid" {
+			scopes = append(scopes, scope)
+		}
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.Config.ClientID},
+		"redirect_uri":          {p.Config.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {CodeChallenge(codeVerifier)},
+		"code_challenge_method": {"S256"},
+	}
+
+	separator := "?"
+	if strings.Contains(p.Metadata.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+	return p.Metadata.AuthorizationEndpoint + separator + params.Encode()
+}
+
+// Exchange redeems the authorization code at the token endpoint
+// returns an error if the provider rejects the code or returns no ID token
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (TokenResponse, error) {
+	var token TokenResponse
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.Config.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", p.Metadata.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return token, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.Config.ClientID), url.QueryEscape(p.Config.ClientSecret))
+
+	err = p.doJSON(req, &token)
+	if err != nil {
+		return token, fmt.Errorf("code exchange failed: %w", err)
+	}
+	if token.IDToken == "" {
+		return token, fmt.Errorf("code exchange failed: no id_token returned")
+	}
+
+	return token, nil
+}
+
+// VerifyIDToken checks the signature of the ID token against the keys of the provider
+// and validates its issuer, audience, expiry and nonce
+// returns ErrInvalid or ErrExpired if the token must not be accepted
+func (p *Provider) VerifyIDToken(ctx context.Context, rawIDToken, nonce string) (IDToken, error) {
+	var token IDToken
+
+	parts := strings.Split(rawIDToken, ".")
+	if len(parts) != 3 {
+		return token, ErrInvalid
+	}
+
+	var h struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJSON(parts[0], &h); err != nil {
+		return token, ErrInvalid
+	}
+
+	key, err := p.key(ctx, h.Kid)
+	if err != nil {
+		return token, err
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return token, ErrInvalid
+	}
+	if !verifySignature(h.Alg, key, parts[0]+"."+parts[1], signature) {
+		return token, ErrInvalid
+	}
+
+	if err := decodeJSON(parts[1], &token); err != nil {
+		return IDToken{}, ErrInvalid
+	}
+
+	switch {
+	case token.Issuer != p.Config.Issuer:
+		return IDToken{}, fmt.Errorf("%w: issuer %q", ErrInvalid, token.Issuer)
+	case !token.Audience.contains(p.Config.ClientID):
+		return IDToken{}, fmt.Errorf("%w: audience %v", ErrInvalid, token.Audience)
+	case len(token.Audience) > 1 && token.AuthorizedBy != p.Config.ClientID:
+		return IDToken{}, fmt.Errorf("%w: authorized party %q", ErrInvalid, token.AuthorizedBy)
+	case token.Subject == "":
+		return IDToken{}, fmt.Errorf("%w: subject is missing", ErrInvalid)
+	case token.Nonce != nonce:
+		return IDToken{}, fmt.Errorf("%w: nonce does not match", ErrInvalid)
+	case token.IssuedAt > now().Add(leeway).Unix():
+		return IDToken{}, fmt.Errorf("%w: issued in the future", ErrInvalid)
+	case token.ExpiresAt == 0 || now().Add(-leeway).Unix() >= token.ExpiresAt:
+		return IDToken{}, ErrExpired
+	}
+
+	return token, nil
+}
+
+// NewCodeVerifier returns a random PKCE code verifier
+func NewCodeVerifier() (string, error) {
+	return randomString(32)
+}
+
+// NewState returns a random value usable as state or nonce
+func NewState() (string, error) {
+	return randomString(24)
+}
+
+// CodeChallenge returns the S256 challenge of the PKCE code verifier
+func CodeChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// key returns the public key with the key ID,
+// the keys are reloaded once if the key is unknown since the provider might have rotated them
+func (p *Provider) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	p.mu.RLock()
+	key, ok := p.keys[kid]
+	p.mu.RUnlock()
+	if ok {
+		return key, nil
+	}
+
+	if err := p.loadKeys(ctx); err != nil {
+		return nil, err
+	}
+
+	p.mu.RLock()
+	key, ok = p.keys[kid]
+	p.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown key %q", ErrInvalid, kid)
+	}
+	return key, nil
+}
+
+// loadKeys replaces the keys by the JWKS of the provider
+func (p *Provider) loadKeys(ctx context.Context) error {
+	var jwks struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	err := p.getJSON(ctx, p.Metadata.JWKSURI, &jwks)
+	if err != nil {
+		return fmt.Errorf("loading keys failed: %w", err)
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := jwk.publicKey()
+		if err != nil {
+			// keys of unsupported types are skipped
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+
+	return nil
+}
+
+// getJSON decodes the JSON response of a GET request
+func (p *Provider) getJSON(ctx context.Context, u string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	return p.doJSON(req, v)
+}
+
+// doJSON sends the request and decodes the JSON response
+// returns an error if the response status is not 200
+func (p *Provider) doJSON(req *http.Request, v interface{}) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d: %s", req.URL.Redacted(), resp.StatusCode, body)
+	}
+
+	return json.Unmarshal(body, v)
+}
+
+// jsonWebKey is a public key of a JWKS (RFC 7517), RSA and P-256 keys are supported
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the key
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() {
+			return nil, fmt.Errorf("invalid rsa exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		if !key.Curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("invalid ec point")
+		}
+		return key, nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+// verifySignature checks the RS256 or ES256 signature of the signing input
+// the algorithm must match the type of the key, so that a key can't be used with another algorithm
+func verifySignature(alg string, key crypto.PublicKey, signingInput string, signature []byte) bool {
+	digest := sha256.Sum256([]byte(signingInput))
+
+	switch alg {
+	case "RS256":
+		rsaKey, ok := key.(*rsa.PublicKey)
+		return ok && rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest[:], signature) == nil
+	case "ES256":
+		ecKey, ok := key.(*ecdsa.PublicKey)
+		if !ok || len(signature) != 64 {
+			return false
+		}
+		r := new(big.Int).SetBytes(signature[:32])
+		s := new(big.Int).SetBytes(signature[32:])
+		return ecdsa.Verify(ecKey, digest[:], r, s)
+	}
+
+	return false
+}
+
+// decodeJSON decodes a base64url encoded JSON segment of a token
+func decodeJSON(segment string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(b, v)
+}
+
+// decodeBigInt decodes a base64url encoded unsigned big-endian integer
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid key parameter")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// randomString returns n random bytes base64url encoded
+func randomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,171 @@
+package oidc
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/pkg/oidc/oidctest"
+)
+
+// mustAuthorize follows the authorization URL to the stand-in provider
+// and returns the code and state of the redirect
+func mustAuthorize(t *testing.T, authURL string) (string, string) {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func TestProvider(t *testing.T) {
+	idp := oidctest.NewServer("gateway", "secret")
+	defer idp.Close()
+
+	user := oidctest.User{Subject: "42", Email: "jane@example.com", EmailVerified: true, GivenName: "Jane"}
+	idp.SetUser(user)
+
+	ctx := context.Background()
+	config := Config{
+		Issuer:       idp.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:3000/oidc-callback",
+		Scopes:       []string{"email", "profile"},
+	}
+	p, err := NewProvider(ctx, config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, idp.URL+"/token", p.Metadata.TokenEndpoint)
+
+	t.Run("valid authorization code flow", func(t *testing.T) {
+		verifier, err := NewCodeVerifier()
+		require.NoError(t, err)
+		authURL := p.AuthCodeURL("state1", "nonce1", verifier)
+		assert.Contains(t, authURL, "scope=openid+email+profile")
+		assert.Contains(t, authURL, "code_challenge="+CodeChallenge(verifier))
+
+		code, state := mustAuthorize(t, authURL)
+		assert.Equal(t, "state1", state)
+
+		token, err := p.Exchange(ctx, code, verifier)
+		require.NoError(t, err)
+
+		idToken, err := p.VerifyIDToken(ctx, token.IDToken, "nonce1")
+		require.NoError(t, err)
+		assert.Equal(t, user.Subject, idToken.Subject)
+		assert.Equal(t, user.Email, idToken.Email)
+		assert.True(t, idToken.EmailVerified)
+		assert.Equal(t, user.GivenName, idToken.GivenName)
+
+		// codes are single-use
+		_, err = p.Exchange(ctx, code, verifier)
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid code verifier", func(t *testing.T) {
+		verifier, err := NewCodeVerifier()
+		require.NoError(t, err)
+		code, _ := mustAuthorize(t, p.AuthCodeURL("state", "nonce", verifier))
+
+		_, err = p.Exchange(ctx, code, verifier+"x")
+		assert.Error(t, err)
+	})
+
+	t.Run("invalid id tokens", func(t *testing.T) {
+		now := time.Now()
+		valid := map[string]interface{}{
+			"iss":   idp.URL,
+			"sub":   "42",
+			"aud":   "gateway",
+			"iat":   now.Unix(),
+			"exp":   now.Add(time.Hour).Unix(),
+			"nonce": "nonce",
+		}
+		with := func(key string, value interface{}) map[string]interface{} {
+			claims := map[string]interface{}{}
+			for k, v := range valid {
+				claims[k] = v
+			}
+			claims[key] = value
+			return claims
+		}
+
+		_, err := p.VerifyIDToken(ctx, idp.Sign(valid), "nonce")
+		require.NoError(t, err)
+
+		_, err = p.VerifyIDToken(ctx, idp.Sign(with("aud", []string{"other", "gateway"})), "nonce")
+		assert.ErrorIs(t, err, ErrInvalid, "multiple audiences without azp")
+
+		tests := []struct {
+			name   string
+			token  string
+			nonce  string
+			expect error
+		}{
+			{"other issuer", idp.Sign(with("iss", "https://evil.example.com")), "nonce", ErrInvalid},
+			{"other audience", idp.Sign(with("aud", "other")), "nonce", ErrInvalid},
+			{"missing subject", idp.Sign(with("sub", "")), "nonce", ErrInvalid},
+			{"other nonce", idp.Sign(valid), "other", ErrInvalid},
+			{"expired", idp.Sign(with("exp", now.Add(-time.Hour).Unix())), "nonce", ErrExpired},
+			{"issued in the future", idp.Sign(with("iat", now.Add(time.Hour).Unix())), "nonce", ErrInvalid},
+			{"malformed", "not.a.token", "nonce", ErrInvalid},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := p.VerifyIDToken(ctx, tt.token, tt.nonce)
+				assert.ErrorIs(t, err, tt.expect)
+			})
+		}
+	})
+
+	t.Run("invalid signature", func(t *testing.T) {
+		other := oidctest.NewServer("gateway", "secret")
+		defer other.Close()
+
+		token := other.IDToken(user, "nonce")
+		parts := strings.Split(token, ".")
+		signedByIDP := strings.Split(idp.IDToken(user, "nonce"), ".")
+
+		_, err := p.VerifyIDToken(ctx, parts[0]+"."+signedByIDP[1]+"."+parts[2], "nonce")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+
+	t.Run("algorithm none", func(t *testing.T) {
+		parts := strings.Split(idp.IDToken(user, "nonce"), ".")
+		header := "eyJhbGciOiJub25lIiwia2lkIjoidGVzdC1rZXkifQ" // {"alg":"none","kid":"test-key"}
+
+		_, err := p.VerifyIDToken(ctx, header+"."+parts[1]+".", "nonce")
+		assert.ErrorIs(t, err, ErrInvalid)
+	})
+}
+
+func TestNewProviderIssuerMismatch(t *testing.T) {
+	idp := oidctest.NewServer("gateway", "secret")
+	defer idp.Close()
+
+	_, err := NewProvider(context.Background(), Config{Issuer: idp.URL + "/other"}, nil)
+	assert.Error(t, err)
+}
+
+func TestAudienceUnmarshalJSON(t *testing.T) {
+	var a Audience
+	require.NoError(t, a.UnmarshalJSON([]byte(`"gateway"`)))
+	assert.Equal(t, Audience{"gateway"}, a)
+
+	require.NoError(t, a.UnmarshalJSON([]byte(`["gateway","other"]`)))
+	assert.Equal(t, Audience{"gateway", "other"}, a)
+
+	assert.Error(t, a.UnmarshalJSON([]byte(`42`)))
+}
@@ -0,0 +1,97 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// rfcSecret is the secret of the RFC 4226 and RFC 6238 test vectors
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226 Appendix D
+	expected := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	for counter, code := range expected {
+		assert.Equal(t, code, hotp([]byte("12345678901234567890"), uint64(counter)))
+	}
+}
+
+func TestCode(t *testing.T) {
+	// RFC 6238 Appendix B SHA1 vectors, the last 6 of 8 digits
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, expected := range vectors {
+		code, err := Code(rfcSecret, time.Unix(unix, 0))
+		require.NoError(t, err)
+		assert.Equal(t, expected, code, unix)
+	}
+
+	_, err := Code("not base32!", time.Now())
+	assert.Error(t, err)
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	code, err := Code(rfcSecret, now)
+	require.NoError(t, err)
+
+	t.Run("validate valid code", func(t *testing.T) {
+		counter, ok := Validate(rfcSecret, code, now, 1)
+		assert.True(t, ok)
+		assert.Equal(t, Counter(now), counter)
+
+		_, ok = Validate(strings.ToLower(rfcSecret), code, now, 1)
+		assert.True(t, ok)
+	})
+
+	t.Run("validate valid code within skew", func(t *testing.T) {
+		_, ok := Validate(rfcSecret, code, now.Add(Period), 1)
+		assert.True(t, ok)
+		_, ok = Validate(rfcSecret, code, now.Add(-Period), 1)
+		assert.True(t, ok)
+	})
+
+	t.Run("validate invalid code outside of skew", func(t *testing.T) {
+		_, ok := Validate(rfcSecret, code, now.Add(2*Period), 1)
+		assert.False(t, ok)
+		_, ok = Validate(rfcSecret, code, now.Add(Period), 0)
+		assert.False(t, ok)
+	})
+
+	t.Run("validate invalid codes", func(t *testing.T) {
+		for _, invalid := range []string{"", "12345", "1234567", "000000"} {
+			_, ok := Validate(rfcSecret, invalid, now, 1)
+			assert.False(t, ok, invalid)
+		}
+	})
+}
+
+func TestGenerateSecret(t *testing.T) {
+	secret0, err := GenerateSecret()
+	require.NoError(t, err)
+	secret1, err := GenerateSecret()
+	require.NoError(t, err)
+	assert.NotEqual(t, secret0, secret1)
+
+	key, err := decodeSecret(secret0)
+	require.NoError(t, err)
+	assert.Len(t, key, secretSize)
+}
+
+func TestURI(t *testing.T) {
+	uri := URI("Gateway", "user@org.com", "ABC")
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/Gateway:user@org.com?"))
+	assert.Contains(t, uri, "secret=ABC")
+	assert.Contains(t, uri, "issuer=Gateway")
+	assert.Contains(t, uri, "digits=6")
+}
@@ -0,0 +1,41 @@
+// Package validate collects validation errors of request or struct fields
+package validate
+
+import (
+	"fmt"
+	"strings"
+)
+
+// FieldError describes why a field is invalid
+type FieldError struct {
+	Field string
+	Msg   string
+}
+
+// Errors is a list of FieldErrors which can be returned as error
+type Errors []FieldError
+
+// Add appends a FieldError with a formatted message
+func (e *Errors) Add(field string, format string, args ...interface{}) {
+	*e = append(*e, FieldError{
+		Field: field,
+		Msg:   fmt.Sprintf(format, args...),
+	})
+}
+
+// Err returns the Errors as error or nil if there are none
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Error lists all FieldErrors
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, fe := range e {
+		msgs = append(msgs, fmt.Sprintf("%s %s", fe.Field, fe.Msg))
+	}
+	return strings.Join(msgs, ", ")
+}
@@ -0,0 +1,28 @@
+package validate
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrors(t *testing.T) {
+	t.Run("no Errors", func(t *testing.T) {
+		var errs Errors
+		assert.NoError(t, errs.Err())
+	})
+
+	t.Run("multiple Errors", func(t *testing.T) {
+		var errs Errors
+		errs.Add("Email", "must be a valid email address")
+		errs.Add("Password", "must be at least %d characters long", 8)
+
+		err := errs.Err()
+		assert.Error(t, err)
+		assert.Equal(t, "Email must be a valid email address, Password must be at least 8 characters long", err.Error())
+		assert.Equal(t, Errors{
+			{Field: "Email", Msg: "must be a valid email address"},
+			{Field: "Password", Msg: "must be at least 8 characters long"},
+		}, errs)
+	})
+}
@@ -0,0 +1,132 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+type apiKeyCreateRequest struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
+
+type apiKeyCreateResponse struct {
+	APIKey userlib.APIKey
+	Key    string
+}
+
+type apiKeyListResponse struct {
+	APIKeys []userlib.APIKey
+}
+
+type apiKeyRevokeRequest struct {
+	ID int
+}
+
+// @Summary v1/APIKeyCreate
+// @Description Creates an API key of the authenticated User for machine clients, which is used as Bearer token.
+// @Description The `Key` is only returned once. Scopes: `users:read`, `users:write`. `ExpiresAt` is optional.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body apiKeyCreateRequest true "request JSON params"
+// @Success 200 {object} apiKeyCreateResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Route requires a login"
+// @Failure 422 {object} handlers.JSONMsgStr "Params validation error"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/APIKeyCreate [post]
+func (s *Server) apiKeyCreateRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req apiKeyCreateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to create API key", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	user, _ := handlers.CurrentUser(r.Context())
+
+	apiKey, key, err := userlib.NewAPIKey(user, req.Name, req.Scopes, req.ExpiresAt, s.db)
+	if err != nil {
+		log.Infow("unable to create api key", "userID", user.ID, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not create API key")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, apiKeyCreateResponse{
+		APIKey: apiKey,
+		Key:    key,
+	})
+}
+
+// @Summary v1/APIKeyList
+// @Description Lists the API keys of the authenticated User without the keys.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Success 200 {object} apiKeyListResponse
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Route requires a login"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/APIKeyList [post]
+func (s *Server) apiKeyListRoute(w http.ResponseWriter, r *http.Request) {
+	user, _ := handlers.CurrentUser(r.Context())
+
+	apiKeys, err := userlib.APIKeysByUser(user.ID, s.db)
+	if err != nil {
+		log.Errorw("unable to list api keys", "userID", user.ID, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not list API keys")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, apiKeyListResponse{
+		APIKeys: apiKeys,
+	})
+}
+
+// @Summary v1/APIKeyRevoke
+// @Description Revokes an API key of the authenticated User.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body apiKeyRevokeRequest true "request JSON params"
+// @Success 200 {object} interface{} "OK"
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Route requires a login"
+// @Failure 404 {object} handlers.JSONMsgStr "API key not found"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/APIKeyRevoke [post]
+func (s *Server) apiKeyRevokeRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req apiKeyRevokeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to revoke API key", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	user, _ := handlers.CurrentUser(r.Context())
+
+	err := userlib.RevokeAPIKey(user.ID, req.ID, s.db)
+	if err != nil {
+		log.Infow("unable to revoke api key", "userID", user.ID, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not revoke API key")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, struct{}{})
+}
@@ -0,0 +1,79 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+func Test_apiKeyRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	createURL := ts.URL + "/auth/v1/APIKeyCreate"
+	listURL := ts.URL + "/auth/v1/APIKeyList"
+	revokeURL := ts.URL + "/auth/v1/APIKeyRevoke"
+	userGetURL := ts.URL + "/users/v1/UserGet"
+	userUpdateURL := ts.URL + "/users/v1/UserUpdate"
+
+	user, token := mustCreateUser(t, "user_apikey0@example.com", userlib.RoleUser)
+
+	resp := mustAuthPostRequest(t, createURL, token, apiKeyCreateRequest{
+		Name:   "ci",
+		Scopes: []string{userlib.ScopeUsersRead},
+	}, 200)
+	var createRsp apiKeyCreateResponse
+	mustLoadFromResponse(t, resp, &createRsp)
+	require.True(t, userlib.IsAPIKey(createRsp.Key))
+	key := createRsp.Key
+
+	t.Run("valid API key as Bearer token", func(t *testing.T) {
+		resp := mustAuthPostRequest(t, userGetURL, key, userGetRequest{ID: user.ID}, 200)
+		var userRsp userResponse
+		mustLoadFromResponse(t, resp, &userRsp)
+		assert.Equal(t, user.ID, userRsp.User.ID)
+	})
+
+	t.Run("API key without scope", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, userUpdateURL, key, userUpdateRequest{ID: user.ID}, 403)
+	})
+
+	t.Run("API key on session routes", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, createURL, key, apiKeyCreateRequest{Name: "ci", Scopes: []string{userlib.ScopeUsersWrite}}, 403)
+		_ = mustAuthPostRequest(t, listURL, key, struct{}{}, 403)
+	})
+
+	t.Run("valid APIKeyList", func(t *testing.T) {
+		resp := mustAuthPostRequest(t, listURL, token, struct{}{}, 200)
+		var listRsp apiKeyListResponse
+		mustLoadFromResponse(t, resp, &listRsp)
+		require.Len(t, listRsp.APIKeys, 1)
+		assert.Equal(t, createRsp.APIKey.ID, listRsp.APIKeys[0].ID)
+		assert.NotNil(t, listRsp.APIKeys[0].LastUsedAt)
+	})
+
+	t.Run("invalid APIKeyCreate", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, createURL, token, "text", 400)
+		_ = mustAuthPostRequest(t, createURL, token, apiKeyCreateRequest{Name: "ci", Scopes: []string{"users:all"}}, 422)
+		_ = mustPostRequest(t, createURL, apiKeyCreateRequest{Name: "ci", Scopes: []string{userlib.ScopeUsersRead}}, 401)
+	})
+
+	t.Run("invalid APIKeyRevoke", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, revokeURL, token, "text", 400)
+		_ = mustAuthPostRequest(t, revokeURL, token, apiKeyRevokeRequest{ID: createRsp.APIKey.ID + 1000}, 404)
+	})
+
+	t.Run("valid APIKeyRevoke", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, revokeURL, token, apiKeyRevokeRequest{ID: createRsp.APIKey.ID}, 200)
+		_ = mustAuthPostRequest(t, userGetURL, key, userGetRequest{ID: user.ID}, 401)
+	})
+
+	t.Run("failing database", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, failingDBTs.URL+"/auth/v1/APIKeyList", token, struct{}{}, 500)
+	})
+}
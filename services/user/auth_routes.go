@@ -4,7 +4,10 @@ import (
 	"encoding/json"
 	"net/http"
 
+	"github.com/iconmobile-dev/go-core/errors"
+
 	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
 )
 
 type loginRequest struct {
@@ -13,11 +16,22 @@ type loginRequest struct {
 }
 
 type loginResponse struct {
-	Token string
+	Token        string `json:",omitempty"`
+	RefreshToken string `json:",omitempty"`
+	ExpiresIn    int    `json:",omitempty"` // seconds until Token expires
+
+	// set instead of the tokens if the login requires a second factor, see LoginTOTP
+	TOTPRequired   bool   `json:",omitempty"`
+	ChallengeToken string `json:",omitempty"`
+}
+
+type refreshRequest struct {
+	RefreshToken string
 }
 
 // @Summary v1/Login
-// @Description Validates user `email`, `password` and creates a Token with a default TTL of 10 days.
+// @Description Validates user `email`, `password` and creates a short-lived Token with a RefreshToken to renew it.
+// @Description If the User enabled TOTP only a ChallengeToken is returned, the login is completed with v1/LoginTOTP.
 // @Tags Auth 📘
 // @Accept  json
 // @Produce json
@@ -26,8 +40,10 @@ type loginResponse struct {
 // @Param data body loginRequest true "request JSON params"
 // @Success 200 {object} loginResponse
 // @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Email or password is incorrect"
 // @Failure 403 {object} handlers.JSONMsgStr "Forbidden"
 // @Failure 422 {object} handlers.JSONMsgStr "Params validation error"
+// @Failure 429 {object} handlers.JSONMsgStr "Too many failed login attempts, see Retry-After header"
 // @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
 // @Router /auth/v1/Login [post]
 func (s *Server) loginRoute(w http.ResponseWriter, r *http.Request) {
@@ -39,13 +55,128 @@ func (s *Server) loginRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token := ""
+	// check if logins are blocked after too many failures
+	ip := handlers.ClientIP(r)
+	err := userlib.LoginAllowed(req.Email, ip, s.cache)
+	if err != nil {
+		log.Infow("throttled login", "ip", ip, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	// check the credentials
+	user, err := userlib.UserByCredentials(req.Email, req.Password, s.db)
+	if err != nil {
+		log.Infow("failed login", "ip", ip, "error", err)
+		if errors.IsKind(errors.Unauthorized, err) {
+			if err := userlib.RegisterLoginFailure(req.Email, ip, s.cache); err != nil {
+				log.Errorw("error registering login failure", "error", err)
+			}
+		}
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	s.respondLogin(w, r, user)
+}
+
+// loadCurrentUser loads all fields of the authenticated User from the database,
+// the User of signed access tokens only has the fields of their claims
+// responds with an error and returns false if the User can't be loaded
+func (s *Server) loadCurrentUser(w http.ResponseWriter, r *http.Request, errMsg string) (userlib.User, bool) {
+	currentUser, _ := handlers.CurrentUser(r.Context())
+
+	user, err := userlib.UserByID(currentUser.ID, s.db)
+	if err != nil {
+		if errors.IsKind(errors.NotFound, err) {
+			err = errors.E(err, errors.Unauthorized, "Token is invalid or expired")
+		}
+		log.Infow("unable to load current user", "userID", currentUser.ID, "error", err)
+		handlers.JSONMsgErr(w, r, err, errMsg)
+		return user, false
+	}
+
+	return user, true
+}
+
+// respondLogin responds with the session tokens of the User whose first factor was checked
+// or with a login challenge if the User enabled TOTP.
+// Failed logins are only reset once the login is complete, see LoginTOTP
+func (s *Server) respondLogin(w http.ResponseWriter, r *http.Request, user userlib.User) {
+	// the second factor is checked by LoginTOTP
+	if user.TOTPEnabled {
+		challengeToken, err := userlib.NewLoginChallenge(user, s.cache)
+		if err != nil {
+			log.Errorw("error creating login challenge", "error", err)
+			handlers.JSONMsgErr(w, r, err, "Could not login")
+			return
+		}
+
+		handlers.JSONMsg(w, r, 200, loginResponse{TOTPRequired: true, ChallengeToken: challengeToken})
+		return
+	}
+
+	// create the session tokens
+	tokens, err := userlib.NewTokens(user, s.cache)
+	if err != nil {
+		log.Errorw("error creating session", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	err = userlib.ResetLoginFailures(user.Email, s.cache)
+	if err != nil {
+		log.Errorw("error resetting login failures", "error", err)
+	}
 
-	handlers.JSONMsg(w, r, 200, loginResponse{Token: token})
+	log.Infow("User logged in", "userID", user.ID)
+	handlers.JSONMsg(w, r, 200, newLoginResponse(tokens))
+}
+
+// @Summary v1/Refresh
+// @Description Exchanges a `RefreshToken` for a new Token and RefreshToken, every RefreshToken can only be used once.
+// @Description Using a RefreshToken a second time revokes all tokens issued since the login.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body refreshRequest true "request JSON params"
+// @Success 200 {object} loginResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "RefreshToken is invalid or expired"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/Refresh [post]
+func (s *Server) refreshRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req refreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to refresh", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	// rotate the refresh token
+	tokens, err := userlib.RefreshTokens(req.RefreshToken, s.db, s.cache)
+	if err != nil {
+		log.Infow("failed refresh", "ip", handlers.ClientIP(r), "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not refresh")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, newLoginResponse(tokens))
+}
+
+// newLoginResponse returns the response of issued session tokens
+func newLoginResponse(tokens userlib.Tokens) loginResponse {
+	return loginResponse{
+		Token:        tokens.AccessToken,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+	}
 }
 
 // @Summary v1/Logout
-// @Description Invalidates token present in the request Authorization header.
+// @Description Invalidates token present in the request Authorization header and the RefreshToken issued with it.
 // @Tags Auth 📘
 // @Accept  json
 // @Produce json
@@ -53,10 +184,44 @@ func (s *Server) loginRoute(w http.ResponseWriter, r *http.Request) {
 // @Param Accept-Language header string true "Example: en-US" default(en-US)
 // @Success 200 {object} interface{} "OK"
 // @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
 // @Failure 403 {object} handlers.JSONMsgStr "Forbidden"
 // @Failure 422 {object} handlers.JSONMsgStr "Params validation error"
 // @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
 // @Router /auth/v1/Logout [post]
 func (s *Server) logoutRoute(w http.ResponseWriter, r *http.Request) {
+	// revoke the session token
+	err := userlib.DeleteSession(handlers.BearerToken(r), s.cache)
+	if err != nil {
+		log.Infow("failed logout", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not logout")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, struct{}{})
+}
+
+// @Summary v1/LogoutAll
+// @Description Invalidates all tokens of the User the request Authorization header token belongs to.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Success 200 {object} interface{} "OK"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/LogoutAll [post]
+func (s *Server) logoutAllRoute(w http.ResponseWriter, r *http.Request) {
+	user, _ := handlers.CurrentUser(r.Context())
+
+	// revoke all sessions of the User
+	err := userlib.DeleteUserSessions(user.ID, s.cache)
+	if err != nil {
+		log.Errorw("error revoking sessions", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not logout")
+		return
+	}
+
 	handlers.JSONMsg(w, r, 200, struct{}{})
 }
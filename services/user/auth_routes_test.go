@@ -3,7 +3,9 @@ package user
 import (
 	"testing"
 
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_loginRoute(t *testing.T) {
@@ -12,7 +14,151 @@ func Test_loginRoute(t *testing.T) {
 		assert.NoError(t, serverTest.cache.Reset())
 	})
 
-	// myURL := ts.URL + "/users/v1/UserCreate"
+	createURL := ts.URL + "/users/v1/UserCreate"
+	loginURL := ts.URL + "/auth/v1/Login"
+	failingDBLoginURL := failingDBTs.URL + "/auth/v1/Login"
+
+	createReq := userCreateRequest{
+		Email:    "user_login0@example.com",
+		Password: "password",
+	}
+	resp := mustPostRequest(t, createURL, createReq, 200)
+	var createRsp userResponse
+	mustLoadFromResponse(t, resp, &createRsp)
+
+	t.Run("valid LoginRequest", func(t *testing.T) {
+		t.Parallel()
+
+		loginReq := loginRequest{
+			Email:    createReq.Email,
+			Password: createReq.Password,
+		}
+		resp := mustPostRequest(t, loginURL, loginReq, 200)
+		var loginRsp loginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+		require.NotEmpty(t, loginRsp.Token)
+		require.NotEmpty(t, loginRsp.RefreshToken)
+		assert.Equal(t, int(userlib.AccessTokenTTL().Seconds()), loginRsp.ExpiresIn)
+
+		// the token maps back to the User
+		session, err := userlib.SessionByToken(loginRsp.Token, serverTest.cache)
+		require.NoError(t, err)
+		assert.Equal(t, createRsp.User.ID, session.UserID)
+	})
+
+	t.Run("invalid LoginRequest with incorrect password", func(t *testing.T) {
+		t.Parallel()
+
+		loginReq := loginRequest{
+			Email:    createReq.Email,
+			Password: "incorrect_password",
+		}
+		resp := mustPostRequest(t, loginURL, loginReq, 401)
+		var passwordRsp map[string]string
+		mustLoadFromResponse(t, resp, &passwordRsp)
+
+		loginReq = loginRequest{
+			Email:    "user_login_unknown@example.com",
+			Password: createReq.Password,
+		}
+		resp = mustPostRequest(t, loginURL, loginReq, 401)
+		var emailRsp map[string]string
+		mustLoadFromResponse(t, resp, &emailRsp)
+
+		// the response must not reveal if the email exists
+		assert.Equal(t, emailRsp, passwordRsp)
+	})
+
+	t.Run("invalid LoginRequest after too many failures", func(t *testing.T) {
+		t.Parallel()
+
+		throttledCreateReq := createReq
+		throttledCreateReq.Email = "user_login_throttled@example.com"
+		_ = mustPostRequest(t, createURL, throttledCreateReq, 200)
+
+		loginReq := loginRequest{
+			Email:    throttledCreateReq.Email,
+			Password: "incorrect_password",
+		}
+		for i := 0; i <= cfg.LoginThrottle.FreeFailures; i++ {
+			_ = mustPostRequest(t, loginURL, loginReq, 401)
+		}
+
+		// even the correct password is rejected until the backoff passed
+		loginReq.Password = throttledCreateReq.Password
+		resp := mustPostRequest(t, loginURL, loginReq, 429)
+		defer resp.Body.Close()
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("invalid LoginRequest with invalid json", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustPostRequest(t, loginURL, "text", 400)
+	})
+
+	t.Run("valid LoginRequest with failingDB", func(t *testing.T) {
+		loginReq := loginRequest{
+			Email:    createReq.Email,
+			Password: createReq.Password,
+		}
+		_ = mustPostRequest(t, failingDBLoginURL, loginReq, 500)
+	})
+}
+
+func Test_refreshRoute(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	loginURL := ts.URL + "/auth/v1/Login"
+	refreshURL := ts.URL + "/auth/v1/Refresh"
+	getURL := ts.URL + "/users/v1/UserGet"
+
+	user, _ := mustCreateUser(t, "user_refresh0@example.com", userlib.RoleUser)
+
+	login := func(t *testing.T) loginResponse {
+		resp := mustPostRequest(t, loginURL, loginRequest{Email: user.Email, Password: "password"}, 200)
+		var loginRsp loginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+		return loginRsp
+	}
+
+	t.Run("valid RefreshRequest", func(t *testing.T) {
+		loginRsp := login(t)
+
+		resp := mustPostRequest(t, refreshURL, refreshRequest{RefreshToken: loginRsp.RefreshToken}, 200)
+		var refreshRsp loginResponse
+		mustLoadFromResponse(t, resp, &refreshRsp)
+		require.NotEmpty(t, refreshRsp.Token)
+		assert.NotEqual(t, loginRsp.RefreshToken, refreshRsp.RefreshToken)
+
+		// the new token authenticates the User
+		_ = mustAuthPostRequest(t, getURL, refreshRsp.Token, userGetRequest{ID: user.ID}, 200)
+	})
+
+	t.Run("invalid RefreshRequest with reused RefreshToken", func(t *testing.T) {
+		loginRsp := login(t)
+
+		resp := mustPostRequest(t, refreshURL, refreshRequest{RefreshToken: loginRsp.RefreshToken}, 200)
+		var refreshRsp loginResponse
+		mustLoadFromResponse(t, resp, &refreshRsp)
+
+		_ = mustPostRequest(t, refreshURL, refreshRequest{RefreshToken: loginRsp.RefreshToken}, 401)
+
+		// the whole token family is revoked
+		_ = mustAuthPostRequest(t, getURL, refreshRsp.Token, userGetRequest{ID: user.ID}, 401)
+		_ = mustPostRequest(t, refreshURL, refreshRequest{RefreshToken: refreshRsp.RefreshToken}, 401)
+	})
+
+	t.Run("invalid RefreshRequest with unknown RefreshToken", func(t *testing.T) {
+		_ = mustPostRequest(t, refreshURL, refreshRequest{RefreshToken: "unknown"}, 401)
+	})
+
+	t.Run("invalid RefreshRequest with invalid json", func(t *testing.T) {
+		_ = mustPostRequest(t, refreshURL, "text", 400)
+	})
 }
 
 func Test_logoutRoute(t *testing.T) {
@@ -21,5 +167,74 @@ func Test_logoutRoute(t *testing.T) {
 		assert.NoError(t, serverTest.cache.Reset())
 	})
 
-	// myURL := ts.URL + "/auth/v1/Logout"
+	createURL := ts.URL + "/users/v1/UserCreate"
+	logoutURL := ts.URL + "/auth/v1/Logout"
+
+	createReq := userCreateRequest{
+		Email:    "user_logout0@example.com",
+		Password: "password",
+	}
+	_ = mustPostRequest(t, createURL, createReq, 200)
+
+	t.Run("valid LogoutRequest", func(t *testing.T) {
+		token := mustLogin(t, createReq.Email, createReq.Password)
+		otherToken := mustLogin(t, createReq.Email, createReq.Password)
+
+		_ = mustAuthPostRequest(t, logoutURL, token, struct{}{}, 200)
+
+		// the token is revoked
+		_, err := userlib.SessionByToken(token, serverTest.cache)
+		assert.Error(t, err)
+		_ = mustAuthPostRequest(t, logoutURL, token, struct{}{}, 401)
+
+		// other sessions are still valid
+		_, err = userlib.SessionByToken(otherToken, serverTest.cache)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid LogoutRequest without token", func(t *testing.T) {
+		_ = mustPostRequest(t, logoutURL, struct{}{}, 401)
+	})
+}
+
+func Test_logoutAllRoute(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	createURL := ts.URL + "/users/v1/UserCreate"
+	logoutAllURL := ts.URL + "/auth/v1/LogoutAll"
+
+	createReq := userCreateRequest{
+		Email:    "user_logout_all0@example.com",
+		Password: "password",
+	}
+	_ = mustPostRequest(t, createURL, createReq, 200)
+
+	otherCreateReq := createReq
+	otherCreateReq.Email = "user_logout_all1@example.com"
+	_ = mustPostRequest(t, createURL, otherCreateReq, 200)
+
+	t.Run("valid LogoutAllRequest", func(t *testing.T) {
+		token0 := mustLogin(t, createReq.Email, createReq.Password)
+		token1 := mustLogin(t, createReq.Email, createReq.Password)
+		otherUserToken := mustLogin(t, otherCreateReq.Email, otherCreateReq.Password)
+
+		_ = mustAuthPostRequest(t, logoutAllURL, token0, struct{}{}, 200)
+
+		// all sessions of the User are revoked
+		_, err := userlib.SessionByToken(token0, serverTest.cache)
+		assert.Error(t, err)
+		_, err = userlib.SessionByToken(token1, serverTest.cache)
+		assert.Error(t, err)
+
+		// sessions of other Users are still valid
+		_, err = userlib.SessionByToken(otherUserToken, serverTest.cache)
+		assert.NoError(t, err)
+	})
+
+	t.Run("invalid LogoutAllRequest without token", func(t *testing.T) {
+		_ = mustPostRequest(t, logoutAllURL, struct{}{}, 401)
+	})
 }
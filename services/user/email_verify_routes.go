@@ -0,0 +1,79 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+type emailVerifyRequest struct {
+	Token string
+}
+
+// @Summary v1/EmailVerify
+// @Description Verifies the email the verification `token` was sent to and makes it the `Email` of the User.
+// @Description Every verification token can only be used once.
+// @Tags User 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body emailVerifyRequest true "request JSON params"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 409 {object} handlers.JSONMsgStr "User with email does already exist"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /users/v1/EmailVerify [post]
+func (s *Server) emailVerifyRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req emailVerifyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to verify email", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	user, err := userlib.VerifyEmail(req.Token, s.db, s.cache)
+	if err != nil {
+		log.Infow("failed email verification", "ip", handlers.ClientIP(r), "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not verify email")
+		return
+	}
+
+	// remove sensitive data
+	user = removeSensitiveDataFromUser(r, user)
+
+	handlers.JSONMsg(w, r, 200, userResponse{
+		User: user,
+	})
+}
+
+// @Summary v1/EmailVerifyResend
+// @Description Sends another link to verify the `EmailToVerify` of the authenticated User.
+// @Tags User 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Success 200 {object} interface{} "OK"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 422 {object} handlers.JSONMsgStr "Email is already verified"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /users/v1/EmailVerifyResend [post]
+func (s *Server) emailVerifyResendRoute(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.loadCurrentUser(w, r, "Could not send email verification")
+	if !ok {
+		return
+	}
+
+	err := user.SendEmailVerification(s.cache, s.mailer)
+	if err != nil {
+		log.Infow("failed to resend email verification", "userID", user.ID, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not send email verification")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, struct{}{})
+}
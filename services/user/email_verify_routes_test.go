@@ -0,0 +1,80 @@
+package user
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func Test_emailVerifyRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	createURL := ts.URL + "/users/v1/UserCreate"
+	updateURL := ts.URL + "/users/v1/UserUpdate"
+	verifyURL := ts.URL + "/users/v1/EmailVerify"
+	resendURL := ts.URL + "/users/v1/EmailVerifyResend"
+
+	createReq := userCreateRequest{
+		Email:    "user_verify0@example.com",
+		Password: "password",
+	}
+	resp := mustPostRequest(t, createURL, createReq, 200)
+	var createRsp userResponse
+	mustLoadFromResponse(t, resp, &createRsp)
+	assert.False(t, createRsp.User.EmailVerified)
+	token := mustLogin(t, createReq.Email, createReq.Password)
+
+	t.Run("valid EmailVerifyRequest after signup", func(t *testing.T) {
+		verifyToken := mustMailToken(t, createReq.Email)
+
+		resp := mustPostRequest(t, verifyURL, emailVerifyRequest{Token: verifyToken}, 200)
+		var verifyRsp userResponse
+		mustLoadFromResponse(t, resp, &verifyRsp)
+		assert.True(t, verifyRsp.User.EmailVerified)
+
+		// the token can only be used once
+		_ = mustPostRequest(t, verifyURL, emailVerifyRequest{Token: verifyToken}, 401)
+
+		// nothing left to verify
+		_ = mustAuthPostRequest(t, resendURL, token, struct{}{}, 422)
+	})
+
+	t.Run("valid EmailVerifyRequest after email change", func(t *testing.T) {
+		newEmail := "user_verify0_new@example.com"
+		updateReq := userUpdateRequest{ID: createRsp.User.ID, Email: &newEmail}
+		resp := mustAuthPostRequest(t, updateURL, token, updateReq, 200)
+		var updateRsp userResponse
+		mustLoadFromResponse(t, resp, &updateRsp)
+		assert.Equal(t, createReq.Email, updateRsp.User.Email)
+		assert.Equal(t, newEmail, updateRsp.User.EmailToVerify)
+
+		// resend a link, both links are valid
+		_ = mustAuthPostRequest(t, resendURL, token, struct{}{}, 200)
+		verifyToken := mustMailToken(t, newEmail)
+
+		resp = mustPostRequest(t, verifyURL, emailVerifyRequest{Token: verifyToken}, 200)
+		var verifyRsp userResponse
+		mustLoadFromResponse(t, resp, &verifyRsp)
+		require.True(t, verifyRsp.User.EmailVerified)
+
+		_ = mustLogin(t, newEmail, createReq.Password)
+	})
+
+	t.Run("invalid UserUpdateRequest with taken email", func(t *testing.T) {
+		otherUser, _ := mustCreateUser(t, "user_verify1@example.com", 0)
+		updateReq := userUpdateRequest{ID: createRsp.User.ID, Email: &otherUser.Email}
+		_ = mustAuthPostRequest(t, updateURL, token, updateReq, 409)
+	})
+
+	t.Run("invalid EmailVerifyRequest with unknown token", func(t *testing.T) {
+		_ = mustPostRequest(t, verifyURL, emailVerifyRequest{Token: "unknown"}, 401)
+	})
+
+	t.Run("invalid EmailVerifyRequest with invalid json", func(t *testing.T) {
+		_ = mustPostRequest(t, verifyURL, "text", 400)
+	})
+}
@@ -0,0 +1,82 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+type magicLinkRequestRequest struct {
+	Email string
+}
+
+type magicLinkLoginRequest struct {
+	Token string
+}
+
+// @Summary v1/MagicLinkRequest
+// @Description Sends a single-use login link to the given `email`, which only works in the requesting browser.
+// @Description Responds with 200 even if no User with the email exists.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body magicLinkRequestRequest true "request JSON params"
+// @Success 200 {object} interface{} "OK"
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 429 {object} handlers.JSONMsgStr "Too many magic link requests, see Retry-After header"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/MagicLinkRequest [post]
+func (s *Server) magicLinkRequestRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req magicLinkRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to request magic link", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	err := userlib.RequestMagicLink(req.Email, handlers.UserAgentFingerprint(r), s.db, s.cache, s.mailer)
+	if err != nil {
+		log.Infow("unable to request magic link", "ip", handlers.ClientIP(r), "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not request magic link")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, struct{}{})
+}
+
+// @Summary v1/MagicLinkLogin
+// @Description Exchanges the `token` of a magic link for a short-lived Token with a RefreshToken like v1/Login.
+// @Description Every magic link can only be used once and only by the browser which requested it.
+// @Description If the User enabled TOTP only a ChallengeToken is returned, the login is completed with v1/LoginTOTP.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body magicLinkLoginRequest true "request JSON params"
+// @Success 200 {object} loginResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/MagicLinkLogin [post]
+func (s *Server) magicLinkLoginRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req magicLinkLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to login with magic link", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	user, err := userlib.MagicLinkLogin(req.Token, handlers.UserAgentFingerprint(r), s.db, s.cache)
+	if err != nil {
+		log.Infow("failed magic link login", "ip", handlers.ClientIP(r), "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	s.respondLogin(w, r, user)
+}
@@ -0,0 +1,75 @@
+package user
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+func Test_magicLinkRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	requestURL := ts.URL + "/auth/v1/MagicLinkRequest"
+	loginURL := ts.URL + "/auth/v1/MagicLinkLogin"
+
+	user, _ := mustCreateUser(t, "user_magic0@example.com", userlib.RoleUser)
+
+	t.Run("valid MagicLinkLogin", func(t *testing.T) {
+		_ = mustPostRequest(t, requestURL, magicLinkRequestRequest{Email: user.Email}, 200)
+		token := mustMailToken(t, user.Email)
+
+		resp := mustPostRequest(t, loginURL, magicLinkLoginRequest{Token: token}, 200)
+		var loginRsp loginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+		require.NotEmpty(t, loginRsp.Token)
+		assert.NotEmpty(t, loginRsp.RefreshToken)
+
+		_ = mustAuthPostRequest(t, ts.URL+"/users/v1/UserGet", loginRsp.Token, userGetRequest{ID: user.ID}, 200)
+
+		// the link is single-use
+		_ = mustPostRequest(t, loginURL, magicLinkLoginRequest{Token: token}, 401)
+	})
+
+	t.Run("invalid MagicLinkLogin from other user agent", func(t *testing.T) {
+		_ = mustPostRequest(t, requestURL, magicLinkRequestRequest{Email: user.Email}, 200)
+		token := mustMailToken(t, user.Email)
+
+		body, err := json.Marshal(magicLinkLoginRequest{Token: token})
+		require.NoError(t, err)
+		req, err := http.NewRequest("POST", loginURL, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "other browser")
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 401, resp.StatusCode)
+	})
+
+	t.Run("invalid MagicLinkRequest exceeding the rate limit", func(t *testing.T) {
+		require.NoError(t, serverTest.cache.Reset())
+		email := "user_magic1@example.com"
+		for i := 0; i < 3; i++ {
+			_ = mustPostRequest(t, requestURL, magicLinkRequestRequest{Email: email}, 200)
+		}
+
+		resp := mustPostRequest(t, requestURL, magicLinkRequestRequest{Email: email}, 429)
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		_ = mustPostRequest(t, requestURL, "text", 400)
+		_ = mustPostRequest(t, loginURL, "text", 400)
+		_ = mustPostRequest(t, loginURL, magicLinkLoginRequest{Token: "invalid"}, 401)
+	})
+}
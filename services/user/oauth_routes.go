@@ -0,0 +1,160 @@
+package user
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+// grantClientCredentials is the only supported OAuth2 grant type
+const grantClientCredentials = "client_credentials"
+
+// oauthTokenResponse is the access token response of RFC 6749
+type oauthTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+}
+
+// oauthErrorResponse is the error response of RFC 6749
+type oauthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// @Summary oauth/token
+// @Description Issues an access token to a registered OAuth2 client with the `client_credentials` grant (RFC 6749).
+// @Description The client authenticates with HTTP Basic auth or `client_id` and `client_secret` form params.
+// @Description `scope` is space separated and defaults to all scopes of the client.
+// @Tags Auth 📘
+// @Accept  x-www-form-urlencoded
+// @Produce json
+// @Param grant_type formData string true "client_credentials"
+// @Param scope formData string false "Example: users:read"
+// @Param client_id formData string false "if not sent by Basic auth"
+// @Param client_secret formData string false "if not sent by Basic auth"
+// @Success 200 {object} oauthTokenResponse
+// @Failure 400 {object} oauthErrorResponse "invalid_request, unsupported_grant_type or invalid_scope"
+// @Failure 401 {object} oauthErrorResponse "invalid_client"
+// @Failure 500 {object} oauthErrorResponse "server_error"
+// @Router /oauth/token [post]
+func (s *Server) oauthTokenRoute(w http.ResponseWriter, r *http.Request) {
+	// token responses must not be cached
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		log.Infow("Could not parse form to issue OAuth token", "error", err)
+		oauthError(w, r, 400, "invalid_request", "Invalid request form")
+		return
+	}
+
+	if grantType := r.PostForm.Get("grant_type"); grantType != grantClientCredentials {
+		log.Infow("unsupported oauth grant type", "grantType", grantType)
+		oauthError(w, r, 400, "unsupported_grant_type", "Only client_credentials is supported")
+		return
+	}
+
+	client, ok := s.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	token, err := client.NewClientToken(strings.Fields(r.PostForm.Get("scope")), s.cache)
+	if err != nil {
+		log.Infow("unable to issue oauth token", "clientID", client.ClientID, "error", err)
+		if errors.IsKind(errors.Forbidden, err) {
+			oauthError(w, r, 400, "invalid_scope", "Scope is not granted to the client")
+			return
+		}
+		oauthError(w, r, 500, "server_error", "")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, oauthTokenResponse{
+		AccessToken: token.AccessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   token.ExpiresIn,
+		Scope:       strings.Join(token.Scopes, " "),
+	})
+}
+
+// @Summary oauth/introspect
+// @Description Describes an access token, API key or client token (RFC 7662), requires the authentication of a registered OAuth2 client.
+// @Description Unknown, expired or revoked tokens are described as `{"active":false}`.
+// @Tags Auth 📘
+// @Accept  x-www-form-urlencoded
+// @Produce json
+// @Param token formData string true "token to describe"
+// @Param client_id formData string false "if not sent by Basic auth"
+// @Param client_secret formData string false "if not sent by Basic auth"
+// @Success 200 {object} userlib.Introspection
+// @Failure 400 {object} oauthErrorResponse "invalid_request"
+// @Failure 401 {object} oauthErrorResponse "invalid_client"
+// @Failure 500 {object} oauthErrorResponse "server_error"
+// @Router /oauth/introspect [post]
+func (s *Server) oauthIntrospectRoute(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		log.Infow("Could not parse form to introspect OAuth token", "error", err)
+		oauthError(w, r, 400, "invalid_request", "Invalid request form")
+		return
+	}
+
+	client, ok := s.authenticateClient(w, r)
+	if !ok {
+		return
+	}
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		oauthError(w, r, 400, "invalid_request", "token is required")
+		return
+	}
+
+	introspection, err := userlib.Introspect(token, s.db, s.cache)
+	if err != nil {
+		log.Errorw("unable to introspect token", "clientID", client.ClientID, "error", err)
+		oauthError(w, r, 500, "server_error", "")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, introspection)
+}
+
+// authenticateClient loads the OAuth client of the request by its Basic auth or form credentials
+// responds with invalid_client and returns false if the credentials are missing or invalid
+func (s *Server) authenticateClient(w http.ResponseWriter, r *http.Request) (userlib.OAuthClient, bool) {
+	clientID, secret, basicAuth := r.BasicAuth()
+	if !basicAuth {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+
+	client, err := userlib.OAuthClientByCredentials(clientID, secret, s.db)
+	if err != nil {
+		log.Infow("failed oauth client authentication", "clientID", clientID, "error", err)
+		if !errors.IsKind(errors.Unauthorized, err) {
+			oauthError(w, r, 500, "server_error", "")
+			return client, false
+		}
+		if basicAuth {
+			w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+		}
+		oauthError(w, r, 401, "invalid_client", "Client credentials are invalid")
+		return client, false
+	}
+
+	return client, true
+}
+
+// oauthError responds with an OAuth2 error
+func oauthError(w http.ResponseWriter, r *http.Request, status int, code, description string) {
+	handlers.JSONMsg(w, r, status, oauthErrorResponse{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
@@ -0,0 +1,141 @@
+package user
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+	"github.com/iconmobile-dev/go-interview/pkg/ptrutil"
+	"github.com/iconmobile-dev/go-interview/pkg/sqlutil"
+)
+
+// mustPostForm sends a form encoded POST request with the client credentials as Basic auth if not empty
+// and fails the test if an error or an unexpected http status code is returned
+func mustPostForm(t *testing.T, myURL, clientID, secret string, form url.Values, expectedStatusCode int) *http.Response {
+	req, err := http.NewRequest("POST", myURL, strings.NewReader(form.Encode()))
+	require.NoError(t, err)
+	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+	if clientID != "" {
+		req.SetBasicAuth(clientID, secret)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if !assert.NoError(t, err) || !assert.Equal(t, expectedStatusCode, resp.StatusCode) {
+		t.FailNow()
+	}
+
+	return resp
+}
+
+func Test_oauthRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	tokenURL := ts.URL + "/oauth/token"
+	introspectURL := ts.URL + "/oauth/introspect"
+	userGetURL := ts.URL + "/users/v1/UserGet"
+
+	client, secret, err := userlib.NewOAuthClient("imager", "Imager", []string{userlib.ScopeUsersRead}, serverTest.db)
+	require.NoError(t, err)
+	grant := url.Values{"grant_type": {"client_credentials"}}
+
+	user, token := mustCreateUser(t, "user_oauth0@example.com", userlib.RoleUser)
+
+	t.Run("valid client_credentials grant", func(t *testing.T) {
+		resp := mustPostForm(t, tokenURL, client.ClientID, secret, grant, 200)
+		assert.Equal(t, "no-store", resp.Header.Get("Cache-Control"))
+		var tokenRsp oauthTokenResponse
+		mustLoadFromResponse(t, resp, &tokenRsp)
+		assert.True(t, userlib.IsClientToken(tokenRsp.AccessToken))
+		assert.Equal(t, "Bearer", tokenRsp.TokenType)
+		assert.Equal(t, userlib.ScopeUsersRead, tokenRsp.Scope)
+		assert.Positive(t, tokenRsp.ExpiresIn)
+
+		// the client token is accepted by scoped routes
+		resp = mustAuthPostRequest(t, userGetURL, tokenRsp.AccessToken, userGetRequest{ID: user.ID}, 200)
+		var userRsp userResponse
+		mustLoadFromResponse(t, resp, &userRsp)
+		assert.Equal(t, user.ID, userRsp.User.ID)
+		assert.Empty(t, userRsp.User.Email)
+
+		// but not by routes which require a User or other scopes
+		_ = mustAuthPostRequest(t, ts.URL+"/users/v1/UserUpdate", tokenRsp.AccessToken, userUpdateRequest{ID: user.ID}, 403)
+		_ = mustAuthPostRequest(t, ts.URL+"/auth/v1/APIKeyList", tokenRsp.AccessToken, struct{}{}, 403)
+
+		// clients have no Role, users:read does not allow to list Users or to see deleted Users
+		_ = mustAuthPostRequest(t, userGetURL, tokenRsp.AccessToken, userGetRequest{ID: user.ID, IncludeDeleted: true}, 403)
+		listReq := userlib.UserListParams{Filter: userlib.UserFilter{Email: &sqlutil.StringFilter{Contains: ptrutil.String("@example.com")}}}
+		_ = mustAuthPostRequest(t, ts.URL+"/users/v1/UserList", tokenRsp.AccessToken, listReq, 403)
+	})
+
+	t.Run("valid client_credentials grant with form credentials", func(t *testing.T) {
+		form := url.Values{
+			"grant_type":    {"client_credentials"},
+			"client_id":     {client.ClientID},
+			"client_secret": {secret},
+			"scope":         {userlib.ScopeUsersRead},
+		}
+		_ = mustPostForm(t, tokenURL, "", "", form, 200)
+	})
+
+	t.Run("invalid token requests", func(t *testing.T) {
+		resp := mustPostForm(t, tokenURL, client.ClientID, "wrong", grant, 401)
+		var errRsp oauthErrorResponse
+		mustLoadFromResponse(t, resp, &errRsp)
+		assert.Equal(t, "invalid_client", errRsp.Error)
+
+		_ = mustPostForm(t, tokenURL, "unknown", secret, grant, 401)
+		_ = mustPostForm(t, tokenURL, "", "", grant, 401)
+
+		resp = mustPostForm(t, tokenURL, client.ClientID, secret, url.Values{"grant_type": {"password"}}, 400)
+		mustLoadFromResponse(t, resp, &errRsp)
+		assert.Equal(t, "unsupported_grant_type", errRsp.Error)
+
+		form := url.Values{"grant_type": {"client_credentials"}, "scope": {userlib.ScopeUsersWrite}}
+		resp = mustPostForm(t, tokenURL, client.ClientID, secret, form, 400)
+		mustLoadFromResponse(t, resp, &errRsp)
+		assert.Equal(t, "invalid_scope", errRsp.Error)
+	})
+
+	t.Run("valid introspection", func(t *testing.T) {
+		resp := mustPostForm(t, tokenURL, client.ClientID, secret, grant, 200)
+		var tokenRsp oauthTokenResponse
+		mustLoadFromResponse(t, resp, &tokenRsp)
+
+		resp = mustPostForm(t, introspectURL, client.ClientID, secret, url.Values{"token": {tokenRsp.AccessToken}}, 200)
+		var introspection userlib.Introspection
+		mustLoadFromResponse(t, resp, &introspection)
+		assert.True(t, introspection.Active)
+		assert.Equal(t, client.ClientID, introspection.ClientID)
+		assert.Equal(t, userlib.ScopeUsersRead, introspection.Scope)
+		assert.Greater(t, introspection.ExpiresAt, introspection.IssuedAt)
+
+		resp = mustPostForm(t, introspectURL, client.ClientID, secret, url.Values{"token": {token}}, 200)
+		introspection = userlib.Introspection{}
+		mustLoadFromResponse(t, resp, &introspection)
+		assert.True(t, introspection.Active)
+		assert.Equal(t, userlib.ScopeUsersRead+" "+userlib.ScopeUsersWrite, introspection.Scope)
+
+		resp = mustPostForm(t, introspectURL, client.ClientID, secret, url.Values{"token": {"unknown"}}, 200)
+		introspection = userlib.Introspection{}
+		mustLoadFromResponse(t, resp, &introspection)
+		assert.False(t, introspection.Active)
+		assert.Empty(t, introspection.Scope)
+	})
+
+	t.Run("invalid introspection", func(t *testing.T) {
+		_ = mustPostForm(t, introspectURL, "", "", url.Values{"token": {token}}, 401)
+		_ = mustPostForm(t, introspectURL, client.ClientID, secret, url.Values{}, 400)
+	})
+
+	t.Run("failing database", func(t *testing.T) {
+		_ = mustPostForm(t, failingDBTs.URL+"/oauth/token", client.ClientID, secret, grant, 500)
+	})
+}
@@ -0,0 +1,97 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+type oidcLoginResponse struct {
+	AuthURL string // URL of the identity provider the User is sent to
+}
+
+type oidcCallbackRequest struct {
+	State string
+	Code  string
+}
+
+// errOIDCDisabled is returned by the OIDC routes if no provider is configured
+var errOIDCDisabled = errors.E(fmt.Errorf("oidc provider not configured"), errors.NotFound, "OIDC login is not configured")
+
+// @Summary v1/OIDCLogin
+// @Description Starts the login with the company SSO, the User is sent to the returned `AuthURL` of the identity provider.
+// @Description The provider redirects back to the configured redirect URL with `code` and `state`, which are passed to v1/OIDCCallback.
+// @Description The login can only be completed by the same browser.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Success 200 {object} oidcLoginResponse
+// @Failure 404 {object} handlers.JSONMsgStr "OIDC login is not configured"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/OIDCLogin [post]
+func (s *Server) oidcLoginRoute(w http.ResponseWriter, r *http.Request) {
+	if s.oidc == nil {
+		handlers.JSONMsgErr(w, r, errOIDCDisabled, "Could not login")
+		return
+	}
+
+	authURL, err := userlib.StartOIDCLogin(s.oidc, handlers.UserAgentFingerprint(r), s.cache)
+	if err != nil {
+		log.Errorw("error starting oidc login", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, oidcLoginResponse{
+		AuthURL: authURL,
+	})
+}
+
+// @Summary v1/OIDCCallback
+// @Description Completes the login with the company SSO by the `code` and `state` the identity provider redirected back with.
+// @Description The User is found by the verified email of the provider or created if auto provisioning is configured.
+// @Description If the User enabled TOTP only a ChallengeToken is returned, the login is completed with v1/LoginTOTP.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body oidcCallbackRequest true "request JSON params"
+// @Success 200 {object} loginResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Email is not verified by the identity provider or of the existing user"
+// @Failure 404 {object} handlers.JSONMsgStr "OIDC login is not configured"
+// @Failure 409 {object} handlers.JSONMsgStr "Identity is already linked to another user"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/OIDCCallback [post]
+func (s *Server) oidcCallbackRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req oidcCallbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to complete oidc login", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	if s.oidc == nil {
+		handlers.JSONMsgErr(w, r, errOIDCDisabled, "Could not login")
+		return
+	}
+
+	user, err := userlib.CompleteOIDCLogin(r.Context(), s.oidc, req.State, req.Code, handlers.UserAgentFingerprint(r), s.db, s.cache)
+	if err != nil {
+		log.Infow("failed oidc login", "ip", handlers.ClientIP(r), "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	// a compromised provider account is not enough for Users with TOTP
+	log.Infow("User authenticated with oidc", "userID", user.ID)
+	s.respondLogin(w, r, user)
+}
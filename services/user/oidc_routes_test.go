@@ -0,0 +1,153 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+	"github.com/iconmobile-dev/go-interview/pkg/oidc"
+	"github.com/iconmobile-dev/go-interview/pkg/oidc/oidctest"
+)
+
+// mustFollowAuthURL sends the User to the stand-in provider
+// and returns the callback request the provider redirected back with
+func mustFollowAuthURL(t *testing.T, authURL string) oidcCallbackRequest {
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	resp, err := client.Get(authURL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusFound, resp.StatusCode)
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	require.NoError(t, err)
+	return oidcCallbackRequest{
+		State: location.Query().Get("state"),
+		Code:  location.Query().Get("code"),
+	}
+}
+
+func Test_oidcRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		serverTest.oidc = nil
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	loginURL := ts.URL + "/auth/v1/OIDCLogin"
+	callbackURL := ts.URL + "/auth/v1/OIDCCallback"
+
+	t.Run("invalid OIDCLogin without provider", func(t *testing.T) {
+		_ = mustPostRequest(t, loginURL, struct{}{}, 404)
+		_ = mustPostRequest(t, callbackURL, oidcCallbackRequest{}, 404)
+	})
+
+	idp := oidctest.NewServer("gateway", "secret")
+	defer idp.Close()
+
+	p, err := oidc.NewProvider(context.Background(), oidc.Config{
+		Issuer:       idp.URL,
+		ClientID:     "gateway",
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost:3000/oidc-callback",
+	}, nil)
+	require.NoError(t, err)
+	serverTest.oidc = p
+
+	user, _ := mustCreateUser(t, "user_oidc0@example.com", userlib.RoleUser)
+	_, err = serverTest.db.Exec(`UPDATE users SET email_verified=true WHERE id=$1`, user.ID)
+	require.NoError(t, err)
+
+	t.Run("valid OIDCLogin and OIDCCallback", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub0", Email: user.Email, EmailVerified: true})
+
+		resp := mustPostRequest(t, loginURL, struct{}{}, 200)
+		var loginRsp oidcLoginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+		callbackReq := mustFollowAuthURL(t, loginRsp.AuthURL)
+
+		resp = mustPostRequest(t, callbackURL, callbackReq, 200)
+		var tokensRsp loginResponse
+		mustLoadFromResponse(t, resp, &tokensRsp)
+		require.NotEmpty(t, tokensRsp.Token)
+		assert.NotEmpty(t, tokensRsp.RefreshToken)
+
+		// the session is valid
+		_ = mustAuthPostRequest(t, ts.URL+"/users/v1/UserGet", tokensRsp.Token, userGetRequest{ID: user.ID}, 200)
+
+		// the code and state are single-use
+		_ = mustPostRequest(t, callbackURL, callbackReq, 401)
+	})
+
+	t.Run("valid OIDCCallback of User with TOTP requires second factor", func(t *testing.T) {
+		totpUser, totpToken := mustCreateUser(t, "user_oidc_totp@example.com", userlib.RoleUser)
+		_, err := serverTest.db.Exec(`UPDATE users SET email_verified=true WHERE id=$1`, totpUser.ID)
+		require.NoError(t, err)
+		secret := mustEnableTOTP(t, totpToken)
+		idp.SetUser(oidctest.User{Subject: "sub2", Email: totpUser.Email, EmailVerified: true})
+
+		resp := mustPostRequest(t, loginURL, struct{}{}, 200)
+		var loginRsp oidcLoginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+
+		resp = mustPostRequest(t, callbackURL, mustFollowAuthURL(t, loginRsp.AuthURL), 200)
+		var challengeRsp loginResponse
+		mustLoadFromResponse(t, resp, &challengeRsp)
+		assert.True(t, challengeRsp.TOTPRequired)
+		assert.Empty(t, challengeRsp.Token)
+		require.NotEmpty(t, challengeRsp.ChallengeToken)
+
+		totpReq := loginTOTPRequest{ChallengeToken: challengeRsp.ChallengeToken, Code: mustTOTPCode(t, secret, 1)}
+		resp = mustPostRequest(t, ts.URL+"/auth/v1/LoginTOTP", totpReq, 200)
+		var tokensRsp loginResponse
+		mustLoadFromResponse(t, resp, &tokensRsp)
+		assert.NotEmpty(t, tokensRsp.Token)
+	})
+
+	t.Run("invalid OIDCCallback from other user agent", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub0", Email: user.Email, EmailVerified: true})
+
+		resp := mustPostRequest(t, loginURL, struct{}{}, 200)
+		var loginRsp oidcLoginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+		callbackReq := mustFollowAuthURL(t, loginRsp.AuthURL)
+
+		body, err := json.Marshal(callbackReq)
+		require.NoError(t, err)
+		req, err := http.NewRequest("POST", callbackURL, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("User-Agent", "other browser")
+
+		resp, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, 401, resp.StatusCode)
+
+		// the state is used up
+		_ = mustPostRequest(t, callbackURL, callbackReq, 401)
+	})
+
+	t.Run("invalid OIDCCallback with unknown email", func(t *testing.T) {
+		idp.SetUser(oidctest.User{Subject: "sub1", Email: "user_oidc1@example.com", EmailVerified: true})
+
+		resp := mustPostRequest(t, loginURL, struct{}{}, 200)
+		var loginRsp oidcLoginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+
+		_ = mustPostRequest(t, callbackURL, mustFollowAuthURL(t, loginRsp.AuthURL), 403)
+	})
+
+	t.Run("invalid OIDCCallback", func(t *testing.T) {
+		_ = mustPostRequest(t, callbackURL, "text", 400)
+		_ = mustPostRequest(t, callbackURL, oidcCallbackRequest{State: "invalid", Code: "invalid"}, 401)
+	})
+}
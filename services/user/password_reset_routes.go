@@ -0,0 +1,83 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+type passwordResetRequestRequest struct {
+	Email string
+}
+
+type passwordResetConfirmRequest struct {
+	Token    string
+	Password string
+}
+
+// @Summary v1/PasswordResetRequest
+// @Description Sends a link to set a new password to the given `email`.
+// @Description Responds with 200 even if no User with the email exists.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body passwordResetRequestRequest true "request JSON params"
+// @Success 200 {object} interface{} "OK"
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 429 {object} handlers.JSONMsgStr "Too many password reset requests, see Retry-After header"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/PasswordResetRequest [post]
+func (s *Server) passwordResetRequestRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req passwordResetRequestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to request password reset", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	err := userlib.RequestPasswordReset(req.Email, s.db, s.cache, s.mailer)
+	if err != nil {
+		log.Infow("unable to request password reset", "ip", handlers.ClientIP(r), "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not request password reset")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, struct{}{})
+}
+
+// @Summary v1/PasswordResetConfirm
+// @Description Sets the `password` of the User the password reset `token` was sent to and invalidates all tokens of the User.
+// @Description Every password reset token can only be used once.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body passwordResetConfirmRequest true "request JSON params"
+// @Success 200 {object} interface{} "OK"
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 422 {object} handlers.JSONMsgStr "Params validation error"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/PasswordResetConfirm [post]
+func (s *Server) passwordResetConfirmRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req passwordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to confirm password reset", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	_, err := userlib.ResetPassword(req.Token, req.Password, s.db, s.cache)
+	if err != nil {
+		log.Infow("failed password reset", "ip", handlers.ClientIP(r), "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not reset password")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, struct{}{})
+}
@@ -0,0 +1,82 @@
+package user
+
+import (
+	"net/url"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+// linkTokenRegexp matches the token of links sent by email
+var linkTokenRegexp = regexp.MustCompile(`token=([^\s&]+)`)
+
+// mustMailToken returns the token of the link in the last email sent to the address
+func mustMailToken(t *testing.T, to string) string {
+	msg, ok := outbox.Last(to)
+	require.True(t, ok, "no mail sent to %s", to)
+
+	match := linkTokenRegexp.FindStringSubmatch(msg.Body)
+	require.Len(t, match, 2, "no token in mail to %s", to)
+
+	token, err := url.QueryUnescape(match[1])
+	require.NoError(t, err)
+	return token
+}
+
+func Test_passwordResetRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	requestURL := ts.URL + "/auth/v1/PasswordResetRequest"
+	confirmURL := ts.URL + "/auth/v1/PasswordResetConfirm"
+	getURL := ts.URL + "/users/v1/UserGet"
+
+	user, token := mustCreateUser(t, "user_reset0@example.com", userlib.RoleUser)
+
+	t.Run("valid PasswordResetRequest and PasswordResetConfirm", func(t *testing.T) {
+		_ = mustPostRequest(t, requestURL, passwordResetRequestRequest{Email: user.Email}, 200)
+		resetToken := mustMailToken(t, user.Email)
+
+		confirmReq := passwordResetConfirmRequest{Token: resetToken, Password: "new_password"}
+		_ = mustPostRequest(t, confirmURL, confirmReq, 200)
+
+		// the old session is revoked and the new password works
+		_ = mustAuthPostRequest(t, getURL, token, userGetRequest{ID: user.ID}, 401)
+		_ = mustLogin(t, user.Email, "new_password")
+
+		// the token can only be used once
+		_ = mustPostRequest(t, confirmURL, confirmReq, 401)
+	})
+
+	t.Run("valid PasswordResetRequest with unknown email", func(t *testing.T) {
+		count := len(outbox.Messages())
+		_ = mustPostRequest(t, requestURL, passwordResetRequestRequest{Email: "user_reset_unknown@example.com"}, 200)
+		assert.Len(t, outbox.Messages(), count)
+	})
+
+	t.Run("invalid PasswordResetConfirm with invalid password", func(t *testing.T) {
+		_ = mustPostRequest(t, requestURL, passwordResetRequestRequest{Email: user.Email}, 200)
+		resetToken := mustMailToken(t, user.Email)
+
+		_ = mustPostRequest(t, confirmURL, passwordResetConfirmRequest{Token: resetToken, Password: "short"}, 422)
+	})
+
+	t.Run("invalid PasswordResetConfirm with unknown token", func(t *testing.T) {
+		_ = mustPostRequest(t, confirmURL, passwordResetConfirmRequest{Token: "unknown", Password: "new_password"}, 401)
+	})
+
+	t.Run("invalid requests with invalid json", func(t *testing.T) {
+		_ = mustPostRequest(t, requestURL, "text", 400)
+		_ = mustPostRequest(t, confirmURL, "text", 400)
+	})
+
+	t.Run("valid PasswordResetRequest with failingDB", func(t *testing.T) {
+		_ = mustPostRequest(t, failingDBTs.URL+"/auth/v1/PasswordResetRequest", passwordResetRequestRequest{Email: user.Email}, 500)
+	})
+}
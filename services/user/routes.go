@@ -2,17 +2,56 @@ package user
 
 import (
 	"github.com/go-chi/chi"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
 )
 
 func (s *Server) routes() {
+	authenticate := handlers.Authenticate(s.db, s.cache)
+	requireSession := handlers.RequireSession
+	requireUser := handlers.RequireUser
+	requireSupport := handlers.RequireRole(userlib.RoleSupport)
+	requireAdmin := handlers.RequireRole(userlib.RoleAdmin)
+	requireRead := handlers.RequireScope(userlib.ScopeUsersRead)
+	requireWrite := handlers.RequireScope(userlib.ScopeUsersWrite)
+
 	s.router.Route("/users", func(r chi.Router) {
 		r.Post("/v1/UserCreate", s.userCreateRoute)
-		r.Post("/v1/UserGet", s.userGetRoute)
-		r.Post("/v1/UserDelete", s.userDeleteRoute)
+		r.Post("/v1/EmailVerify", s.emailVerifyRoute)
+		r.With(authenticate, requireSession).Post("/v1/EmailVerifyResend", s.emailVerifyResendRoute)
+		r.With(authenticate, requireRead).Post("/v1/UserGet", s.userGetRoute)
+		r.With(authenticate, requireUser, requireWrite).Post("/v1/UserUpdate", s.userUpdateRoute)
+		r.With(authenticate, requireUser, requireRead, requireSupport).Post("/v1/UserList", s.userListRoute)
+		r.With(authenticate, requireUser, requireWrite, requireSupport).Post("/v1/UserDelete", s.userDeleteRoute)
+		r.With(authenticate, requireUser, requireWrite, requireAdmin).Post("/v1/UserRestore", s.userRestoreRoute)
+		r.With(authenticate, requireUser, requireWrite, requireAdmin).Post("/v1/UserRoleSet", s.userRoleSetRoute)
+		r.With(authenticate, requireUser, requireWrite, requireAdmin).Post("/v1/UserSuspend", s.userSuspendRoute)
+		r.With(authenticate, requireUser, requireWrite, requireAdmin).Post("/v1/UserReactivate", s.userReactivateRoute)
 	})
 
 	s.router.Route("/auth", func(r chi.Router) {
 		r.Post("/v1/Login", s.loginRoute)
+		r.Post("/v1/LoginTOTP", s.loginTOTPRoute)
+		r.Post("/v1/MagicLinkRequest", s.magicLinkRequestRoute)
+		r.Post("/v1/MagicLinkLogin", s.magicLinkLoginRoute)
+		r.Post("/v1/OIDCLogin", s.oidcLoginRoute)
+		r.Post("/v1/OIDCCallback", s.oidcCallbackRoute)
+		r.Post("/v1/Refresh", s.refreshRoute)
 		r.Post("/v1/Logout", s.logoutRoute)
+		r.With(authenticate, requireSession).Post("/v1/LogoutAll", s.logoutAllRoute)
+		r.Post("/v1/PasswordResetRequest", s.passwordResetRequestRoute)
+		r.Post("/v1/PasswordResetConfirm", s.passwordResetConfirmRoute)
+		r.With(authenticate, requireSession).Post("/v1/TOTPEnroll", s.totpEnrollRoute)
+		r.With(authenticate, requireSession).Post("/v1/TOTPConfirm", s.totpConfirmRoute)
+		r.With(authenticate, requireSession).Post("/v1/TOTPDisable", s.totpDisableRoute)
+		r.With(authenticate, requireSession).Post("/v1/APIKeyCreate", s.apiKeyCreateRoute)
+		r.With(authenticate, requireSession).Post("/v1/APIKeyList", s.apiKeyListRoute)
+		r.With(authenticate, requireSession).Post("/v1/APIKeyRevoke", s.apiKeyRevokeRoute)
+	})
+
+	s.router.Route("/oauth", func(r chi.Router) {
+		r.Post("/token", s.oauthTokenRoute)
+		r.Post("/introspect", s.oauthIntrospectRoute)
 	})
 }
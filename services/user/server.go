@@ -7,7 +7,9 @@ import (
 	"github.com/iconmobile-dev/go-interview/config"
 	"github.com/iconmobile-dev/go-interview/lib/bootstrap"
 	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
 	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/pkg/oidc"
 	"go.uber.org/zap"
 )
 
@@ -30,17 +32,22 @@ func init() {
 type Server struct {
 	db     *storage.DB
 	cache  *storage.Cache
+	mailer mailer.Mailer
+	oidc   *oidc.Provider // nil if the OIDC login is not configured
 	router *chi.Mux
 }
 
-// New provisions the service defaults: storage database, cache, routes
-func New(db *storage.DB, cache *storage.Cache) *Server {
+// New provisions the service defaults: storage database, cache, mailer, OIDC provider, routes
+// the OIDC login is disabled if the provider is nil
+func New(db *storage.DB, cache *storage.Cache, m mailer.Mailer, op *oidc.Provider) *Server {
 	r := chi.NewRouter()
 	handlers.DefaultMiddlewares(r)
 
 	s := &Server{
 		db:     db,
 		cache:  cache,
+		mailer: m,
+		oidc:   op,
 		router: r,
 	}
 
@@ -9,7 +9,9 @@ import (
 	"os"
 	"testing"
 
+	"github.com/iconmobile-dev/go-interview/lib/mailer"
 	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
 	"github.com/jmoiron/sqlx"
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
@@ -18,6 +20,7 @@ import (
 var (
 	serverTest      *Server
 	failingDBServer *Server
+	outbox          *mailer.Outbox
 	ts              *httptest.Server
 	failingDBTs     *httptest.Server
 )
@@ -56,8 +59,9 @@ func TestMain(m *testing.M) {
 		os.Exit(1)
 	}
 
-	// init server for test
-	serverTest = New(db, cache)
+	// init server for test, mails are kept in memory
+	outbox = mailer.NewOutbox("")
+	serverTest = New(db, cache, outbox, nil)
 
 	ts = httptest.NewServer(serverTest)
 
@@ -70,7 +74,7 @@ func TestMain(m *testing.M) {
 			os.Exit(1)
 		}
 		failingDB.DB = db
-		failingDBServer = New(failingDB, cache)
+		failingDBServer = New(failingDB, cache, outbox, nil)
 		failingDBTs = httptest.NewServer(failingDBServer)
 	}
 
@@ -88,6 +92,12 @@ func TestMain(m *testing.M) {
 // PostRequest sends a POST request with user ID, Role required headers and object as JSON
 // required headers are dumy values
 func PostRequest(myURL string, data interface{}) (*http.Response, error) {
+	return AuthPostRequest(myURL, "", data)
+}
+
+// AuthPostRequest sends a POST request like PostRequest
+// and adds the token as Bearer Authorization header if not empty
+func AuthPostRequest(myURL string, token string, data interface{}) (*http.Response, error) {
 	jsonStr, err := json.Marshal(data)
 	if err != nil {
 		return nil, errors.Wrapf(err, "POST request to %s, JSON Marshal error", myURL)
@@ -96,6 +106,9 @@ func PostRequest(myURL string, data interface{}) (*http.Response, error) {
 	req, _ := http.NewRequest("POST", myURL, bytes.NewBuffer(jsonStr))
 	req.Header.Add("Content-Type", "application/json")
 	req.Header.Add("Accept-Language", "en")
+	if token != "" {
+		req.Header.Add("Authorization", "Bearer "+token)
+	}
 
 	return client.Do(req)
 }
@@ -120,6 +133,53 @@ func mustPostRequest(t *testing.T, myURL string, data interface{}, expectedStatu
 	return resp
 }
 
+// mustAuthPostRequest wraps AuthPostRequest and fails the test if an error or an unexpected http status code is returned
+func mustAuthPostRequest(t *testing.T, myURL string, token string, data interface{}, expectedStatusCode int) *http.Response {
+	resp, err := AuthPostRequest(myURL, token, data)
+	if !assert.NoError(t, err) || !assert.Equal(t, expectedStatusCode, resp.StatusCode) {
+		t.FailNow()
+	}
+
+	return resp
+}
+
+// mustLogin logs in with the given credentials and returns the session token
+func mustLogin(t *testing.T, email, password string) string {
+	resp := mustPostRequest(t, ts.URL+"/auth/v1/Login", loginRequest{Email: email, Password: password}, 200)
+	var loginRsp loginResponse
+	mustLoadFromResponse(t, resp, &loginRsp)
+
+	return loginRsp.Token
+}
+
+// mustCreateUser inserts a User with the given Role and returns it with a session token,
+// TOTP is enabled if the Role requires it
+func mustCreateUser(t *testing.T, email string, role userlib.Role) (userlib.User, string) {
+	const password = "password"
+
+	user := userlib.User{
+		Email:    email,
+		Password: password,
+		Role:     role,
+	}
+	err := user.Insert(serverTest.db, serverTest.cache)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	token := mustLogin(t, email, password)
+
+	// the Role requires TOTP, it is enabled after the login to skip the second factor
+	if role.RequiresTOTP() {
+		_, err = serverTest.db.Exec(`UPDATE users SET totp_enabled=true WHERE id=$1`, user.ID)
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		user.TOTPEnabled = true
+	}
+
+	return user, token
+}
+
 // mustLoadFromResponse wraps loadFromResponse and fails the test if an error is returned
 func mustLoadFromResponse(t *testing.T, resp *http.Response, obj interface{}) {
 	err := loadFromResponse(resp, obj)
@@ -0,0 +1,115 @@
+package user
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+type userSuspendRequest struct {
+	ID     int
+	Reason string
+	Until  *time.Time // optional end of the suspension
+}
+
+// @Summary v1/UserSuspend
+// @Description Suspends an User and revokes all sessions, requires the Admin role.
+// @Description The suspension ends with v1/UserReactivate or automatically at `Until` if given.
+// @Tags User 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body userSuspendRequest true "request JSON params"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Insufficient role or TOTP is required"
+// @Failure 404 {object} handlers.JSONMsgStr "User not found"
+// @Failure 422 {object} handlers.JSONMsgStr "Until must be in the future"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /users/v1/UserSuspend [post]
+func (s *Server) userSuspendRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req userSuspendRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to suspend User", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	// admins can't lock themselves out
+	currentUser, _ := handlers.CurrentUser(r.Context())
+	if currentUser.ID == req.ID {
+		err := errors.E(fmt.Errorf("user %d tried to suspend itself", req.ID), errors.Unprocessable, "Users can't suspend themselves")
+		handlers.JSONMsgErr(w, r, err, "Could not suspend User")
+		return
+	}
+
+	s.setUserStatus(w, r, req.ID, userlib.StatusSuspended, req.Reason, req.Until, "Could not suspend User")
+}
+
+type userReactivateRequest struct {
+	ID int
+}
+
+// @Summary v1/UserReactivate
+// @Description Reactivates a suspended, banned or pending User, requires the Admin role
+// @Tags User 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body userReactivateRequest true "request JSON params"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Insufficient role or TOTP is required"
+// @Failure 404 {object} handlers.JSONMsgStr "User not found"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /users/v1/UserReactivate [post]
+func (s *Server) userReactivateRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req userReactivateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to reactivate User", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	s.setUserStatus(w, r, req.ID, userlib.StatusActive, "", nil, "Could not reactivate User")
+}
+
+// setUserStatus sets the Status of the User with the ID and responds with the updated User
+func (s *Server) setUserStatus(w http.ResponseWriter, r *http.Request, id int, status userlib.Status, reason string, until *time.Time, errMsg string) {
+	// load the User
+	user, err := userlib.UserByID(id, s.db)
+	if err != nil {
+		log.Errorw("unable to find user", "error", err)
+		handlers.JSONMsgErr(w, r, err, errMsg)
+		return
+	}
+
+	// set the Status
+	err = user.SetStatus(status, reason, until, s.db, s.cache)
+	if err != nil {
+		log.Errorw("unable to set user status", "error", err)
+		handlers.JSONMsgErr(w, r, err, errMsg)
+		return
+	}
+
+	// remove sensitive data
+	user = removeSensitiveDataFromUser(r, user)
+
+	currentUser, _ := handlers.CurrentUser(r.Context())
+	log.Infow("Set User status", "userID", user.ID, "status", user.Status, "by", currentUser.ID)
+	handlers.JSONMsg(w, r, 200, userResponse{
+		User: user,
+	})
+}
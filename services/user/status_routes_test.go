@@ -0,0 +1,106 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+func Test_userSuspendRoute(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	suspendURL := ts.URL + "/users/v1/UserSuspend"
+	reactivateURL := ts.URL + "/users/v1/UserReactivate"
+
+	// authenticated callers
+	admin, token := mustCreateUser(t, "user_suspend_admin@example.com", userlib.RoleAdmin)
+	_, supportToken := mustCreateUser(t, "user_suspend_support@example.com", userlib.RoleSupport)
+
+	t.Run("valid SuspendRequest blocks the User until reactivated", func(t *testing.T) {
+		user, userToken := mustCreateUser(t, "user_suspend0@example.com", userlib.RoleUser)
+
+		resp := mustAuthPostRequest(t, suspendURL, token, userSuspendRequest{ID: user.ID, Reason: "spam"}, 200)
+		var suspendRsp userResponse
+		mustLoadFromResponse(t, resp, &suspendRsp)
+		assert.Equal(t, userlib.StatusSuspended, suspendRsp.User.Status)
+		assert.Equal(t, "spam", suspendRsp.User.StatusReason)
+
+		// sessions are revoked and the login is refused
+		_ = mustAuthPostRequest(t, ts.URL+"/users/v1/UserGet", userToken, userGetRequest{ID: user.ID}, 401)
+		resp = mustPostRequest(t, ts.URL+"/auth/v1/Login", loginRequest{Email: user.Email, Password: "password"}, 403)
+		var errRsp handlers.JSONMsgStr
+		mustLoadFromResponse(t, resp, &errRsp)
+		assert.Contains(t, errRsp.Msg, "Account is suspended")
+
+		resp = mustAuthPostRequest(t, reactivateURL, token, userReactivateRequest{ID: user.ID}, 200)
+		var reactivateRsp userResponse
+		mustLoadFromResponse(t, resp, &reactivateRsp)
+		assert.Equal(t, userlib.StatusActive, reactivateRsp.User.Status)
+
+		_ = mustLogin(t, user.Email, "password")
+	})
+
+	t.Run("valid SuspendRequest with Until", func(t *testing.T) {
+		user, _ := mustCreateUser(t, "user_suspend1@example.com", userlib.RoleUser)
+
+		until := time.Now().Add(time.Hour)
+		_ = mustAuthPostRequest(t, suspendURL, token, userSuspendRequest{ID: user.ID, Until: &until}, 200)
+
+		resp := mustPostRequest(t, ts.URL+"/auth/v1/Login", loginRequest{Email: user.Email, Password: "password"}, 403)
+		var errRsp handlers.JSONMsgStr
+		mustLoadFromResponse(t, resp, &errRsp)
+		assert.Contains(t, errRsp.Msg, "Account is suspended until")
+	})
+
+	t.Run("banned and pending Users are refused by the middleware", func(t *testing.T) {
+		for status, msg := range map[userlib.Status]string{
+			userlib.StatusBanned:  "Account is banned",
+			userlib.StatusPending: "Account is not activated yet",
+		} {
+			user, userToken := mustCreateUser(t, "user_suspend_"+status.String()+"@example.com", userlib.RoleUser)
+
+			// a status set in the database directly keeps the sessions
+			_, err := serverTest.db.Exec(`UPDATE users SET status=$1 WHERE id=$2`, status, user.ID)
+			assert.NoError(t, err)
+
+			resp := mustAuthPostRequest(t, ts.URL+"/users/v1/UserGet", userToken, userGetRequest{ID: user.ID}, 403)
+			var errRsp handlers.JSONMsgStr
+			mustLoadFromResponse(t, resp, &errRsp)
+			assert.Contains(t, errRsp.Msg, msg)
+		}
+	})
+
+	t.Run("invalid SuspendRequest with caller Role == RoleSupport", func(t *testing.T) {
+		user, _ := mustCreateUser(t, "user_suspend2@example.com", userlib.RoleUser)
+		_ = mustAuthPostRequest(t, suspendURL, supportToken, userSuspendRequest{ID: user.ID}, 403)
+		_ = mustAuthPostRequest(t, reactivateURL, supportToken, userReactivateRequest{ID: user.ID}, 403)
+	})
+
+	t.Run("invalid SuspendRequest of the caller", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, suspendURL, token, userSuspendRequest{ID: admin.ID}, 422)
+	})
+
+	t.Run("invalid SuspendRequest with Until in the past", func(t *testing.T) {
+		user, _ := mustCreateUser(t, "user_suspend3@example.com", userlib.RoleUser)
+
+		until := time.Now().Add(-time.Hour)
+		_ = mustAuthPostRequest(t, suspendURL, token, userSuspendRequest{ID: user.ID, Until: &until}, 422)
+	})
+
+	t.Run("invalid SuspendRequest with .ID == 0", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, suspendURL, token, userSuspendRequest{}, 404)
+		_ = mustAuthPostRequest(t, reactivateURL, token, userReactivateRequest{}, 404)
+	})
+
+	t.Run("invalid SuspendRequest with invalid json", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, suspendURL, token, "text", 400)
+		_ = mustAuthPostRequest(t, reactivateURL, token, "text", 400)
+	})
+}
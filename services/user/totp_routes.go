@@ -0,0 +1,212 @@
+package user
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/iconmobile-dev/go-core/errors"
+
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+type loginTOTPRequest struct {
+	ChallengeToken string
+	Code           string // TOTP or recovery code
+}
+
+type totpEnrollResponse struct {
+	Secret string
+	URI    string
+}
+
+type totpCodeRequest struct {
+	Code string
+}
+
+type totpConfirmResponse struct {
+	RecoveryCodes []string
+}
+
+// @Summary v1/LoginTOTP
+// @Description Completes a login of a User with enabled TOTP with the `ChallengeToken` returned by v1/Login
+// @Description and a TOTP or recovery `Code`. The ChallengeToken is revoked after 5 incorrect codes,
+// @Description incorrect codes count as failed logins of the User like incorrect passwords of v1/Login.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body loginTOTPRequest true "request JSON params"
+// @Success 200 {object} loginResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired, Code is incorrect"
+// @Failure 429 {object} handlers.JSONMsgStr "Too many failed login attempts, see Retry-After header"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/LoginTOTP [post]
+func (s *Server) loginTOTPRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req loginTOTPRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to login with TOTP", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	// load the User of the challenge
+	ip := handlers.ClientIP(r)
+	user, err := userlib.LoginChallengeUser(req.ChallengeToken, s.db, s.cache)
+	if err != nil {
+		log.Infow("failed login", "ip", ip, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	// check if logins are blocked after too many failures, codes are throttled like passwords
+	err = userlib.LoginAllowed(user.Email, ip, s.cache)
+	if err != nil {
+		log.Infow("throttled login", "ip", ip, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	// check the second factor
+	completedUser, err := userlib.CompleteLoginChallenge(req.ChallengeToken, req.Code, s.db, s.cache)
+	if err != nil {
+		log.Infow("failed login", "ip", ip, "error", err)
+		if errors.IsKind(errors.Unauthorized, err) {
+			if err := userlib.RegisterLoginFailure(user.Email, ip, s.cache); err != nil {
+				log.Errorw("error registering login failure", "error", err)
+			}
+		}
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+	user = completedUser
+
+	// create the session tokens
+	tokens, err := userlib.NewTokens(user, s.cache)
+	if err != nil {
+		log.Errorw("error creating session", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not login")
+		return
+	}
+
+	err = userlib.ResetLoginFailures(user.Email, s.cache)
+	if err != nil {
+		log.Errorw("error resetting login failures", "error", err)
+	}
+
+	log.Infow("User logged in", "userID", user.ID, "totp", true)
+	handlers.JSONMsg(w, r, 200, newLoginResponse(tokens))
+}
+
+// @Summary v1/TOTPEnroll
+// @Description Generates a new TOTP secret for the authenticated User, `URI` can be shown as QR code to authenticator apps.
+// @Description TOTP is enabled once a code is confirmed with v1/TOTPConfirm.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Success 200 {object} totpEnrollResponse
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 422 {object} handlers.JSONMsgStr "TOTP is already enabled"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/TOTPEnroll [post]
+func (s *Server) totpEnrollRoute(w http.ResponseWriter, r *http.Request) {
+	user, ok := s.loadCurrentUser(w, r, "Could not enroll TOTP")
+	if !ok {
+		return
+	}
+
+	enrollment, err := user.EnrollTOTP(s.db)
+	if err != nil {
+		log.Infow("failed totp enrollment", "userID", user.ID, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not enroll TOTP")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, totpEnrollResponse{
+		Secret: enrollment.Secret,
+		URI:    enrollment.URI,
+	})
+}
+
+// @Summary v1/TOTPConfirm
+// @Description Enables TOTP for the authenticated User if the `Code` matches the enrolled secret.
+// @Description Returns single-use recovery codes which are shown only once.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body totpCodeRequest true "request JSON params"
+// @Success 200 {object} totpConfirmResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 422 {object} handlers.JSONMsgStr "Code is incorrect"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/TOTPConfirm [post]
+func (s *Server) totpConfirmRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to confirm TOTP", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	user, ok := s.loadCurrentUser(w, r, "Could not confirm TOTP")
+	if !ok {
+		return
+	}
+
+	codes, err := user.ConfirmTOTP(req.Code, s.db, s.cache)
+	if err != nil {
+		log.Infow("failed totp confirmation", "userID", user.ID, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not confirm TOTP")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, totpConfirmResponse{
+		RecoveryCodes: codes,
+	})
+}
+
+// @Summary v1/TOTPDisable
+// @Description Disables TOTP for the authenticated User if the `Code` is a valid TOTP or recovery code.
+// @Tags Auth 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body totpCodeRequest true "request JSON params"
+// @Success 200 {object} interface{} "OK"
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 422 {object} handlers.JSONMsgStr "Code is incorrect"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /auth/v1/TOTPDisable [post]
+func (s *Server) totpDisableRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req totpCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to disable TOTP", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	user, ok := s.loadCurrentUser(w, r, "Could not disable TOTP")
+	if !ok {
+		return
+	}
+
+	err := user.DisableTOTP(req.Code, s.db, s.cache)
+	if err != nil {
+		log.Infow("failed to disable totp", "userID", user.ID, "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not disable TOTP")
+		return
+	}
+
+	handlers.JSONMsg(w, r, 200, struct{}{})
+}
@@ -0,0 +1,137 @@
+package user
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+	"github.com/iconmobile-dev/go-interview/pkg/totp"
+)
+
+// mustTOTPCode returns the code of the secret for the time step at offset steps from now
+func mustTOTPCode(t *testing.T, secret string, offset int) string {
+	code, err := totp.Code(secret, time.Now().Add(time.Duration(offset)*totp.Period))
+	require.NoError(t, err)
+	return code
+}
+
+// mustEnableTOTP enrolls and confirms TOTP for the User of the token and returns the secret
+func mustEnableTOTP(t *testing.T, token string) string {
+	resp := mustAuthPostRequest(t, ts.URL+"/auth/v1/TOTPEnroll", token, struct{}{}, 200)
+	var enrollRsp totpEnrollResponse
+	mustLoadFromResponse(t, resp, &enrollRsp)
+
+	code := mustTOTPCode(t, enrollRsp.Secret, -1)
+	_ = mustAuthPostRequest(t, ts.URL+"/auth/v1/TOTPConfirm", token, totpCodeRequest{Code: code}, 200)
+	return enrollRsp.Secret
+}
+
+func Test_totpRoutes(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	loginURL := ts.URL + "/auth/v1/Login"
+	loginTOTPURL := ts.URL + "/auth/v1/LoginTOTP"
+	enrollURL := ts.URL + "/auth/v1/TOTPEnroll"
+	confirmURL := ts.URL + "/auth/v1/TOTPConfirm"
+	disableURL := ts.URL + "/auth/v1/TOTPDisable"
+
+	user, token := mustCreateUser(t, "user_totp0@example.com", userlib.RoleUser)
+	loginReq := loginRequest{Email: user.Email, Password: "password"}
+
+	// enroll and confirm TOTP
+	resp := mustAuthPostRequest(t, enrollURL, token, struct{}{}, 200)
+	var enrollRsp totpEnrollResponse
+	mustLoadFromResponse(t, resp, &enrollRsp)
+	require.NotEmpty(t, enrollRsp.Secret)
+
+	_ = mustAuthPostRequest(t, confirmURL, token, totpCodeRequest{Code: "000000"}, 422)
+
+	resp = mustAuthPostRequest(t, confirmURL, token, totpCodeRequest{Code: mustTOTPCode(t, enrollRsp.Secret, 0)}, 200)
+	var confirmRsp totpConfirmResponse
+	mustLoadFromResponse(t, resp, &confirmRsp)
+	require.NotEmpty(t, confirmRsp.RecoveryCodes)
+
+	t.Run("valid LoginRequest requires second factor", func(t *testing.T) {
+		resp := mustPostRequest(t, loginURL, loginReq, 200)
+		var loginRsp loginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+		assert.True(t, loginRsp.TOTPRequired)
+		assert.Empty(t, loginRsp.Token)
+		require.NotEmpty(t, loginRsp.ChallengeToken)
+
+		_ = mustPostRequest(t, loginTOTPURL, loginTOTPRequest{ChallengeToken: loginRsp.ChallengeToken, Code: "000000"}, 401)
+
+		resp = mustPostRequest(t, loginTOTPURL, loginTOTPRequest{
+			ChallengeToken: loginRsp.ChallengeToken,
+			Code:           mustTOTPCode(t, enrollRsp.Secret, 1),
+		}, 200)
+		var totpRsp loginResponse
+		mustLoadFromResponse(t, resp, &totpRsp)
+		assert.NotEmpty(t, totpRsp.Token)
+		assert.NotEmpty(t, totpRsp.RefreshToken)
+	})
+
+	t.Run("valid LoginTOTPRequest with recovery code", func(t *testing.T) {
+		resp := mustPostRequest(t, loginURL, loginReq, 200)
+		var loginRsp loginResponse
+		mustLoadFromResponse(t, resp, &loginRsp)
+
+		totpReq := loginTOTPRequest{ChallengeToken: loginRsp.ChallengeToken, Code: confirmRsp.RecoveryCodes[0]}
+		_ = mustPostRequest(t, loginTOTPURL, totpReq, 200)
+		_ = mustPostRequest(t, loginTOTPURL, totpReq, 401)
+	})
+
+	t.Run("invalid LoginTOTPRequests lock the login across challenges", func(t *testing.T) {
+		throttledUser, throttledToken := mustCreateUser(t, "user_totp_throttled@example.com", userlib.RoleUser)
+		secret := mustEnableTOTP(t, throttledToken)
+		throttledLoginReq := loginRequest{Email: throttledUser.Email, Password: "password"}
+
+		challenge := func(t *testing.T) string {
+			resp := mustPostRequest(t, loginURL, throttledLoginReq, 200)
+			var loginRsp loginResponse
+			mustLoadFromResponse(t, resp, &loginRsp)
+			require.True(t, loginRsp.TOTPRequired)
+			return loginRsp.ChallengeToken
+		}
+
+		// every incorrect code of a fresh challenge counts as failed login
+		var pendingChallenge string
+		for i := 0; i <= cfg.LoginThrottle.FreeFailures; i++ {
+			pendingChallenge = challenge(t)
+			_ = mustPostRequest(t, loginTOTPURL, loginTOTPRequest{ChallengeToken: challenge(t), Code: "000000"}, 401)
+		}
+
+		// neither the password nor a correct code of an open challenge are accepted
+		resp := mustPostRequest(t, loginURL, throttledLoginReq, 429)
+		defer resp.Body.Close()
+		assert.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+		totpReq := loginTOTPRequest{ChallengeToken: pendingChallenge, Code: mustTOTPCode(t, secret, 0)}
+		_ = mustPostRequest(t, loginTOTPURL, totpReq, 429)
+	})
+
+	t.Run("invalid LoginTOTPRequest with invalid json", func(t *testing.T) {
+		_ = mustPostRequest(t, loginTOTPURL, "text", 400)
+	})
+
+	t.Run("valid TOTPDisableRequest", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, enrollURL, token, struct{}{}, 422)
+		_ = mustAuthPostRequest(t, disableURL, token, totpCodeRequest{Code: "000000"}, 422)
+		_ = mustAuthPostRequest(t, disableURL, token, totpCodeRequest{Code: confirmRsp.RecoveryCodes[1]}, 200)
+
+		// the login does not require a second factor anymore
+		_ = mustLogin(t, user.Email, "password")
+	})
+
+	t.Run("invalid requests without token", func(t *testing.T) {
+		_ = mustPostRequest(t, enrollURL, struct{}{}, 401)
+		_ = mustPostRequest(t, confirmURL, totpCodeRequest{}, 401)
+		_ = mustPostRequest(t, disableURL, totpCodeRequest{}, 401)
+	})
+}
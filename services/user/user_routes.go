@@ -2,8 +2,11 @@ package user
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 
+	"github.com/iconmobile-dev/go-core/errors"
+
 	"github.com/iconmobile-dev/go-interview/lib/handlers"
 	"github.com/iconmobile-dev/go-interview/lib/userlib"
 )
@@ -20,7 +23,7 @@ type userCreateRequest struct {
 }
 
 // @Summary v1/UserCreate
-// @Description Creates an User
+// @Description Creates an User and sends a link to verify the email
 // @Tags User 📘
 // @Accept  json
 // @Produce json
@@ -39,10 +42,11 @@ func (s *Server) userCreateRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// create User
+	// create User, signups always get the default Role
 	user := userlib.User{
 		Email:     req.Email,
 		Password:  req.Password,
+		Role:      userlib.RoleUser,
 		FirstName: req.FirstName,
 		LastName:  req.LastName,
 	}
@@ -54,8 +58,14 @@ func (s *Server) userCreateRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// remove sensitive data
-	user = removeSensitiveDataFromUser(user)
+	// the User can request another verification email if this one fails
+	err = user.SendEmailVerification(s.cache, s.mailer)
+	if err != nil {
+		log.Errorw("error sending email verification", "userID", user.ID, "error", err)
+	}
+
+	// remove sensitive data, the caller signed up as the User and sees it like itself
+	user = user.Redact(&user)
 
 	handlers.JSONMsg(w, r, 200, userResponse{
 		User: user,
@@ -63,11 +73,12 @@ func (s *Server) userCreateRoute(w http.ResponseWriter, r *http.Request) {
 }
 
 type userGetRequest struct {
-	ID int
+	ID             int
+	IncludeDeleted bool // requires at least the Support role
 }
 
 // @Summary v1/UserGet
-// @Description Gets an User
+// @Description Gets an User, deleted Users only with `IncludeDeleted` and at least the Support role with TOTP enabled
 // @Tags User 📘
 // @Accept  json
 // @Produce json
@@ -76,6 +87,7 @@ type userGetRequest struct {
 // @Param data body userGetRequest true "request JSON params"
 // @Success 200 {object} userResponse
 // @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
 // @Failure 403 {object} handlers.JSONMsgStr "Forbidden"
 // @Failure 422 {object} handlers.JSONMsgStr "Params validation error"
 // @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
@@ -89,8 +101,25 @@ func (s *Server) userGetRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// load the User
-	user, err := userlib.UserByID(req.ID, s.db)
+	// load the User, deleted Users are only visible to Support with TOTP like in RequireRole,
+	// OAuth clients have no Role
+	load := userlib.UserByID
+	if req.IncludeDeleted {
+		currentUser, ok := handlers.CurrentUser(r.Context())
+		if !ok || !currentUser.HasRole(userlib.RoleSupport) {
+			err := fmt.Errorf("user %d with role %v requested deleted users", currentUser.ID, currentUser.Role)
+			handlers.JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "Insufficient role"), "Could not get User")
+			return
+		}
+		if !currentUser.TOTPEnabled {
+			err := fmt.Errorf("user %d without totp requested deleted users", currentUser.ID)
+			handlers.JSONMsgErr(w, r, errors.E(err, errors.Forbidden, "TOTP is required"), "Could not get User")
+			return
+		}
+		load = userlib.UserByIDIncludingDeleted
+	}
+
+	user, err := load(req.ID, s.db)
 	if err != nil {
 		log.Errorw("unable to find user", "error", err)
 		handlers.JSONMsgErr(w, r, err, "Could not update User")
@@ -98,7 +127,7 @@ func (s *Server) userGetRoute(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// remove sensitive data
-	user = removeSensitiveDataFromUser(user)
+	user = removeSensitiveDataFromUser(r, user)
 
 	log.Infow("Got User", "userID", user.ID)
 	handlers.JSONMsg(w, r, 200, userResponse{
@@ -106,13 +135,209 @@ func (s *Server) userGetRoute(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+// default and maximum number of Users returned by UserList
+const (
+	defaultUserListLimit = 25
+	maxUserListLimit     = 100
+)
+
+type userListPagination struct {
+	Limit  int
+	Offset int
+	Total  int
+}
+
+type userListResponse struct {
+	Users      []userlib.User
+	Pagination userListPagination
+}
+
+// @Summary v1/UserList
+// @Description Lists Users filtered, sorted and paginated, requires at least the Support role.
+// @Description Example: `{"Filter":{"Email":{"Contains":"@acme"}},"Sort":{"Column":"created_at","Order":"desc"},"Pagination":{"Limit":50}}`
+// @Description Deleted Users are only listed with `{"Filter":{"IncludeDeleted":true}}`.
+// @Tags User 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body userlib.UserListParams true "request JSON params"
+// @Success 200 {object} userListResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Insufficient role or TOTP is required"
+// @Failure 422 {object} handlers.JSONMsgStr "Params validation error"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /users/v1/UserList [post]
+func (s *Server) userListRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req userlib.UserListParams
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to list Users", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	// limit the page size
+	switch {
+	case req.Pagination.Limit == 0:
+		req.Pagination.Limit = defaultUserListLimit
+	case req.Pagination.Limit < 0 || req.Pagination.Limit > maxUserListLimit:
+		req.Pagination.Limit = maxUserListLimit
+	}
+	if req.Pagination.Offset < 0 {
+		req.Pagination.Offset = 0
+	}
+
+	// list the Users
+	users, err := userlib.ListUsers(req, s.db)
+	if err != nil {
+		log.Errorw("unable to list users", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not list Users")
+		return
+	}
+
+	total, err := userlib.CountUsers(req.Filter, s.db)
+	if err != nil {
+		log.Errorw("unable to count users", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not list Users")
+		return
+	}
+
+	// remove sensitive data
+	for i := range users {
+		users[i] = removeSensitiveDataFromUser(r, users[i])
+	}
+
+	handlers.JSONMsg(w, r, 200, userListResponse{
+		Users: users,
+		Pagination: userListPagination{
+			Limit:  req.Pagination.Limit,
+			Offset: req.Pagination.Offset,
+			Total:  total,
+		},
+	})
+}
+
 // removeSensitiveDataFromUser removes the Password from the userlib.User
 // removes the Email from the userlib.User, if the role of the authenticated User is less than Support and it is not the same User
-func removeSensitiveDataFromUser(user userlib.User) userlib.User {
-	user.Password = ""
-	user.Email = ""
+// the policy is declared by the visible tags of userlib.User
+func removeSensitiveDataFromUser(r *http.Request, user userlib.User) userlib.User {
+	currentUser, ok := handlers.CurrentUser(r.Context())
+	if !ok {
+		return user.Redact(nil)
+	}
 
-	return user
+	return user.Redact(&currentUser)
+}
+
+type userUpdateRequest struct {
+	ID          int
+	Email       *string
+	FirstName   *string
+	LastName    *string
+	Password    *string
+	OldPassword *string
+}
+
+// @Summary v1/UserUpdate
+// @Description Updates an User, only given fields are changed.
+// @Description Users may only update themselves unless they have a higher role.
+// @Description A password change requires the `OldPassword` and revokes all tokens of the User.
+// @Description A new `Email` is stored as `EmailToVerify` until it is verified with the link sent to it.
+// @Tags User 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body userUpdateRequest true "request JSON params"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Insufficient role"
+// @Failure 404 {object} handlers.JSONMsgStr "User not found"
+// @Failure 409 {object} handlers.JSONMsgStr "User with email does already exist"
+// @Failure 422 {object} handlers.JSONMsgStr "Params validation error"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /users/v1/UserUpdate [post]
+func (s *Server) userUpdateRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req userUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to update User", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	// load the User
+	user, err := userlib.UserByID(req.ID, s.db)
+	if err != nil {
+		log.Errorw("unable to find user", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not update User")
+		return
+	}
+
+	// check the role of the authenticated User
+	currentUser, _ := handlers.CurrentUser(r.Context())
+	err = currentUser.CanModify(user)
+	if err != nil {
+		log.Infow("not allowed to update user", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not update User")
+		return
+	}
+
+	// apply the changes
+	oldHashedPassword := user.Password
+	if req.FirstName != nil {
+		user.FirstName = *req.FirstName
+	}
+	if req.LastName != nil {
+		user.LastName = *req.LastName
+	}
+	if req.Password != nil {
+		if req.OldPassword == nil {
+			handlers.JSONMsg(w, r, 422, "Could not update User: OldPassword is required to change the Password")
+			return
+		}
+		user.Password = *req.Password
+	}
+
+	// check the new email before anything is saved
+	changeEmail := req.Email != nil && userlib.NormalizeEmail(*req.Email) != user.Email
+	if changeEmail {
+		err = userlib.CheckEmailAvailable(*req.Email, s.db)
+		if err != nil {
+			log.Infow("unable to change email of user", "error", err)
+			handlers.JSONMsgErr(w, r, err, "Could not update User")
+			return
+		}
+	}
+
+	// update the User
+	err = user.Update(oldHashedPassword, req.OldPassword, s.db, s.cache)
+	if err != nil {
+		log.Errorw("unable to update user", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not update User")
+		return
+	}
+
+	// change the email once the new one is verified
+	if changeEmail {
+		err = user.ChangeEmail(*req.Email, s.db, s.cache, s.mailer)
+		if err != nil {
+			log.Errorw("unable to change email of user", "error", err)
+			handlers.JSONMsgErr(w, r, err, "Could not update User")
+			return
+		}
+	}
+
+	// remove sensitive data
+	user = removeSensitiveDataFromUser(r, user)
+
+	log.Infow("Updated User", "userID", user.ID, "by", currentUser.ID)
+	handlers.JSONMsg(w, r, 200, userResponse{
+		User: user,
+	})
 }
 
 type userDeleteRequest struct {
@@ -120,7 +345,8 @@ type userDeleteRequest struct {
 }
 
 // @Summary v1/UserDelete
-// @Description Deletes an User
+// @Description Deletes an User, requires at least the Support role.
+// @Description Deleted Users can be restored with v1/UserRestore until they are purged after the retention period.
 // @Tags User 📘
 // @Accept  json
 // @Produce json
@@ -129,7 +355,8 @@ type userDeleteRequest struct {
 // @Param data body userDeleteRequest true "request JSON params"
 // @Success 200 {object} interface{} "OK"
 // @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
-// @Failure 403 {object} handlers.JSONMsgStr "Forbidden"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Insufficient role or TOTP is required"
 // @Failure 422 {object} handlers.JSONMsgStr "Params validation error"
 // @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
 // @Router /users/v1/UserDelete [post]
@@ -150,8 +377,17 @@ func (s *Server) userDeleteRoute(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// delete the User
-	err = user.Delete(s.db)
+	// check the role of the authenticated User
+	currentUser, _ := handlers.CurrentUser(r.Context())
+	err = currentUser.CanModify(user)
+	if err != nil {
+		log.Infow("not allowed to delete user", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not delete User")
+		return
+	}
+
+	// delete the User, it can be restored until it is purged
+	err = user.Delete(s.db, s.cache)
 	if err != nil {
 		log.Errorw("unable to delete user", "error", err)
 		handlers.JSONMsgErr(w, r, err, "Could not delete User")
@@ -160,3 +396,116 @@ func (s *Server) userDeleteRoute(w http.ResponseWriter, r *http.Request) {
 
 	handlers.JSONMsg(w, r, 200, map[string]string{})
 }
+
+type userRestoreRequest struct {
+	ID int
+}
+
+// @Summary v1/UserRestore
+// @Description Restores a deleted User which was not purged yet, requires the Admin role
+// @Tags User 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body userRestoreRequest true "request JSON params"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Insufficient role or TOTP is required"
+// @Failure 404 {object} handlers.JSONMsgStr "User not found"
+// @Failure 409 {object} handlers.JSONMsgStr "User with email does already exist"
+// @Failure 422 {object} handlers.JSONMsgStr "User is not deleted"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /users/v1/UserRestore [post]
+func (s *Server) userRestoreRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req userRestoreRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to restore User", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	// load the deleted User
+	user, err := userlib.UserByIDIncludingDeleted(req.ID, s.db)
+	if err != nil {
+		log.Errorw("unable to find user", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not restore User")
+		return
+	}
+
+	// restore the User
+	err = user.Restore(s.db)
+	if err != nil {
+		log.Errorw("unable to restore user", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not restore User")
+		return
+	}
+
+	// remove sensitive data
+	user = removeSensitiveDataFromUser(r, user)
+
+	currentUser, _ := handlers.CurrentUser(r.Context())
+	log.Infow("Restored User", "userID", user.ID, "by", currentUser.ID)
+	handlers.JSONMsg(w, r, 200, userResponse{
+		User: user,
+	})
+}
+
+type userRoleSetRequest struct {
+	ID   int
+	Role userlib.Role
+}
+
+// @Summary v1/UserRoleSet
+// @Description Sets the Role of an User, requires the Admin role
+// @Description The User is signed out everywhere and gets the new Role with the next login
+// @Tags User 📘
+// @Accept  json
+// @Produce json
+// @Param Authorization header string true "Example: Bearer token"
+// @Param Accept-Language header string true "Example: en-US" default(en-US)
+// @Param data body userRoleSetRequest true "request JSON params"
+// @Success 200 {object} userResponse
+// @Failure 400 {object} handlers.JSONMsgStr "Invalid request JSON"
+// @Failure 401 {object} handlers.JSONMsgStr "Token is invalid or expired"
+// @Failure 403 {object} handlers.JSONMsgStr "Insufficient role or TOTP is required"
+// @Failure 404 {object} handlers.JSONMsgStr "User not found"
+// @Failure 422 {object} handlers.JSONMsgStr "Role is invalid"
+// @Failure 500 {object} handlers.JSONMsgStr "Internal server error"
+// @Router /users/v1/UserRoleSet [post]
+func (s *Server) userRoleSetRoute(w http.ResponseWriter, r *http.Request) {
+	// parse request JSON
+	var req userRoleSetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		log.Errorw("Could not decode JSON to set User role", "error", err)
+		handlers.JSONMsg(w, r, 400, "Invalid request JSON")
+		return
+	}
+
+	// load the User
+	user, err := userlib.UserByID(req.ID, s.db)
+	if err != nil {
+		log.Errorw("unable to find user", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not set User role")
+		return
+	}
+
+	// set the Role
+	err = user.SetRole(req.Role, s.db, s.cache)
+	if err != nil {
+		log.Errorw("unable to set user role", "error", err)
+		handlers.JSONMsgErr(w, r, err, "Could not set User role")
+		return
+	}
+
+	// remove sensitive data
+	user = removeSensitiveDataFromUser(r, user)
+
+	currentUser, _ := handlers.CurrentUser(r.Context())
+	log.Infow("Set User role", "userID", user.ID, "role", user.Role, "by", currentUser.ID)
+	handlers.JSONMsg(w, r, 200, userResponse{
+		User: user,
+	})
+}
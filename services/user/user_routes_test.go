@@ -4,7 +4,11 @@ import (
 	"testing"
 	"time"
 
+	"github.com/iconmobile-dev/go-interview/lib/handlers"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+	"github.com/iconmobile-dev/go-interview/pkg/ptrutil"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func Test_userCreateRoute(t *testing.T) {
@@ -36,8 +40,8 @@ func Test_userCreateRoute(t *testing.T) {
 		assert.WithinDuration(t, time.Now(), createRsp.User.CreatedAt, 1*time.Second)
 		assert.WithinDuration(t, time.Now(), createRsp.User.UpdatedAt, 1*time.Second)
 
-		// assert request fields
-		assert.Equal(t, "", createRsp.User.Email)
+		// assert request fields, the caller sees the own email but never the password
+		assert.Equal(t, createReq.Email, createRsp.User.Email)
 		assert.Equal(t, "", createRsp.User.Password)
 	})
 
@@ -53,6 +57,24 @@ func Test_userCreateRoute(t *testing.T) {
 		_ = mustPostRequest(t, createURL, createReq, 409)
 	})
 
+	t.Run("invalid CreateRequest with invalid fields", func(t *testing.T) {
+		t.Parallel()
+
+		createReq := validCreateReq
+		createReq.Email = "invalid"
+		createReq.Password = "short"
+		resp := mustPostRequest(t, createURL, createReq, 422)
+
+		var errRsp handlers.JSONMsgStr
+		mustLoadFromResponse(t, resp, &errRsp)
+
+		fields := []string{}
+		for _, fe := range errRsp.Fields {
+			fields = append(fields, fe.Field)
+		}
+		assert.ElementsMatch(t, []string{"Email", "Password"}, fields)
+	})
+
 	t.Run("invalid CreateRequest with invalid json", func(t *testing.T) {
 		t.Parallel()
 
@@ -80,6 +102,13 @@ func Test_userGetRoute(t *testing.T) {
 	getURL := ts.URL + "/users/v1/UserGet"
 	//failingDBGetURL := failingDBTs.URL + "/users/v1/UserGet"
 
+	// authenticated callers
+	resp := mustPostRequest(t, createURL, validCreateReq, 200)
+	var callerRsp userResponse
+	mustLoadFromResponse(t, resp, &callerRsp)
+	token := mustLogin(t, validCreateReq.Email, validCreateReq.Password)
+	_, supportToken := mustCreateUser(t, "user_get_support@example.com", userlib.RoleSupport)
+
 	t.Run("valid GetRequest", func(t *testing.T) {
 		t.Parallel()
 
@@ -92,11 +121,40 @@ func Test_userGetRoute(t *testing.T) {
 		getReq := userGetRequest{
 			ID: createRsp.User.ID,
 		}
-		resp = mustPostRequest(t, getURL, getReq, 200)
+		resp = mustAuthPostRequest(t, getURL, token, getReq, 200)
 		var getRsp userResponse
 		mustLoadFromResponse(t, resp, &getRsp)
 
 		assert.Equal(t, "", getRsp.User.Password)
+		assert.Equal(t, "", getRsp.User.Email)
+	})
+
+	t.Run("valid GetRequest of the authenticated User shows Email", func(t *testing.T) {
+		t.Parallel()
+
+		getReq := userGetRequest{
+			ID: callerRsp.User.ID,
+		}
+		resp := mustAuthPostRequest(t, getURL, token, getReq, 200)
+		var getRsp userResponse
+		mustLoadFromResponse(t, resp, &getRsp)
+
+		assert.Equal(t, "", getRsp.User.Password)
+		assert.Equal(t, validCreateReq.Email, getRsp.User.Email)
+	})
+
+	t.Run("valid GetRequest with caller Role == RoleSupport shows Email", func(t *testing.T) {
+		t.Parallel()
+
+		getReq := userGetRequest{
+			ID: callerRsp.User.ID,
+		}
+		resp := mustAuthPostRequest(t, getURL, supportToken, getReq, 200)
+		var getRsp userResponse
+		mustLoadFromResponse(t, resp, &getRsp)
+
+		assert.Equal(t, "", getRsp.User.Password)
+		assert.Equal(t, validCreateReq.Email, getRsp.User.Email)
 	})
 
 	t.Run("invalid GetRequest with Id == 0", func(t *testing.T) {
@@ -105,13 +163,25 @@ func Test_userGetRoute(t *testing.T) {
 		getReq := userGetRequest{
 			ID: 0,
 		}
-		_ = mustPostRequest(t, getURL, getReq, 404)
+		_ = mustAuthPostRequest(t, getURL, token, getReq, 404)
 	})
 
 	t.Run("invalid GetRequest with invalid json", func(t *testing.T) {
 		t.Parallel()
 
-		_ = mustPostRequest(t, getURL, "text", 400)
+		_ = mustAuthPostRequest(t, getURL, token, "text", 400)
+	})
+
+	t.Run("invalid GetRequest without token", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustPostRequest(t, getURL, userGetRequest{ID: 1}, 401)
+	})
+
+	t.Run("invalid GetRequest with invalid token", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustAuthPostRequest(t, getURL, "invalid", userGetRequest{ID: 1}, 401)
 	})
 }
 
@@ -129,6 +199,11 @@ func Test_userDeleteRoute(t *testing.T) {
 		Password: "password",
 	}
 
+	// authenticated callers
+	_, userToken := mustCreateUser(t, "user_delete_user@example.com", userlib.RoleUser)
+	_, token := mustCreateUser(t, "user_delete_support@example.com", userlib.RoleSupport)
+	admin, _ := mustCreateUser(t, "user_delete_admin@example.com", userlib.RoleAdmin)
+
 	t.Run("valid DeleteRequest", func(t *testing.T) {
 		t.Parallel()
 
@@ -141,7 +216,50 @@ func Test_userDeleteRoute(t *testing.T) {
 
 		deleteReq := userDeleteRequest{}
 		deleteReq.ID = createRsp.User.ID
-		_ = mustPostRequest(t, deleteURL, deleteReq, 200)
+		_ = mustAuthPostRequest(t, deleteURL, token, deleteReq, 200)
+	})
+
+	t.Run("invalid DeleteRequest with caller Role == RoleUser", func(t *testing.T) {
+		t.Parallel()
+
+		createReq := validCreateReq
+		createReq.Email = "user_delete2@example.com"
+		resp := mustPostRequest(t, createURL, createReq, 200)
+
+		var createRsp userResponse
+		mustLoadFromResponse(t, resp, &createRsp)
+
+		deleteReq := userDeleteRequest{}
+		deleteReq.ID = createRsp.User.ID
+		_ = mustAuthPostRequest(t, deleteURL, userToken, deleteReq, 403)
+	})
+
+	t.Run("invalid DeleteRequest with caller Role == RoleSupport without TOTP", func(t *testing.T) {
+		t.Parallel()
+
+		support, supportToken := mustCreateUser(t, "user_delete_support_without_totp@example.com", userlib.RoleSupport)
+		_, err := serverTest.db.Exec(`UPDATE users SET totp_enabled=false WHERE id=$1`, support.ID)
+		require.NoError(t, err)
+
+		createReq := validCreateReq
+		createReq.Email = "user_delete3@example.com"
+		resp := mustPostRequest(t, createURL, createReq, 200)
+
+		var createRsp userResponse
+		mustLoadFromResponse(t, resp, &createRsp)
+
+		resp = mustAuthPostRequest(t, deleteURL, supportToken, userDeleteRequest{ID: createRsp.User.ID}, 403)
+		var errRsp handlers.JSONMsgStr
+		mustLoadFromResponse(t, resp, &errRsp)
+		assert.Contains(t, errRsp.Msg, "TOTP is required")
+	})
+
+	t.Run("invalid DeleteRequest with caller Role == RoleSupport and .ID of an Admin", func(t *testing.T) {
+		t.Parallel()
+
+		deleteReq := userDeleteRequest{}
+		deleteReq.ID = admin.ID
+		_ = mustAuthPostRequest(t, deleteURL, token, deleteReq, 403)
 	})
 
 	t.Run("invalid DeleteRequest with .ID == 0", func(t *testing.T) {
@@ -149,12 +267,393 @@ func Test_userDeleteRoute(t *testing.T) {
 
 		deleteReq := userDeleteRequest{}
 		deleteReq.ID = 0
-		_ = mustPostRequest(t, deleteURL, deleteReq, 404)
+		_ = mustAuthPostRequest(t, deleteURL, token, deleteReq, 404)
 	})
 
 	t.Run("invalid DeleteRequest with invalid json", func(t *testing.T) {
 		t.Parallel()
 
-		_ = mustPostRequest(t, deleteURL, "text", 400)
+		_ = mustAuthPostRequest(t, deleteURL, token, "text", 400)
+	})
+
+	t.Run("invalid DeleteRequest without token", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustPostRequest(t, deleteURL, userDeleteRequest{ID: 1}, 401)
+	})
+}
+
+func Test_userRestoreRoute(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	getURL := ts.URL + "/users/v1/UserGet"
+	deleteURL := ts.URL + "/users/v1/UserDelete"
+	restoreURL := ts.URL + "/users/v1/UserRestore"
+
+	// authenticated callers
+	_, userToken := mustCreateUser(t, "user_restore_user@example.com", userlib.RoleUser)
+	_, supportToken := mustCreateUser(t, "user_restore_support@example.com", userlib.RoleSupport)
+	_, token := mustCreateUser(t, "user_restore_admin@example.com", userlib.RoleAdmin)
+
+	t.Run("valid RestoreRequest of deleted User", func(t *testing.T) {
+		user, _ := mustCreateUser(t, "user_restore0@example.com", userlib.RoleUser)
+		_ = mustAuthPostRequest(t, deleteURL, supportToken, userDeleteRequest{ID: user.ID}, 200)
+
+		// deleted Users are only found if asked for
+		_ = mustAuthPostRequest(t, getURL, supportToken, userGetRequest{ID: user.ID}, 404)
+		resp := mustAuthPostRequest(t, getURL, supportToken, userGetRequest{ID: user.ID, IncludeDeleted: true}, 200)
+		var getRsp userResponse
+		mustLoadFromResponse(t, resp, &getRsp)
+		assert.NotNil(t, getRsp.User.DeletedAt)
+		_ = mustAuthPostRequest(t, getURL, userToken, userGetRequest{ID: user.ID, IncludeDeleted: true}, 403)
+
+		// the login is refused until the User is restored
+		_ = mustPostRequest(t, ts.URL+"/auth/v1/Login", loginRequest{Email: user.Email, Password: "password"}, 401)
+
+		resp = mustAuthPostRequest(t, restoreURL, token, userRestoreRequest{ID: user.ID}, 200)
+		var restoreRsp userResponse
+		mustLoadFromResponse(t, resp, &restoreRsp)
+		assert.Nil(t, restoreRsp.User.DeletedAt)
+
+		_ = mustLogin(t, user.Email, "password")
+	})
+
+	t.Run("invalid RestoreRequest of User whose email was taken", func(t *testing.T) {
+		user, _ := mustCreateUser(t, "user_restore3@example.com", userlib.RoleUser)
+		_ = mustAuthPostRequest(t, deleteURL, supportToken, userDeleteRequest{ID: user.ID}, 200)
+
+		// deleted Users free their email
+		_, _ = mustCreateUser(t, user.Email, userlib.RoleUser)
+		_ = mustAuthPostRequest(t, restoreURL, token, userRestoreRequest{ID: user.ID}, 409)
+	})
+
+	t.Run("invalid RestoreRequest of User which is not deleted", func(t *testing.T) {
+		user, _ := mustCreateUser(t, "user_restore1@example.com", userlib.RoleUser)
+		_ = mustAuthPostRequest(t, restoreURL, token, userRestoreRequest{ID: user.ID}, 422)
+	})
+
+	t.Run("invalid RestoreRequest with caller Role == RoleSupport", func(t *testing.T) {
+		user, _ := mustCreateUser(t, "user_restore2@example.com", userlib.RoleUser)
+		_ = mustAuthPostRequest(t, deleteURL, supportToken, userDeleteRequest{ID: user.ID}, 200)
+		_ = mustAuthPostRequest(t, restoreURL, supportToken, userRestoreRequest{ID: user.ID}, 403)
+	})
+
+	t.Run("invalid RestoreRequest with .ID == 0", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, restoreURL, token, userRestoreRequest{}, 404)
+	})
+
+	t.Run("invalid RestoreRequest with invalid json", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, restoreURL, token, "text", 400)
+	})
+}
+
+func Test_userRoleSetRoute(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	roleSetURL := ts.URL + "/users/v1/UserRoleSet"
+
+	// authenticated callers
+	_, supportToken := mustCreateUser(t, "user_role_set_support@example.com", userlib.RoleSupport)
+	_, token := mustCreateUser(t, "user_role_set_admin@example.com", userlib.RoleAdmin)
+
+	t.Run("valid RoleSetRequest", func(t *testing.T) {
+		t.Parallel()
+
+		user, _ := mustCreateUser(t, "user_role_set0@example.com", userlib.RoleUser)
+
+		roleSetReq := userRoleSetRequest{
+			ID:   user.ID,
+			Role: userlib.RoleSupport,
+		}
+		resp := mustAuthPostRequest(t, roleSetURL, token, roleSetReq, 200)
+		var roleSetRsp userResponse
+		mustLoadFromResponse(t, resp, &roleSetRsp)
+
+		assert.Equal(t, userlib.RoleSupport, roleSetRsp.User.Role)
+	})
+
+	t.Run("invalid RoleSetRequest with caller Role == RoleSupport", func(t *testing.T) {
+		t.Parallel()
+
+		user, _ := mustCreateUser(t, "user_role_set1@example.com", userlib.RoleUser)
+
+		roleSetReq := userRoleSetRequest{
+			ID:   user.ID,
+			Role: userlib.RoleSupport,
+		}
+		_ = mustAuthPostRequest(t, roleSetURL, supportToken, roleSetReq, 403)
+	})
+
+	t.Run("invalid RoleSetRequest with invalid .Role", func(t *testing.T) {
+		t.Parallel()
+
+		user, _ := mustCreateUser(t, "user_role_set2@example.com", userlib.RoleUser)
+
+		roleSetReq := userRoleSetRequest{
+			ID:   user.ID,
+			Role: 1,
+		}
+		_ = mustAuthPostRequest(t, roleSetURL, token, roleSetReq, 422)
+	})
+
+	t.Run("invalid RoleSetRequest with .ID == 0", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustAuthPostRequest(t, roleSetURL, token, userRoleSetRequest{}, 404)
+	})
+
+	t.Run("invalid RoleSetRequest with invalid json", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustAuthPostRequest(t, roleSetURL, token, "text", 400)
+	})
+}
+
+func Test_userUpdateRoute(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	updateURL := ts.URL + "/users/v1/UserUpdate"
+	failingDBUpdateURL := failingDBTs.URL + "/users/v1/UserUpdate"
+
+	_, supportToken := mustCreateUser(t, "user_update_support@example.com", userlib.RoleSupport)
+
+	t.Run("valid UpdateRequest", func(t *testing.T) {
+		t.Parallel()
+
+		user, token := mustCreateUser(t, "user_update0@example.com", userlib.RoleUser)
+
+		updateReq := userUpdateRequest{
+			ID:        user.ID,
+			FirstName: ptrutil.String("firstname_b"),
+		}
+		resp := mustAuthPostRequest(t, updateURL, token, updateReq, 200)
+		var updateRsp userResponse
+		mustLoadFromResponse(t, resp, &updateRsp)
+
+		assert.Equal(t, "firstname_b", updateRsp.User.FirstName)
+		assert.Equal(t, user.LastName, updateRsp.User.LastName)
+		assert.Equal(t, user.Email, updateRsp.User.Email)
+		assert.Equal(t, "", updateRsp.User.Password)
+	})
+
+	t.Run("valid UpdateRequest with new Password", func(t *testing.T) {
+		t.Parallel()
+
+		user, token := mustCreateUser(t, "user_update1@example.com", userlib.RoleUser)
+
+		updateReq := userUpdateRequest{
+			ID:          user.ID,
+			Password:    ptrutil.String("new_password"),
+			OldPassword: ptrutil.String("password"),
+		}
+		_ = mustAuthPostRequest(t, updateURL, token, updateReq, 200)
+
+		// the password change revoked the token
+		_ = mustAuthPostRequest(t, updateURL, token, updateReq, 401)
+
+		_ = mustLogin(t, user.Email, "new_password")
+	})
+
+	t.Run("invalid UpdateRequest with new Password without OldPassword", func(t *testing.T) {
+		t.Parallel()
+
+		user, token := mustCreateUser(t, "user_update2@example.com", userlib.RoleUser)
+
+		updateReq := userUpdateRequest{
+			ID:       user.ID,
+			Password: ptrutil.String("new_password"),
+		}
+		_ = mustAuthPostRequest(t, updateURL, token, updateReq, 422)
+	})
+
+	t.Run("invalid UpdateRequest with new Password and incorrect OldPassword", func(t *testing.T) {
+		t.Parallel()
+
+		user, token := mustCreateUser(t, "user_update3@example.com", userlib.RoleUser)
+
+		updateReq := userUpdateRequest{
+			ID:          user.ID,
+			Password:    ptrutil.String("new_password"),
+			OldPassword: ptrutil.String("incorrect_password"),
+		}
+		_ = mustAuthPostRequest(t, updateURL, token, updateReq, 422)
+	})
+
+	t.Run("invalid UpdateRequest with taken Email keeps other changes", func(t *testing.T) {
+		t.Parallel()
+
+		user, token := mustCreateUser(t, "user_update7@example.com", userlib.RoleUser)
+		_, _ = mustCreateUser(t, "user_update8@example.com", userlib.RoleUser)
+
+		updateReq := userUpdateRequest{
+			ID:        user.ID,
+			FirstName: ptrutil.String("firstname_b"),
+			Email:     ptrutil.String("user_update8@example.com"),
+		}
+		_ = mustAuthPostRequest(t, updateURL, token, updateReq, 409)
+
+		resp := mustAuthPostRequest(t, ts.URL+"/users/v1/UserGet", token, userGetRequest{ID: user.ID}, 200)
+		var getRsp userResponse
+		mustLoadFromResponse(t, resp, &getRsp)
+		assert.Equal(t, user.FirstName, getRsp.User.FirstName)
+	})
+
+	t.Run("invalid UpdateRequest of other User", func(t *testing.T) {
+		t.Parallel()
+
+		user, _ := mustCreateUser(t, "user_update4@example.com", userlib.RoleUser)
+		_, otherToken := mustCreateUser(t, "user_update5@example.com", userlib.RoleUser)
+
+		updateReq := userUpdateRequest{
+			ID:        user.ID,
+			FirstName: ptrutil.String("firstname_b"),
+		}
+		_ = mustAuthPostRequest(t, updateURL, otherToken, updateReq, 403)
+	})
+
+	t.Run("valid UpdateRequest of other User with caller Role == RoleSupport", func(t *testing.T) {
+		t.Parallel()
+
+		user, _ := mustCreateUser(t, "user_update6@example.com", userlib.RoleUser)
+
+		updateReq := userUpdateRequest{
+			ID:        user.ID,
+			FirstName: ptrutil.String("firstname_b"),
+		}
+		resp := mustAuthPostRequest(t, updateURL, supportToken, updateReq, 200)
+		var updateRsp userResponse
+		mustLoadFromResponse(t, resp, &updateRsp)
+
+		assert.Equal(t, "firstname_b", updateRsp.User.FirstName)
+	})
+
+	t.Run("invalid UpdateRequest with .ID == 0", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustAuthPostRequest(t, updateURL, supportToken, userUpdateRequest{}, 404)
+	})
+
+	t.Run("invalid UpdateRequest with invalid json", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustAuthPostRequest(t, updateURL, supportToken, "text", 400)
+	})
+
+	t.Run("valid UpdateRequest with failingDB", func(t *testing.T) {
+		_ = mustAuthPostRequest(t, failingDBUpdateURL, supportToken, userUpdateRequest{ID: 1}, 500)
+	})
+}
+
+func Test_userListRoute(t *testing.T) {
+	t.Cleanup(func() {
+		assert.NoError(t, serverTest.db.Reset())
+		assert.NoError(t, serverTest.cache.Reset())
+	})
+
+	listURL := ts.URL + "/users/v1/UserList"
+
+	_, userToken := mustCreateUser(t, "user_list_user@example.com", userlib.RoleUser)
+	_, token := mustCreateUser(t, "user_list_support@acme.com", userlib.RoleSupport)
+	user0, _ := mustCreateUser(t, "user_list0@acme.com", userlib.RoleUser)
+	user1, _ := mustCreateUser(t, "user_list1@acme.com", userlib.RoleUser)
+
+	t.Run("valid ListRequest", func(t *testing.T) {
+		t.Parallel()
+
+		var listReq userlib.UserListParams
+		resp := mustAuthPostRequest(t, listURL, token, listReq, 200)
+		var listRsp userListResponse
+		mustLoadFromResponse(t, resp, &listRsp)
+
+		assert.Len(t, listRsp.Users, 4)
+		assert.Equal(t, 4, listRsp.Pagination.Total)
+		assert.Equal(t, defaultUserListLimit, listRsp.Pagination.Limit)
+	})
+
+	t.Run("valid ListRequest with filter, sort and pagination", func(t *testing.T) {
+		t.Parallel()
+
+		listReq := map[string]interface{}{
+			"Filter":     map[string]interface{}{"Email": map[string]interface{}{"Contains": "@acme"}},
+			"Sort":       map[string]interface{}{"Column": "created_at", "Order": "desc"},
+			"Pagination": map[string]interface{}{"Limit": 2},
+		}
+		resp := mustAuthPostRequest(t, listURL, token, listReq, 200)
+		var listRsp userListResponse
+		mustLoadFromResponse(t, resp, &listRsp)
+
+		require.Len(t, listRsp.Users, 2)
+		assert.Equal(t, user1.ID, listRsp.Users[0].ID)
+		assert.Equal(t, user0.ID, listRsp.Users[1].ID)
+		assert.Equal(t, 3, listRsp.Pagination.Total)
+		assert.Equal(t, 2, listRsp.Pagination.Limit)
+
+		// support may see the emails, but never the passwords
+		assert.Equal(t, user1.Email, listRsp.Users[0].Email)
+		assert.Equal(t, "", listRsp.Users[0].Password)
+	})
+
+	t.Run("valid ListRequest with .Pagination.Limit > maxUserListLimit", func(t *testing.T) {
+		t.Parallel()
+
+		listReq := userlib.UserListParams{}
+		listReq.Pagination.Limit = maxUserListLimit + 1
+		resp := mustAuthPostRequest(t, listURL, token, listReq, 200)
+		var listRsp userListResponse
+		mustLoadFromResponse(t, resp, &listRsp)
+
+		assert.Equal(t, maxUserListLimit, listRsp.Pagination.Limit)
+	})
+
+	t.Run("invalid ListRequest with Password filter", func(t *testing.T) {
+		t.Parallel()
+
+		listReq := map[string]interface{}{
+			"Filter": map[string]interface{}{"Password": map[string]interface{}{"StartsWith": "$2a$"}},
+		}
+		resp := mustAuthPostRequest(t, listURL, token, listReq, 200)
+		var listRsp userListResponse
+		mustLoadFromResponse(t, resp, &listRsp)
+
+		// the filter is ignored
+		assert.Equal(t, 4, listRsp.Pagination.Total)
+	})
+
+	t.Run(`invalid ListRequest with .Sort.Column == "password"`, func(t *testing.T) {
+		t.Parallel()
+
+		listReq := userlib.UserListParams{}
+		listReq.Sort.Column = "password"
+		_ = mustAuthPostRequest(t, listURL, token, listReq, 422)
+	})
+
+	t.Run("invalid ListRequest with filter on unknown column", func(t *testing.T) {
+		t.Parallel()
+
+		listReq := map[string]interface{}{
+			"Filter": map[string]interface{}{"Language": map[string]interface{}{"Is": "de"}},
+		}
+		_ = mustAuthPostRequest(t, listURL, token, listReq, 422)
+	})
+
+	t.Run("invalid ListRequest with caller Role == RoleUser", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustAuthPostRequest(t, listURL, userToken, userlib.UserListParams{}, 403)
+	})
+
+	t.Run("invalid ListRequest with invalid json", func(t *testing.T) {
+		t.Parallel()
+
+		_ = mustAuthPostRequest(t, listURL, token, "text", 400)
 	})
 }
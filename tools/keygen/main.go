@@ -0,0 +1,80 @@
+// Package main generates a new token signing key and prints the updated crypto config
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/iconmobile-dev/go-interview/config"
+	"github.com/iconmobile-dev/go-interview/lib/bootstrap"
+)
+
+var keyID = flag.String("id", "", "ID of the new key, defaults to the current date")
+var keep = flag.Int("keep", 2, "number of previous keys kept for verification, 0 keeps all")
+
+// keyBytes is the length of a generated key
+const keyBytes = 32
+
+func main() {
+	// bootstrap logger and config
+	log, cfg := bootstrap.LoggerAndConfig("keygen", false)
+
+	flag.Parse()
+
+	id := *keyID
+	if id == "" {
+		id = "k" + time.Now().UTC().Format("20060102150405")
+	}
+	if _, ok := cfg.Crypto.Keys[id]; ok {
+		log.Errorw("key ID does already exist", "id", id)
+		os.Exit(1)
+	}
+
+	b := make([]byte, keyBytes)
+	_, err := rand.Read(b)
+	if err != nil {
+		log.Errorw("error generating key", "error", err)
+		os.Exit(1)
+	}
+
+	fmt.Print(configSnippet(cfg.Crypto, id, base64.RawURLEncoding.EncodeToString(b), *keep))
+}
+
+// configSnippet returns the crypto config with the new key as active key,
+// only the previous active key and the newest other keys up to keep are retained
+func configSnippet(crypto config.Crypto, id, secret string, keep int) string {
+	// previous keys sorted by ID, the active one first
+	var previous []string
+	for previousID := range crypto.Keys {
+		if previousID != crypto.ActiveKeyID {
+			previous = append(previous, previousID)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(previous)))
+	if _, ok := crypto.Keys[crypto.ActiveKeyID]; ok {
+		previous = append([]string{crypto.ActiveKeyID}, previous...)
+	}
+	if keep > 0 && len(previous) > keep {
+		previous = previous[:keep]
+	}
+
+	var sb strings.Builder
+	sb.WriteString("[crypto]\n")
+	if crypto.TokenValuePassword != "" {
+		fmt.Fprintf(&sb, "tokenvaluepassword = %q # remove once all tokens signed with it expired\n", crypto.TokenValuePassword)
+	}
+	fmt.Fprintf(&sb, "activekeyid = %q\n\n", id)
+	sb.WriteString("[crypto.keys]\n")
+	fmt.Fprintf(&sb, "%q = %q\n", id, secret)
+	for _, previousID := range previous {
+		fmt.Fprintf(&sb, "%q = %q\n", previousID, crypto.Keys[previousID])
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,45 @@
+// Package main registers an OAuth client like an internal service and prints its secret
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/iconmobile-dev/go-interview/lib/bootstrap"
+	"github.com/iconmobile-dev/go-interview/lib/storage"
+	"github.com/iconmobile-dev/go-interview/lib/userlib"
+)
+
+var clientID = flag.String("id", "", "client ID the client authenticates with, e.g. imager")
+var name = flag.String("name", "", "readable name of the client, defaults to the client ID")
+var scopes = flag.String("scopes", userlib.ScopeUsersRead, "comma separated scopes granted to the client")
+
+func main() {
+	// bootstrap logger and config
+	log, cfg := bootstrap.LoggerAndConfig("oauthclient", false)
+	userlib.SetupLoggerAndConfig("oauthclient", false)
+
+	flag.Parse()
+
+	if *name == "" {
+		*name = *clientID
+	}
+
+	// open database
+	db, err := storage.NewDB(cfg.DB.Host, cfg.DB.Port, cfg.DB.User, cfg.DB.Password, cfg.DB.Name, cfg.DB.SSLMode)
+	if err != nil {
+		log.Errorw("error connecting to postgres database", "error", err)
+		os.Exit(1)
+	}
+
+	client, secret, err := userlib.NewOAuthClient(*clientID, *name, strings.Split(*scopes, ","), db)
+	if err != nil {
+		log.Errorw("error registering oauth client", "error", err)
+		os.Exit(1)
+	}
+
+	// the secret can't be retrieved later
+	fmt.Printf("client_id = %q\nclient_secret = %q\nscopes = %q\n", client.ClientID, secret, strings.Join(client.Scopes, " "))
+}